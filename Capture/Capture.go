@@ -0,0 +1,176 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Captures start with magic and a version byte, followed by records. Each
+// record holds, in big endian, the time it was captured in nanoseconds since
+// the epoch, its direction, the length of the peer address and the address,
+// and the length of the datagram and the datagram itself.
+const (
+	magic   = "LSNMPCAP"
+	version = 1
+
+	maxPeerLength     = 1 << 8
+	maxDatagramLength = 1 << 16
+)
+
+type Direction byte
+
+const (
+	Received Direction = 'R'
+	Sent     Direction = 'S'
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Received:
+		return "in"
+	case Sent:
+		return "out"
+	}
+	return "?"
+}
+
+// Record is a datagram as it was received from or sent to Peer, still
+// encrypted and possibly a fragment.
+type Record struct {
+	Time      time.Time
+	Direction Direction
+	Peer      string
+	Data      []byte
+}
+
+// Writer appends records to a capture file. Records are flushed as they're
+// written, so the file is usable even if the device doesn't exit cleanly.
+type Writer struct {
+	file *os.File
+	w    *bufio.Writer
+	lock sync.Mutex
+}
+
+// Create starts a capture at path, appending to it if it already holds one.
+func Create(path string) (*Writer, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() > 0 {
+		if err := readHeader(io.NewSectionReader(file, 0, info.Size())); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return &Writer{file: file, w: bufio.NewWriter(file)}, nil
+	}
+	w := &Writer{file: file, w: bufio.NewWriter(file)}
+	w.w.WriteString(magic)
+	w.w.WriteByte(version)
+	if err := w.w.Flush(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) Write(r Record) error {
+	if len(r.Peer) >= maxPeerLength || len(r.Data) >= maxDatagramLength {
+		return fmt.Errorf("record too big to be captured")
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	binary.Write(w.w, binary.BigEndian, r.Time.UnixNano())
+	w.w.WriteByte(byte(r.Direction))
+	w.w.WriteByte(byte(len(r.Peer)))
+	w.w.WriteString(r.Peer)
+	binary.Write(w.w, binary.BigEndian, uint16(len(r.Data)))
+	w.w.Write(r.Data)
+	return w.w.Flush()
+}
+
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if err := w.w.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// Reader reads the records of a capture in the order they were written.
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	if err := readHeader(br); err != nil {
+		return nil, err
+	}
+	return &Reader{r: br}, nil
+}
+
+func readHeader(r io.Reader) error {
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("not a capture: %w", err)
+	}
+	if string(header[:len(magic)]) != magic {
+		return errors.New("not a capture")
+	}
+	if header[len(magic)] != version {
+		return fmt.Errorf("unsupported capture version %d", header[len(magic)])
+	}
+	return nil
+}
+
+// Next returns the next record, or io.EOF once there are no more. A capture
+// cut in the middle of a record gives io.ErrUnexpectedEOF.
+func (r *Reader) Next() (Record, error) {
+	var nanoseconds int64
+	if err := binary.Read(r.r, binary.BigEndian, &nanoseconds); err != nil {
+		return Record{}, err
+	}
+	fixed := make([]byte, 2)
+	if _, err := io.ReadFull(r.r, fixed); err != nil {
+		return Record{}, unexpectedEOF(err)
+	}
+	peer := make([]byte, fixed[1])
+	if _, err := io.ReadFull(r.r, peer); err != nil {
+		return Record{}, unexpectedEOF(err)
+	}
+	var length uint16
+	if err := binary.Read(r.r, binary.BigEndian, &length); err != nil {
+		return Record{}, unexpectedEOF(err)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return Record{}, unexpectedEOF(err)
+	}
+	return Record{
+		Time:      time.Unix(0, nanoseconds),
+		Direction: Direction(fixed[0]),
+		Peer:      string(peer),
+		Data:      data,
+	}, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lsnmpcap")
+	records := []Record{
+		{Time: time.Unix(1720479615, 152000000), Direction: Received, Peer: "192.168.1.5:12345", Data: []byte{2, 1, 2, 3}},
+		{Time: time.Unix(1720479616, 0), Direction: Sent, Peer: "[::1]:12345", Data: []byte{}},
+	}
+	for i := range records {
+		// Appending to an existing capture keeps the earlier records
+		w, err := Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(records[i]); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	r, err := NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range records {
+		record, err := r.Next()
+		if err != nil {
+			t.Fatalf("Record %d: %v", i, err)
+		}
+		if !record.Time.Equal(expected.Time) || record.Direction != expected.Direction || record.Peer != expected.Peer || !bytes.Equal(record.Data, expected.Data) {
+			t.Errorf("Record %d is %+v, expected %+v", i, record, expected)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Expected the end of the capture, got %v", err)
+	}
+}
+
+func TestCaptureInvalid(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("not a capture"))); err == nil {
+		t.Errorf("Read something that isn't a capture")
+	}
+	r, err := NewReader(bytes.NewReader([]byte(magic + "\x01\x00\x00")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Cut record gave %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "other")
+	os.WriteFile(path, []byte("something else"), 0o644)
+	if _, err := Create(path); err == nil {
+		t.Errorf("Appended a capture to another file")
+	}
+}
@@ -0,0 +1,38 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+
+package netfuncs
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// joinIPv4 joins group on the interface ifi, or on the default one when it's
+// nil. These systems have no ip_mreqn, so the interface is picked by its IPv4
+// address.
+func joinIPv4(fd int, group net.IP, ifi *net.Interface) error {
+	mreq := &syscall.IPMreq{}
+	copy(mreq.Multiaddr[:], group)
+	if ifi != nil {
+		addr, err := interfaceIPv4(ifi)
+		if err != nil {
+			return err
+		}
+		copy(mreq.Interface[:], addr)
+	}
+	return syscall.SetsockoptIPMreq(fd, syscall.IPPROTO_IP, syscall.IP_ADD_MEMBERSHIP, mreq)
+}
+
+func interfaceIPv4(ifi *net.Interface) (net.IP, error) {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.To4(), nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no IPv4 address", ifi.Name)
+}
@@ -0,0 +1,17 @@
+package netfuncs
+
+import (
+	"net"
+	"syscall"
+)
+
+// joinIPv4 joins group on the interface ifi, or on the default one when it's
+// nil.
+func joinIPv4(fd int, group net.IP, ifi *net.Interface) error {
+	mreq := &syscall.IPMreqn{}
+	copy(mreq.Multiaddr[:], group)
+	if ifi != nil {
+		mreq.Ifindex = int32(ifi.Index)
+	}
+	return syscall.SetsockoptIPMreqn(fd, syscall.IPPROTO_IP, syscall.IP_ADD_MEMBERSHIP, mreq)
+}
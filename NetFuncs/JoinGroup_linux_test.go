@@ -0,0 +1,42 @@
+package netfuncs
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+// TestUDPMulticast joins a group on the loopback interface and checks the
+// hops are set.
+func TestUDPMulticast(t *testing.T) {
+	tr, err := ListenUDP(&net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	var lo *net.Interface
+	interfaces, _ := net.Interfaces()
+	for i := range interfaces {
+		if interfaces[i].Flags&net.FlagLoopback != 0 {
+			lo = &interfaces[i]
+		}
+	}
+	if lo == nil {
+		t.Skip("no loopback interface")
+	}
+	if err := tr.JoinGroup(&net.UDPAddr{IP: net.ParseIP("239.255.12.34"), Zone: lo.Name}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.SetMulticastHops(4); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := tr.(*UDPTransport).conn.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw.Control(func(fd uintptr) {
+		if ttl, err := syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL); err != nil || ttl != 4 {
+			t.Errorf("TTL is %d with error %v, expected 4", ttl, err)
+		}
+	})
+}
@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package netfuncs
+
+import (
+	"errors"
+	"net"
+)
+
+func (t *UDPTransport) JoinGroup(group *net.UDPAddr) error {
+	return errors.New("joining multicast groups isn't supported on this system")
+}
+
+func (t *UDPTransport) SetMulticastHops(hops int) error {
+	return errors.New("setting the multicast hops isn't supported on this system")
+}
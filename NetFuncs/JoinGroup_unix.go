@@ -0,0 +1,70 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package netfuncs
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// JoinGroup joins group on the socket already bound, instead of opening
+// another one with net.ListenMulticastUDP, which couldn't share its port.
+func (t *UDPTransport) JoinGroup(group *net.UDPAddr) error {
+	if !group.IP.IsMulticast() {
+		return fmt.Errorf("%v isn't a multicast group", group.IP)
+	}
+	var ifi *net.Interface
+	if group.Zone != "" {
+		var err error
+		if ifi, err = net.InterfaceByName(group.Zone); err != nil {
+			return err
+		}
+	}
+	raw, err := t.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var joinErr error
+	err = raw.Control(func(fd uintptr) {
+		if ip4 := group.IP.To4(); ip4 != nil {
+			joinErr = joinIPv4(int(fd), ip4, ifi)
+			return
+		}
+		mreq := &syscall.IPv6Mreq{}
+		if ifi != nil {
+			mreq.Interface = uint32(ifi.Index)
+		}
+		copy(mreq.Multiaddr[:], group.IP.To16())
+		joinErr = syscall.SetsockoptIPv6Mreq(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_JOIN_GROUP, mreq)
+	})
+	if err != nil {
+		return err
+	}
+	if joinErr != nil {
+		return fmt.Errorf("join group %v: %w", group.IP, joinErr)
+	}
+	return nil
+}
+
+// SetMulticastHops sets both the IPv4 TTL and the IPv6 hop limit, as sockets
+// listening on every address send over both, failing only when neither can be
+// set.
+func (t *UDPTransport) SetMulticastHops(hops int) error {
+	raw, err := t.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ttlErr, hopsErr error
+	err = raw.Control(func(fd uintptr) {
+		ttlErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL, hops)
+		hopsErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_HOPS, hops)
+	})
+	if err != nil {
+		return err
+	}
+	if ttlErr != nil && hopsErr != nil {
+		return fmt.Errorf("set multicast hops to %d: %w", hops, ttlErr)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package netfuncs
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	capture "github.com/eivarin/LSNMPvS-DomoticSystem/Capture"
+)
+
+const (
+	// memoryQueueLength is how many datagrams a memory transport holds before
+	// dropping new ones, like a full socket buffer would.
+	memoryQueueLength = 1024
+	// firstMemoryPort is the first port given to transports listening on
+	// port 0.
+	firstMemoryPort = 49152
+)
+
+// MemoryNetwork delivers datagrams between the transports listening on it
+// inside the process, so devices can be wired together without sockets.
+// Datagrams to addresses nobody listens on are dropped, like with UDP.
+type MemoryNetwork struct {
+	endpoints map[string]*memoryTransport
+	nextPort  int
+	lock      sync.RWMutex
+}
+
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{
+		endpoints: make(map[string]*memoryTransport),
+		nextPort:  firstMemoryPort,
+	}
+}
+
+type memoryDatagram struct {
+	from *net.UDPAddr
+	data []byte
+}
+
+type memoryTransport struct {
+	network *MemoryNetwork
+	addr    *net.UDPAddr
+	// groups are the multicast groups joined, by IP
+	groups    map[string]bool
+	queue     chan memoryDatagram
+	closed    chan struct{}
+	closeOnce sync.Once
+	writeLock sync.Mutex
+}
+
+// Listen binds a transport to addr, which must have an IP. A free port is
+// picked when its port is 0.
+func (n *MemoryNetwork) Listen(addr *net.UDPAddr) (Transport, error) {
+	if addr.IP == nil || addr.IP.IsUnspecified() {
+		return nil, fmt.Errorf("listen udp %v: memory transports need an IP to listen on", addr)
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	bound := &net.UDPAddr{IP: addr.IP, Port: addr.Port, Zone: addr.Zone}
+	if bound.Port == 0 {
+		for ; n.endpoints[(&net.UDPAddr{IP: bound.IP, Port: n.nextPort}).String()] != nil; n.nextPort++ {
+		}
+		bound.Port = n.nextPort
+		n.nextPort++
+	}
+	if _, ok := n.endpoints[bound.String()]; ok {
+		return nil, fmt.Errorf("listen udp %v: address already in use", bound)
+	}
+	t := &memoryTransport{
+		network: n,
+		addr:    bound,
+		groups:  make(map[string]bool),
+		queue:   make(chan memoryDatagram, memoryQueueLength),
+		closed:  make(chan struct{}),
+	}
+	n.endpoints[bound.String()] = t
+	return t, nil
+}
+
+// receivers returns who a datagram to addr reaches, every transport on its
+// port when it's a broadcast or the ones that joined the group when it's a
+// multicast.
+func (n *MemoryNetwork) receivers(addr *net.UDPAddr) []*memoryTransport {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	broadcast := addr.IP.Equal(net.IPv4bcast)
+	if !broadcast && !addr.IP.IsMulticast() {
+		if t, ok := n.endpoints[addr.String()]; ok {
+			return []*memoryTransport{t}
+		}
+		return nil
+	}
+	receivers := make([]*memoryTransport, 0)
+	for _, t := range n.endpoints {
+		if t.addr.Port == addr.Port && (broadcast || t.groups[addr.IP.String()]) {
+			receivers = append(receivers, t)
+		}
+	}
+	return receivers
+}
+
+func (t *memoryTransport) LocalAddr() *net.UDPAddr {
+	return t.addr
+}
+
+func (t *memoryTransport) JoinGroup(group *net.UDPAddr) error {
+	if !group.IP.IsMulticast() {
+		return fmt.Errorf("%v isn't a multicast group", group.IP)
+	}
+	t.network.lock.Lock()
+	defer t.network.lock.Unlock()
+	t.groups[group.IP.String()] = true
+	return nil
+}
+
+// SetMulticastHops does nothing, as there are no routers between memory
+// transports.
+func (t *memoryTransport) SetMulticastHops(hops int) error {
+	return nil
+}
+
+func (t *memoryTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+		t.network.lock.Lock()
+		delete(t.network.endpoints, t.addr.String())
+		t.network.lock.Unlock()
+	})
+	return nil
+}
+
+func (t *memoryTransport) Receive(buffer []byte) (int, *net.UDPAddr, error) {
+	select {
+	case d := <-t.queue:
+		n := copy(buffer, d.data)
+		record(capture.Received, d.from, buffer[:n])
+		return n, d.from, nil
+	case <-t.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (t *memoryTransport) Send(addr *net.UDPAddr, datagrams ...[]byte) error {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	select {
+	case <-t.closed:
+		return net.ErrClosed
+	default:
+	}
+	receivers := t.network.receivers(addr)
+	for _, datagram := range datagrams {
+		for _, r := range receivers {
+			d := memoryDatagram{from: t.addr, data: append([]byte(nil), datagram...)}
+			select {
+			case r.queue <- d:
+			default:
+			}
+		}
+		record(capture.Sent, addr, datagram)
+	}
+	return nil
+}
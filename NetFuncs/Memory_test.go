@@ -0,0 +1,90 @@
+package netfuncs
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func listenMemory(t *testing.T, n *MemoryNetwork, address string) Transport {
+	t.Helper()
+	tr, err := n.Listen(&net.UDPAddr{IP: net.ParseIP(address), Port: 12345})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tr.Close() })
+	return tr
+}
+
+func receive(t *testing.T, tr Transport) (string, *net.UDPAddr) {
+	t.Helper()
+	buffer := make([]byte, 16)
+	n, from, err := tr.Receive(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buffer[:n]), from
+}
+
+func TestMemoryNetwork(t *testing.T) {
+	n := NewMemoryNetwork()
+	a := listenMemory(t, n, "10.0.0.1")
+	b := listenMemory(t, n, "10.0.0.2")
+	if _, err := n.Listen(a.LocalAddr()); err == nil {
+		t.Error("listened twice on", a.LocalAddr())
+	}
+	if _, err := n.Listen(&net.UDPAddr{Port: 12345}); err == nil {
+		t.Error("listened without an IP")
+	}
+
+	if err := a.Send(b.LocalAddr(), []byte("one"), []byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"one", "two"} {
+		data, from := receive(t, b)
+		if data != expected || from.String() != "10.0.0.1:12345" {
+			t.Errorf("received %q from %v, expected %q from 10.0.0.1:12345", data, from, expected)
+		}
+	}
+	// Nobody listens there, so it's dropped
+	if err := a.Send(&net.UDPAddr{IP: net.ParseIP("10.0.0.3"), Port: 12345}, []byte("lost")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Send(&net.UDPAddr{IP: net.IPv4bcast, Port: 12345}, []byte("all")); err != nil {
+		t.Fatal(err)
+	}
+	for _, tr := range []Transport{a, b} {
+		if data, from := receive(t, tr); data != "all" || from.String() != "10.0.0.2:12345" {
+			t.Errorf("%v received %q from %v, expected the broadcast", tr.LocalAddr(), data, from)
+		}
+	}
+
+	// a gets the datagram both as a member of the group and directly
+	c := listenMemory(t, n, "fd00::3")
+	group := &net.UDPAddr{IP: net.ParseIP("ff02::1234"), Port: 12345}
+	if err := a.JoinGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if err := SendAll(c, []*net.UDPAddr{group, a.LocalAddr()}, []byte("group")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if data, from := receive(t, a); data != "group" || from.String() != "[fd00::3]:12345" {
+			t.Errorf("received %q from %v, expected the multicast", data, from)
+		}
+	}
+	if err := b.JoinGroup(&net.UDPAddr{IP: net.ParseIP("10.0.0.1")}); err == nil {
+		t.Error("joined a unicast address")
+	}
+
+	b.Close()
+	if _, _, err := b.Receive(make([]byte, 16)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("receive on a closed transport returned %v", err)
+	}
+	if err := b.Send(a.LocalAddr(), []byte("closed")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("send on a closed transport returned %v", err)
+	}
+	// Its address can be reused once closed
+	listenMemory(t, n, "10.0.0.2")
+}
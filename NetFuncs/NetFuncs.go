@@ -2,34 +2,117 @@ package netfuncs
 
 import (
 	"net"
-	"strconv"
+	"sync"
+	"time"
+
+	capture "github.com/eivarin/LSNMPvS-DomoticSystem/Capture"
 )
 
-func Send(udpAddr *net.UDPAddr, message []byte) error {
-	conn, err := net.DialUDP("udp", nil, udpAddr)
-	if err != nil {
-		return err
+var captureWriter *capture.Writer
+
+// SetCapture makes every datagram sent and received through a Transport be
+// written to w. A nil w stops capturing.
+func SetCapture(w *capture.Writer) {
+	captureWriter = w
+}
+
+func record(direction capture.Direction, addr *net.UDPAddr, datagram []byte) {
+	if captureWriter == nil {
+		return
 	}
-	defer conn.Close()
-	_, err = conn.Write(message)
+	captureWriter.Write(capture.Record{
+		Time:      time.Now(),
+		Direction: direction,
+		Peer:      addr.String(),
+		Data:      datagram,
+	})
+}
+
+// Transport sends datagrams and receives them along with who sent them,
+// replying from the address it receives on. Implementations are safe to use
+// from several goroutines.
+type Transport interface {
+	// Send writes each datagram in order to addr, without datagrams of other
+	// goroutines in between.
+	Send(addr *net.UDPAddr, datagrams ...[]byte) error
+	// Receive reads the next datagram into buffer, returning its length and
+	// who sent it. It fails with net.ErrClosed once the transport is closed.
+	Receive(buffer []byte) (int, *net.UDPAddr, error)
+	// JoinGroup makes the transport receive the datagrams sent to the
+	// multicast group at its port, joining it on the interface named by the
+	// zone of group or on the default one.
+	JoinGroup(group *net.UDPAddr) error
+	// SetMulticastHops sets how many routers the multicast datagrams sent
+	// can cross, their TTL on IPv4 and their hop limit on IPv6.
+	SetMulticastHops(hops int) error
+	LocalAddr() *net.UDPAddr
+	Close() error
+}
+
+// ListenFunc binds a transport to addr.
+type ListenFunc func(addr *net.UDPAddr) (Transport, error)
+
+func SendStrAddr(t Transport, address string, datagrams ...[]byte) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", address)
 	if err != nil {
 		return err
 	}
-	return nil
+	return t.Send(udpAddr, datagrams...)
 }
 
-func SendStrAddr(address string, message []byte) error {
-	udpAddr, err := net.ResolveUDPAddr("udp", address)
+// SendAll sends the datagrams to every address, returning the first error
+// after trying them all.
+func SendAll(t Transport, addrs []*net.UDPAddr, datagrams ...[]byte) error {
+	var firstErr error
+	for _, addr := range addrs {
+		if err := t.Send(addr, datagrams...); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// UDPTransport is a Transport over a single bound UDP socket.
+type UDPTransport struct {
+	conn *net.UDPConn
+	// writeLock keeps the fragments of a packet together
+	writeLock sync.Mutex
+}
+
+// ListenUDP binds a UDPTransport to addr.
+func ListenUDP(addr *net.UDPAddr) (Transport, error) {
+	conn, err := net.ListenUDP("udp", addr)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return Send(udpAddr, message)
+	return &UDPTransport{conn: conn}, nil
+}
+
+func (t *UDPTransport) LocalAddr() *net.UDPAddr {
+	return t.conn.LocalAddr().(*net.UDPAddr)
 }
 
-func SendBroadcast(port int, message []byte) error {
-	udpAddr, err := net.ResolveUDPAddr("udp", "255.255.255.255:"+strconv.Itoa(port))
+func (t *UDPTransport) Close() error {
+	return t.conn.Close()
+}
+
+func (t *UDPTransport) Receive(buffer []byte) (int, *net.UDPAddr, error) {
+	n, addr, err := t.conn.ReadFromUDP(buffer)
 	if err != nil {
-		return err
+		return 0, nil, err
 	}
-	return Send(udpAddr, message)
-}
\ No newline at end of file
+	record(capture.Received, addr, buffer[:n])
+	return n, addr, nil
+}
+
+func (t *UDPTransport) Send(udpAddr *net.UDPAddr, datagrams ...[]byte) error {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	for _, datagram := range datagrams {
+		if _, err := t.conn.WriteToUDP(datagram, udpAddr); err != nil {
+			return err
+		}
+		record(capture.Sent, udpAddr, datagram)
+	}
+	return nil
+}
@@ -118,6 +118,12 @@ func (m model) HandleKeyInStructure(msg tea.KeyMsg) tea.Cmd {
 		case "r":
 			m.MIB.RefreshCurrentAgent()
 			return nil
+		case "w":
+			m.MIB.WalkCurrentAgent()
+			return nil
+		case "c":
+			m.MIB.ConditionalSet = !m.MIB.ConditionalSet
+			return nil
 		case "s":
 			m.MIB.WritingSetRequest = true
 			m.MIB.CurrentInputStage = 1
@@ -148,9 +154,11 @@ func (m model) HandleKeyInStructure(msg tea.KeyMsg) tea.Cmd {
 			case 4:
 				m.MIB.CurrentInputStage = 0
 				m.MIB.WritingSetRequest = false
-				value, _ := strconv.Atoi(m.MIB.TextInputToSet.Value())
-				m.MIB.ValueToSet = types.NewCodableInt(value)
-				m.MIB.SendSetRequest()
+				if err := m.MIB.ParseValueToSet(m.MIB.TextInputToSet.Value()); err != nil {
+					m.MIB.Logger.LogError(err.Error(), "Set")
+				} else {
+					m.MIB.SendSetRequest()
+				}
 			}
 		case tea.KeyEsc.String():
 			m.MIB.WritingSetRequest = false
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	netfuncs "github.com/eivarin/LSNMPvS-DomoticSystem/NetFuncs"
+	domoticmib "github.com/eivarin/LSNMPvS-DomoticSystem/domotic-mib"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet"
+)
+
+// replayer sends requests to an agent and matches the responses it gets back
+// with them by message id.
+type replayer struct {
+	transport netfuncs.Transport
+	target    *net.UDPAddr
+	timeout   time.Duration
+	fragments *packet.Reassembler
+	pending   map[string]time.Time
+	report    *report
+	lock      sync.Mutex
+}
+
+func main() {
+	target := flag.String("target", "", "address of the agent, like 127.0.0.1:12345")
+	listen := flag.String("listen", ":12345", "address to send from and receive responses on, agents without ReplyToSource answer on their ResponsePort instead")
+	configPath := flag.String("config", "", "agent or manager yml config with the keys to use")
+	capturePath := flag.String("capture", "", "capture whose sent requests are replayed")
+	scriptPath := flag.String("script", "", "script of get and set requests to send")
+	requestTypes := flag.String("type", "GSXBC", "types of the captured requests to replay")
+	rate := flag.Float64("rate", 10, "requests sent per second, 0 to send them as fast as possible")
+	repeat := flag.Int("repeat", 1, "how many times the requests are sent")
+	timeout := flag.Duration("timeout", 2*time.Second, "how long to wait for each response")
+	user := flag.String("user", "", "user to send requests as, instead of the captured one")
+	secret := flag.String("secret", "", "secret of the user")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -target address (-capture file | -script file) [flags]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *target == "" || (*capturePath == "") == (*scriptPath == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *configPath != "" {
+		keyring, err := domoticmib.LoadKeyring(*configPath)
+		exitOnError(err)
+		packet.SetKeyring(keyring)
+	}
+	var (
+		requests []*packet.LSNMPvS_Packet
+		err      error
+	)
+	if *capturePath != "" {
+		requests, err = loadCapture(*capturePath, *requestTypes)
+	} else {
+		requests, err = loadScript(*scriptPath)
+	}
+	exitOnError(err)
+	if len(requests) == 0 {
+		exitOnError(fmt.Errorf("no requests to send"))
+	}
+	if *user != "" {
+		for _, r := range requests {
+			r.SetCredentials(packet.Credentials{User: *user, Secret: *secret})
+		}
+	}
+	targetAddr, err := net.ResolveUDPAddr("udp", *target)
+	exitOnError(err)
+	listenAddr, err := net.ResolveUDPAddr("udp", *listen)
+	exitOnError(err)
+	transport, err := netfuncs.ListenUDP(listenAddr)
+	exitOnError(err)
+	rp := &replayer{
+		transport: transport,
+		target:    targetAddr,
+		timeout:   *timeout,
+		fragments: packet.NewReassembler(packet.DefaultFragmentTimeout),
+		pending:   make(map[string]time.Time),
+		report:    newReport(*target),
+	}
+	done := make(chan struct{})
+	go func() {
+		rp.receive()
+		close(done)
+	}()
+	rp.send(requests, *repeat, *rate)
+	rp.wait()
+	transport.Close()
+	<-done
+	rp.report.write(os.Stdout)
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// send sends every request repeat times, at rate requests per second. Each
+// one is reissued first, so agents don't reject it as a replay.
+func (rp *replayer) send(requests []*packet.LSNMPvS_Packet, repeat int, rate float64) {
+	var interval time.Duration
+	if rate > 0 {
+		interval = time.Duration(float64(time.Second) / rate)
+	}
+	rp.report.start = time.Now()
+	next := rp.report.start
+	for i := 0; i < repeat; i++ {
+		for _, r := range requests {
+			if interval > 0 {
+				time.Sleep(time.Until(next))
+				next = next.Add(interval)
+			}
+			r.Reissue()
+			frames := r.EncodeFrames()
+			rp.lock.Lock()
+			rp.pending[r.GetMessageID()] = time.Now()
+			rp.report.sent[r.GetType()]++
+			rp.lock.Unlock()
+			if err := rp.transport.Send(rp.target, frames...); err != nil {
+				fmt.Fprintln(os.Stderr, "Error sending request: "+err.Error())
+			}
+		}
+	}
+	rp.report.end = time.Now()
+}
+
+// wait gives the last requests up to the timeout to be answered.
+func (rp *replayer) wait() {
+	deadline := time.Now().Add(rp.timeout)
+	for time.Now().Before(deadline) {
+		rp.lock.Lock()
+		pending := len(rp.pending)
+		rp.lock.Unlock()
+		if pending == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (rp *replayer) receive() {
+	for {
+		buffer := make([]byte, packet.MaxPacketSize)
+		n, addr, err := rp.transport.Receive(buffer)
+		if err != nil {
+			return
+		}
+		received := time.Now()
+		frame, complete, err := rp.fragments.Add(addr.String(), buffer[:n])
+		if err == nil && !complete {
+			continue
+		}
+		p := &packet.LSNMPvS_Packet{}
+		if err == nil {
+			_, err = p.Decode(frame)
+		}
+		rp.lock.Lock()
+		sent, ok := rp.pending[p.GetMessageID()]
+		switch {
+		case err != nil:
+			rp.report.undecoded++
+		case !ok || p.GetType() != 'R':
+			rp.report.unmatched++
+		case received.Sub(sent) > rp.timeout:
+			delete(rp.pending, p.GetMessageID())
+			rp.report.late++
+		default:
+			delete(rp.pending, p.GetMessageID())
+			rp.report.addResponse(p, received.Sub(sent))
+		}
+		rp.lock.Unlock()
+	}
+}
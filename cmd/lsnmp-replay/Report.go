@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet"
+)
+
+// report gathers what happened to the requests sent.
+type report struct {
+	target     string
+	sent       map[byte]int
+	latencies  []time.Duration
+	errors     map[packet.PacketErr]int
+	unmatched  int
+	undecoded  int
+	late       int
+	start, end time.Time
+}
+
+func newReport(target string) *report {
+	return &report{
+		target: target,
+		sent:   make(map[byte]int),
+		errors: make(map[packet.PacketErr]int),
+	}
+}
+
+func (r *report) totalSent() int {
+	total := 0
+	for _, n := range r.sent {
+		total += n
+	}
+	return total
+}
+
+func (r *report) addResponse(response *packet.LSNMPvS_Packet, latency time.Duration) {
+	r.latencies = append(r.latencies, latency)
+	for _, e := range response.GetErrors() {
+		r.errors[e.Code]++
+	}
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+func (r *report) write(w io.Writer) {
+	total := r.totalSent()
+	elapsed := r.end.Sub(r.start)
+	fmt.Fprintf(w, "Sent %d requests to %s in %v", total, r.target, elapsed.Round(time.Millisecond))
+	if elapsed > 0 {
+		fmt.Fprintf(w, " (%.1f/s)", float64(total)/elapsed.Seconds())
+	}
+	fmt.Fprintln(w)
+	pTypes := make([]byte, 0, len(r.sent))
+	for pType := range r.sent {
+		pTypes = append(pTypes, pType)
+	}
+	slices.Sort(pTypes)
+	for _, pType := range pTypes {
+		fmt.Fprintf(w, "  %c: %d\n", pType, r.sent[pType])
+	}
+	// Late responses did arrive, so they aren't counted as lost
+	lost := total - len(r.latencies) - r.late
+	lossRate := 0.0
+	if total > 0 {
+		lossRate = 100 * float64(lost) / float64(total)
+	}
+	fmt.Fprintf(w, "Responses: %d, lost: %d (%.1f%%), late: %d, unmatched: %d, undecodable: %d\n", len(r.latencies), lost, lossRate, r.late, r.unmatched, r.undecoded)
+	if len(r.latencies) > 0 {
+		sorted := slices.Clone(r.latencies)
+		slices.Sort(sorted)
+		var sum time.Duration
+		for _, l := range sorted {
+			sum += l
+		}
+		fmt.Fprintf(w, "Latency: min %v, avg %v, p50 %v, p95 %v, p99 %v, max %v\n",
+			sorted[0], sum/time.Duration(len(sorted)), percentile(sorted, 50), percentile(sorted, 95), percentile(sorted, 99), sorted[len(sorted)-1])
+	}
+	if len(r.errors) == 0 {
+		fmt.Fprintln(w, "Errors: none")
+		return
+	}
+	codes := make([]int, 0, len(r.errors))
+	for code := range r.errors {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	fmt.Fprintln(w, "Errors:")
+	for _, code := range codes {
+		fmt.Fprintf(w, "  %d %v: %d\n", code, packet.PacketErr(code), r.errors[packet.PacketErr(code)])
+	}
+}
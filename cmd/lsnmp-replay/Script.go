@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	capture "github.com/eivarin/LSNMPvS-DomoticSystem/Capture"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types"
+)
+
+// valueTemplates maps the type names used in scripts to values of that type,
+// for types.ParseCodableValue.
+var valueTemplates = map[string]*types.CompleteCodableValue{
+	"int":       types.NewCodableInt(0),
+	"string":    types.NewCodableString(""),
+	"bool":      types.NewCodableBool(false),
+	"decimal":   types.NewCodableDecimal(0, 0),
+	"octets":    types.NewCodableOctetString(nil),
+	"counter":   types.NewCodableCounter(0),
+	"timestamp": types.NewCodableTimestamp(time.Time{}),
+	"duration":  types.NewCodableDuration(0),
+}
+
+// loadScript reads requests written one per line, like
+//
+//	get 1.1.1 2.3.0.0
+//	set 3.3.1=int:1 1.2.1=string:Lights
+//
+// Empty lines and lines starting with # are skipped.
+func loadScript(path string) ([]*packet.LSNMPvS_Packet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	requests := make([]*packet.LSNMPvS_Packet, 0)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		request, err := parseRequest(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		requests = append(requests, request)
+	}
+	return requests, scanner.Err()
+}
+
+func parseRequest(fields []string) (*packet.LSNMPvS_Packet, error) {
+	if len(fields) < 2 {
+		return nil, errors.New("request without iids")
+	}
+	iidList := types.CodableList{}
+	valueList := types.CodableList{}
+	for _, field := range fields[1:] {
+		iidText, valueText, hasValue := strings.Cut(field, "=")
+		iid, err := parseIID(iidText)
+		if err != nil {
+			return nil, err
+		}
+		iidList.Append(iid)
+		if fields[0] == "set" {
+			if !hasValue {
+				return nil, fmt.Errorf("set of %s without a value", iidText)
+			}
+			value, err := parseValue(valueText)
+			if err != nil {
+				return nil, err
+			}
+			valueList.Append(value)
+		} else if hasValue {
+			return nil, fmt.Errorf("%s can't have values", fields[0])
+		}
+	}
+	switch fields[0] {
+	case "get":
+		return packet.NewGetRequestPacket(iidList), nil
+	case "set":
+		return packet.NewSetResponsePacket(iidList, valueList), nil
+	}
+	return nil, fmt.Errorf("unknown request %q, expected get or set", fields[0])
+}
+
+func parseIID(text string) (*types.CompleteCodableValue, error) {
+	parts := strings.Split(text, ".")
+	if len(parts) < 2 || len(parts) > 4 {
+		return nil, fmt.Errorf("invalid iid %q", text)
+	}
+	values := make([]int, len(parts))
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid iid %q", text)
+		}
+		values[i] = value
+	}
+	return types.NewCodableIID(values[0], values[1], values[2:]), nil
+}
+
+func parseValue(text string) (*types.CompleteCodableValue, error) {
+	typeName, valueText, ok := strings.Cut(text, ":")
+	template, known := valueTemplates[typeName]
+	if !ok || !known {
+		return nil, fmt.Errorf("invalid value %q, expected type:value with a type like int or string", text)
+	}
+	return types.ParseCodableValue(template, valueText)
+}
+
+// loadCapture returns the requests sent in a capture whose type is in
+// requestTypes, which are the ones a manager sent when it was captured.
+func loadCapture(path, requestTypes string) ([]*packet.LSNMPvS_Packet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader, err := capture.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	fragments := packet.NewReassembler(packet.DefaultFragmentTimeout)
+	requests := make([]*packet.LSNMPvS_Packet, 0)
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return requests, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record.Direction != capture.Sent {
+			continue
+		}
+		frame, complete, err := fragments.Add(record.Peer, record.Data)
+		if err != nil || !complete {
+			continue
+		}
+		p := &packet.LSNMPvS_Packet{}
+		if _, err := p.Decode(frame); err != nil {
+			continue
+		}
+		if strings.ContainsRune(requestTypes, rune(p.GetType())) {
+			requests = append(requests, p)
+		}
+	}
+}
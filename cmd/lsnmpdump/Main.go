@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	capture "github.com/eivarin/LSNMPvS-DomoticSystem/Capture"
+	domoticmib "github.com/eivarin/LSNMPvS-DomoticSystem/domotic-mib"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+)
+
+type filters struct {
+	types     string
+	peer      string
+	messageID string
+}
+
+func (f filters) matchPeer(peer string) bool {
+	if f.peer == "" || f.peer == peer {
+		return true
+	}
+	host, _, err := net.SplitHostPort(peer)
+	return err == nil && host == f.peer
+}
+
+func (f filters) matchPacket(p *packet.LSNMPvS_Packet) bool {
+	if f.types != "" && !strings.ContainsRune(f.types, rune(p.GetType())) {
+		return false
+	}
+	return f.messageID == "" || f.messageID == p.GetMessageID()
+}
+
+type dumper struct {
+	filters   filters
+	json      bool
+	fragments *packet.Reassembler
+	out       *bufio.Writer
+}
+
+func main() {
+	configPath := flag.String("config", "", "agent or manager yml config with the keys to decrypt packets")
+	hexInput := flag.Bool("hex", false, "read hex dumps, one datagram per line optionally preceded by in/out and the peer, instead of captures")
+	typesFilter := flag.String("type", "", "only show packets of these types, like GR")
+	peerFilter := flag.String("peer", "", "only show packets from or to this address or host")
+	idFilter := flag.String("id", "", "only show packets with this message id")
+	jsonOutput := flag.Bool("json", false, "print packets as JSON, one per line, with the user of their credentials but not the secret")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [capture files...]\nReads standard input when no files are given.\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *configPath != "" {
+		keyring, err := domoticmib.LoadKeyring(*configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		packet.SetKeyring(keyring)
+	}
+	d := dumper{
+		filters:   filters{types: *typesFilter, peer: *peerFilter, messageID: *idFilter},
+		json:      *jsonOutput,
+		fragments: packet.NewReassembler(packet.DefaultFragmentTimeout),
+		out:       bufio.NewWriter(os.Stdout),
+	}
+	defer d.out.Flush()
+	read := d.readCapture
+	if *hexInput {
+		read = d.readHex
+	}
+	if flag.NArg() == 0 {
+		if err := read(os.Stdin); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			d.out.Flush()
+			os.Exit(1)
+		}
+		return
+	}
+	for _, path := range flag.Args() {
+		file, err := os.Open(path)
+		if err == nil {
+			err = read(file)
+			file.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			d.out.Flush()
+			os.Exit(1)
+		}
+	}
+}
+
+func (d *dumper) readCapture(r io.Reader) error {
+	reader, err := capture.NewReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		d.dump(record)
+	}
+}
+
+func (d *dumper) readHex(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 4*packet.MaxPacketSize)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		record := capture.Record{Peer: "-"}
+		if len(fields) >= 3 && (fields[0] == "in" || fields[0] == "out") {
+			record.Direction = capture.Received
+			if fields[0] == "out" {
+				record.Direction = capture.Sent
+			}
+			record.Peer = fields[1]
+			fields = fields[2:]
+		}
+		data, err := hex.DecodeString(strings.TrimPrefix(strings.Join(fields, ""), "0x"))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		record.Data = data
+		d.dump(record)
+	}
+	return scanner.Err()
+}
+
+func (d *dumper) dump(record capture.Record) {
+	if !d.filters.matchPeer(record.Peer) {
+		return
+	}
+	frame, complete, err := d.fragments.Add(record.Direction.String()+" "+record.Peer, record.Data)
+	if err == nil && !complete {
+		return
+	}
+	p := &packet.LSNMPvS_Packet{}
+	if err == nil {
+		_, err = p.Decode(frame)
+	}
+	if err != nil {
+		if d.filters.types == "" && d.filters.messageID == "" {
+			fmt.Fprintf(d.out, "%s %v\n", recordHeader(record), err)
+		}
+		return
+	}
+	if !d.filters.matchPacket(p) {
+		return
+	}
+	if d.json {
+		// Like the text output, only the user of the credentials is shown
+		encoded, err := json.Marshal(p)
+		if err != nil {
+			fmt.Fprintf(d.out, "%s %v\n", recordHeader(record), err)
+			return
+		}
+		fmt.Fprintln(d.out, string(encoded))
+		return
+	}
+	header := fmt.Sprintf("%s %c v%d id=%s ts=%v", recordHeader(record), p.GetType(), p.GetVersion(), p.GetMessageID(), p.GetTimestamp())
+	if user := p.GetCredentials().User; user != "" {
+		header += " user=" + user
+	}
+	fmt.Fprintln(d.out, header)
+	pairs := p.GetIidValuePairList()
+	for _, pair := range pairs {
+		if pair.Value == nil {
+			fmt.Fprintf(d.out, "  %s\n", iidString(pair.IID))
+			continue
+		}
+		fmt.Fprintf(d.out, "  %s = %v\n", iidString(pair.IID), pair.Value)
+	}
+	values := p.GetValueList()
+	for i := len(pairs) + 1; i <= len(values); i++ {
+		if value, ok := values[i]; ok {
+			fmt.Fprintf(d.out, "  value %d = %v\n", i, value)
+		}
+	}
+	for _, e := range p.GetErrors() {
+		fmt.Fprintf(d.out, "  error %d at %d: %v\n", int(e.Code), e.Index, e.Code)
+	}
+}
+
+func recordHeader(record capture.Record) string {
+	when := "-"
+	if !record.Time.IsZero() {
+		when = record.Time.Format("2006-01-02 15:04:05.000")
+	}
+	return fmt.Sprintf("%s %s %s", when, record.Direction, record.Peer)
+}
+
+func iidString(value *types.CompleteCodableValue) string {
+	iid, ok := value.Value.(*CodableValues.IID)
+	if !ok {
+		return value.String()
+	}
+	parts := []string{strconv.Itoa(iid.Structure), strconv.Itoa(iid.Object)}
+	for _, index := range []*int{iid.FirstIndex, iid.SecondIndex} {
+		if index != nil {
+			parts = append(parts, strconv.Itoa(*index))
+		}
+	}
+	return strings.Join(parts, ".")
+}
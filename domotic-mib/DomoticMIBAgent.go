@@ -1,9 +1,12 @@
 package domoticmib
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
@@ -17,15 +20,30 @@ import (
 
 type DomoticMIBAgent struct {
 	mib.MIB
-	Device          *mib.Group
-	Sensors         *mib.Table
-	Actuators       *mib.Table
-	Name            string
-	OriginalConfig  DomoticMIBAgentConfig
-	updateFrequency time.Duration
+	Device    *mib.Group
+	Sensors   *mib.Table
+	Actuators *mib.Table
+	// NotificationTargets are the managers notifications are sent to, saved to
+	// notificationTargetsFile whenever they're set
+	NotificationTargets     *mib.Table
+	Name                    string
+	OriginalConfig          DomoticMIBAgentConfig
+	ConfigPath              string
+	updateFrequency         time.Duration
+	notificationTargetsFile string
+	targets                 *notificationTargets
+	// saveLock makes each save read the targets after the ones before it
+	// were written, so an older copy never replaces a newer one
+	saveLock *sync.Mutex
 }
 
 func NewDomoticMIB(ymlConfig string) (DomoticMIBAgent, error) {
+	return NewDomoticMIBOn(ymlConfig, netfuncs.ListenUDP)
+}
+
+// NewDomoticMIBOn creates the agent configured in ymlConfig listening with
+// listen, like on a netfuncs.MemoryNetwork in tests.
+func NewDomoticMIBOn(ymlConfig string, listen netfuncs.ListenFunc) (DomoticMIBAgent, error) {
 	config, err := LoadMIBAgentConfig(ymlConfig)
 	logger := CustomLogger.NewCustomLogger()
 	logger.LogInfo(fmt.Sprintf("Config %s Loaded", ymlConfig), "StartUP")
@@ -38,34 +56,101 @@ func NewDomoticMIB(ymlConfig string) (DomoticMIBAgent, error) {
 	if err != nil {
 		return DomoticMIBAgent{}, err
 	}
+	if err := checkValueTypes(config); err != nil {
+		return DomoticMIBAgent{}, err
+	}
+	keyring, err := NewKeyringFromConfig(config.Keys)
+	if err != nil {
+		return DomoticMIBAgent{}, err
+	}
+	packet.SetKeyring(keyring)
+	logger.LogInfo(fmt.Sprintf("Keyring Loaded, active key is %q", keyring.ActiveKeyID()), "StartUP")
+	if err := applyProtocolVersion(config.ProtocolVersion); err != nil {
+		return DomoticMIBAgent{}, err
+	}
+	if err := applyLimits(config.Limits); err != nil {
+		return DomoticMIBAgent{}, err
+	}
+	if err := applyCapture(config.Capture, &logger); err != nil {
+		return DomoticMIBAgent{}, err
+	}
+	access, err := NewAccessControlFromConfig(config.Access, config.Views)
+	if err != nil {
+		return DomoticMIBAgent{}, err
+	}
+	if len(access) == 0 {
+		logger.LogWarning("No access configured, every request will be accepted", "StartUP")
+	}
+	network, err := NewNetworkFromConfig(config.Network)
+	if err != nil {
+		return DomoticMIBAgent{}, err
+	}
+	targetsFile := notificationTargetsPath(ymlConfig, config.NotificationTargetsFile)
+	targetConfigs, err := loadNotificationTargets(targetsFile, config.Network)
+	if err != nil {
+		return DomoticMIBAgent{}, err
+	}
+	targets := NewNotificationTargetsTable(targetConfigs)
+	logger.LogInfo("Notification Targets Table Created", "StartUP")
+	transport, err := network.Listen(listen, network.RequestPort)
+	if err != nil {
+		return DomoticMIBAgent{}, err
+	}
+	logger.LogInfo("Listening for requests on "+transport.LocalAddr().String(), "StartUP")
+	if network.NotificationGroup != nil && network.NotificationHops != 0 {
+		if err := transport.SetMulticastHops(network.NotificationHops); err != nil {
+			transport.Close()
+			return DomoticMIBAgent{}, err
+		}
+	}
 	agent := DomoticMIBAgent{
-		MIB:             mib.NewMIB(&logger, []mib.StructureI{device, sensors, actuators}),
-		Device:          device,
-		Sensors:         sensors,
-		Actuators:       actuators,
-		updateFrequency: 1 * time.Second,
-		Name:            config.Device.ID,
-		OriginalConfig:  config,
+		MIB:                     mib.NewMIB(&logger, []mib.StructureI{device, sensors, actuators, targets}),
+		Device:                  device,
+		Sensors:                 sensors,
+		Actuators:               actuators,
+		NotificationTargets:     targets,
+		updateFrequency:         1 * time.Second,
+		Name:                    config.Device.ID,
+		OriginalConfig:          config,
+		ConfigPath:              ymlConfig,
+		notificationTargetsFile: targetsFile,
+		targets:                 newNotificationTargets(targets, network.NotificationPort),
+		saveLock:                &sync.Mutex{},
+	}
+	agent.Access = access
+	agent.Network = network
+	agent.Targets = agent.targets
+	agent.Transport = transport
+	if err := applyReplayWindow(&agent.Packets, config.ReplayWindow); err != nil {
+		transport.Close()
+		return DomoticMIBAgent{}, err
 	}
 	return agent, nil
 }
 
-func (d *DomoticMIBAgent) UpdateName() {
+// GetName returns the id of the device as it is now.
+func (d *DomoticMIBAgent) GetName() string {
 	obj := d.Device.Objects.(DeviceObjects).Id
 	nameValue, _ := obj.Get()
-	name := nameValue.Value.(*CodableValues.CodableString).Value
-	d.Name = name
+	return nameValue.Value.(*CodableValues.CodableString).Value
 }
 
-func (d *DomoticMIBAgent) Get(structure, objectIID int, index *int) (types.IdValuePair, packet.PacketErr) {
-	return d.MIB.Get(structure, objectIID, index)
+func (d *DomoticMIBAgent) UpdateName() {
+	d.Name = d.GetName()
 }
 
-func (d *DomoticMIBAgent) Set(structure, objectIID int, index *int, value types.CompleteCodableValue) packet.PacketErr {
-	return d.MIB.Set(structure, objectIID, index, value)
+func (d *DomoticMIBAgent) Get(view *mib.View, structure, objectIID int, index *int) (types.IdValuePair, packet.PacketErr) {
+	return d.MIB.Get(view, structure, objectIID, index)
+}
+
+func (d *DomoticMIBAgent) Set(view *mib.View, structure, objectIID int, index *int, value types.CompleteCodableValue) packet.PacketErr {
+	return d.MIB.Set(view, structure, objectIID, index, value)
 }
 
 func (d *DomoticMIBAgent) StartAgent(sub chan struct{}) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go WatchKeyring(d.ConfigPath, loadAgentKeys, d.Logger, stop)
 	d.StartAgentUpdater(sub)
 	d.MIB.StartNotificationLoop(sub)
 	d.ListenForRequests(sub)
@@ -76,7 +161,7 @@ func (d *DomoticMIBAgent) StartNotifications(sub chan struct{}) {
 		for {
 			time.Sleep(d.Device.GetNotificationRate())
 			d.Device.RLock()
-			d.Device.SendNotifications(d.GetUptime())
+			d.Device.SendNotifications(d.Transport, d.NotificationAddrs(d.Device), d.GetUptime())
 			d.Logger.LogInfo("Sent Notifications", "Notification")
 			sub <- struct{}{}
 			d.Device.RUnlock()
@@ -113,21 +198,33 @@ func (d *DomoticMIBAgent) UpdateDevice() {
 }
 
 func (d *DomoticMIBAgent) ListenForRequests(sub chan struct{}) {
-	addr := &net.UDPAddr{
-		IP:   net.ParseIP("0.0.0.0"),
-		Port: 12345,
-	}
-	udpListener, _ := net.ListenUDP("udp", addr)
 	for {
-		buffer := make([]byte, 10000)
-		n, addr, _ := udpListener.ReadFromUDP(buffer)
+		buffer := make([]byte, packet.MaxPacketSize)
+		n, addr, err := d.Transport.Receive(buffer)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			d.MIB.Logger.LogError("Error receiving packet: "+err.Error(), "Request")
+			continue
+		}
+		frame, complete, err := d.Fragments.Add(addr.String(), buffer[:n])
+		if err == nil && !complete {
+			continue
+		}
 		newPacket := packet.LSNMPvS_Packet{}
-		_, e := newPacket.Decode(string(buffer[:n]))
-		if e != 0 {
+		if err == nil {
+			_, err = newPacket.Decode(frame)
+		}
+		if err != nil && !packet.Authenticated(err) {
+			d.MIB.Logger.LogError(err.Error(), "Request")
+			continue
+		}
+		if err != nil {
 			go func() {
-				errPacket := packet.NewErrorDecodingPacket(e)
-				netfuncs.Send(addr, []byte(errPacket.Encode()))
-				d.MIB.Logger.LogError(e.Error(), "Request")
+				errPacket := packet.NewErrorDecodingPacket(packet.DecodeErrorCode(err))
+				d.Transport.Send(addr, []byte(errPacket.Encode()))
+				d.MIB.Logger.LogError(err.Error(), "Request")
 			}()
 			continue
 		}
@@ -137,39 +234,157 @@ func (d *DomoticMIBAgent) ListenForRequests(sub chan struct{}) {
 
 func (d *DomoticMIBAgent) HandleGet(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
 	structureLengths := d.GetStructureLengths()
-	list, allOK := r.GetUncompressedIdValuePairList(structureLengths)
-	if !allOK {
-		return packet.PacketErr(packet.ErrorInvalidGroupIndexes).Compile(r)
+	list, pErr := r.GetUncompressedIdValuePairList(structureLengths)
+	if pErr != 0 {
+		return pErr.Compile(r)
 	}
+	view := d.Access.ViewFor(r.GetCredentials())
 	respList := make([]types.IdValuePair, len(list))
+	errorList := make([]packet.ErrorEntry, 0)
 	for i, idValuePair := range list {
 		iid := idValuePair.IID.Value.(*CodableValues.IID)
-		value, pErr := d.Get(iid.Structure, iid.Object, iid.FirstIndex)
+		value, pErr := d.Get(view, iid.Structure, iid.Object, iid.FirstIndex)
 		if pErr != 0 {
-			return pErr.Compile(r)
+			value.Value = types.NewCodableNull()
+			errorList = append(errorList, packet.ErrorEntry{Index: i + 1, Code: pErr})
 		}
 		respList[i] = value
 	}
-	return r.NewResponsePacket(respList, d.GetUptime()), nil, true
+	return r.NewResponsePacketWithErrors(respList, errorList, d.GetUptime()), nil, true
 }
 
 func (d *DomoticMIBAgent) HandleSet(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
 	structureLengths := d.GetStructureLengths()
-	list, allOK := r.GetUncompressedIdValuePairList(structureLengths)
-	if !allOK {
-		return packet.PacketErr(packet.ErrorInvalidGroupIndexes).Compile(r)
+	list, pErr := r.GetUncompressedIdValuePairList(structureLengths)
+	if pErr != 0 {
+		return pErr.Compile(r)
+	}
+	respList := make([]types.IdValuePair, len(list))
+	for i, idValuePair := range list {
+		respList[i] = idValuePair
+		if idValuePair.Value == nil {
+			respList[i].Value = types.NewCodableNull()
+		}
+	}
+	var conditions []types.IdValuePair
+	if r.GetType() == 'C' {
+		conditions, _ = r.GetUncompressedConditionList(structureLengths)
 	}
+	errorList := d.SetAll(d.Access.ViewFor(r.GetCredentials()), list, conditions)
+	if len(errorList) == 0 {
+		d.Device.Objects.(DeviceObjects).UpdateLastTimeChanged()
+		d.saveNotificationTargetsIfSet(list)
+	}
+	return r.NewResponsePacketWithErrors(respList, errorList, d.GetUptime()), nil, true
+}
+
+// saveNotificationTargetsIfSet resolves and saves the notification targets
+// when pairs set any of them, so they're kept across restarts.
+func (d *DomoticMIBAgent) saveNotificationTargetsIfSet(pairs []types.IdValuePair) {
+	for _, pair := range pairs {
+		if pair.IID.Value.(*CodableValues.IID).Structure == d.NotificationTargets.StructureIID {
+			d.saveLock.Lock()
+			defer d.saveLock.Unlock()
+			d.targets.refresh()
+			if err := saveNotificationTargets(d.notificationTargetsFile, d.NotificationTargets); err != nil {
+				d.Logger.LogError("Error saving notification targets: "+err.Error(), "Set")
+			}
+			return
+		}
+	}
+}
+
+func (d *DomoticMIBAgent) HandleGetNext(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
+	list := r.GetIidValuePairList()
+	view := d.Access.ViewFor(r.GetCredentials())
 	respList := make([]types.IdValuePair, len(list))
+	errorList := make([]packet.ErrorEntry, 0)
 	for i, idValuePair := range list {
 		iid := idValuePair.IID.Value.(*CodableValues.IID)
-		pErr := d.Set(iid.Structure, iid.Object, iid.FirstIndex, *idValuePair.Value)
+		index := 0
+		if iid.FirstIndex != nil {
+			index = *iid.FirstIndex
+		}
+		value, pErr := d.Next(view, iid.Structure, iid.Object, index)
 		if pErr != 0 {
-			return pErr.Compile(r)
+			value = types.IdValuePair{IID: idValuePair.IID, Value: types.NewCodableNull()}
+			errorList = append(errorList, packet.ErrorEntry{Index: i + 1, Code: pErr})
 		}
-		respList[i] = idValuePair
+		respList[i] = value
 	}
-	d.Device.Objects.(DeviceObjects).UpdateLastTimeChanged()
-	return r.NewResponsePacket(respList, d.GetUptime()), nil, true
+	return r.NewResponsePacketWithErrors(respList, errorList, d.GetUptime()), nil, true
+}
+
+// HandleGetBulk answers with the object after each non-repeater IID and then
+// with as many rows after the remaining IIDs as fit in the response. A caller
+// continues from the last IIDs it got for columns that didn't reach the end.
+func (d *DomoticMIBAgent) HandleGetBulk(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
+	nonRepeaters, maxRepetitions, maxSize, pErr := r.GetBulkParameters()
+	if pErr != 0 {
+		return pErr.Compile(r)
+	}
+	requested := r.GetIidValuePairList()
+	view := d.Access.ViewFor(r.GetCredentials())
+	resp := r.NewResponsePacket(nil, d.GetUptime())
+	// Slack for the lists' lengths, which grow as entries are added
+	size := len(resp.Encode()) + 16
+	next := func(iid *types.CompleteCodableValue) (types.IdValuePair, *packet.ErrorEntry) {
+		current := iid.Value.(*CodableValues.IID)
+		index := 0
+		if current.FirstIndex != nil {
+			index = *current.FirstIndex
+		}
+		pair, pErr := d.Next(view, current.Structure, current.Object, index)
+		if pErr != 0 {
+			return types.IdValuePair{IID: iid, Value: types.NewCodableNull()}, &packet.ErrorEntry{Code: pErr}
+		}
+		return pair, nil
+	}
+	entries := 0
+	add := func(pair types.IdValuePair, e *packet.ErrorEntry) {
+		resp.AppendEntry(pair)
+		entries++
+		size += resp.EntrySize(pair)
+		if e != nil {
+			resp.AppendError(entries, e.Code)
+			size += resp.ErrorEntrySize(*e)
+		}
+	}
+	for _, idValuePair := range requested[:nonRepeaters] {
+		add(next(idValuePair.IID))
+	}
+	if size > maxSize {
+		return packet.PacketErr(packet.ErrorTooBig).Compile(r)
+	}
+	columns := make([]*types.CompleteCodableValue, 0)
+	for _, idValuePair := range requested[nonRepeaters:] {
+		columns = append(columns, idValuePair.IID)
+	}
+	ended := make([]bool, len(columns))
+	for rep := 0; rep < maxRepetitions && slices.Contains(ended, false); rep++ {
+		row := make([]types.IdValuePair, len(columns))
+		rowErrors := make([]*packet.ErrorEntry, len(columns))
+		rowSize := 0
+		for j, column := range columns {
+			row[j], rowErrors[j] = next(column)
+			rowSize += resp.EntrySize(row[j])
+			if rowErrors[j] != nil {
+				rowSize += resp.ErrorEntrySize(*rowErrors[j])
+			}
+		}
+		if size+rowSize > maxSize {
+			if rep == 0 {
+				return packet.PacketErr(packet.ErrorTooBig).Compile(r)
+			}
+			break
+		}
+		for j := range columns {
+			add(row[j], rowErrors[j])
+			columns[j] = row[j].IID
+			ended[j] = rowErrors[j] != nil
+		}
+	}
+	return resp, nil, true
 }
 
 func (d *DomoticMIBAgent) HandleResponse(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
@@ -180,16 +395,20 @@ func (d *DomoticMIBAgent) HandleNotification(r packet.LSNMPvS_Packet, addr *net.
 	return nil, nil, false
 }
 
+func (d *DomoticMIBAgent) HandleInform(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
+	return nil, nil, false
+}
+
 func (d *DomoticMIBAgent) RenderMIBWithLipgloss(width int, height int, controls []string, renderLogs bool) string {
-	structures := []mib.StructureI{d.Device, d.Sensors, d.Actuators}
-	title := lipgloss.NewStyle().Align(lipgloss.Center).Render("Domotic MIB Agent - " + d.Name)
+	structures := []mib.StructureI{d.Device, d.Sensors, d.Actuators, d.NotificationTargets}
+	title := lipgloss.NewStyle().Align(lipgloss.Center).Render("Domotic MIB Agent - " + d.GetName())
 	commandsStyle := lipgloss.NewStyle().Align(lipgloss.Center).Foreground(lipgloss.Color("248"))
 	comStr := commandsStyle.Render(strings.Join(controls, " • "))
 	rendered := ""
 	for _, structure := range structures {
 		rendered = lipgloss.JoinVertical(lipgloss.Center, rendered, structure.RenderTableWithLipGloss(width-4))
 	}
-	lines := height - 32
+	lines := height - 32 - (d.NotificationTargets.Count(1) + 4)
 	if renderLogs {
 		rendered = lipgloss.JoinVertical(lipgloss.Left, rendered, d.Logger.RenderLogsWithLipGloss(width-4, lines))
 	}
@@ -199,19 +418,21 @@ func (d *DomoticMIBAgent) RenderMIBWithLipgloss(width int, height int, controls
 func (d *DomoticMIBAgent) RenderPacketsWithLipgloss(width int, height int, controls []string) string {
 	commandsStyle := lipgloss.NewStyle().Align(lipgloss.Center).Foreground(lipgloss.Color("248"))
 	comStr := commandsStyle.Render(strings.Join(controls, " • "))
-	title := lipgloss.NewStyle().Align(lipgloss.Center).Render("Domotic MIB Agent - " + d.Name + " - Packets")
+	title := lipgloss.NewStyle().Align(lipgloss.Center).Render("Domotic MIB Agent - " + d.GetName() + " - Packets" + " - " + d.Fragments.Stats().String())
 	rendered := d.MIB.Packets.RenderPacketsWithLipGloss(width-4, height-4)
 	return lipgloss.JoinVertical(lipgloss.Center, title, lipgloss.NewStyle().Width(width-2).Height(height-4).Align(lipgloss.Bottom).Border(lipgloss.RoundedBorder()).Render(rendered), comStr)
 }
 
-func (d *DomoticMIBAgent) RefreshAgent(addr string) {
+func (d *DomoticMIBAgent) RefreshAgent(addr string, version byte, credentials packet.Credentials) {
 	iidList := types.CodableList{}
-	for i := 1; i <= 3; i++ {
+	for i := 1; i <= len(d.MIB.Structures); i++ {
 		s := d.MIB.Structures[i]
 		for j := 1; j <= s.Len(); j++ {
 			iidList.Add(i, types.NewCodableIID(i, j, []int{0}))
 		}
 	}
 	p := packet.NewGetRequestPacket(iidList)
-	netfuncs.SendStrAddr(addr, []byte(p.Encode()))
+	p.SetVersion(version)
+	p.SetCredentials(credentials)
+	netfuncs.SendStrAddr(d.Transport, addr, p.EncodeFrames()...)
 }
\ No newline at end of file
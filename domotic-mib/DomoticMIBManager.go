@@ -1,6 +1,8 @@
 package domoticmib
 
 import (
+	"errors"
+	"fmt"
 	"net"
 	"strings"
 	"sync"
@@ -18,17 +20,58 @@ import (
 )
 
 type RemoteAgent struct {
-	MIB        *DomoticMIBAgent
-	Address    string
-	LastUpdate time.Time
+	MIB         *DomoticMIBAgent
+	Address     string
+	// udpAddr is Address resolved, nil when it couldn't be
+	udpAddr     *net.UDPAddr
+	// version is the wire format used with the agent and lastUpdate when it
+	// was last heard from, both changed by the listener while requests are
+	// sent and the UI is drawn, so they're guarded by lock
+	version     byte
+	lastUpdate  time.Time
+	lock        sync.Mutex
+	Credentials packet.Credentials
+}
+
+func (r *RemoteAgent) Refresh() {
+	r.MIB.RefreshAgent(r.Address, r.GetVersion(), r.Credentials)
+}
+
+// prepare makes p ready to be sent to the agent.
+func (r *RemoteAgent) prepare(p *packet.LSNMPvS_Packet) {
+	p.SetVersion(r.GetVersion())
+	p.SetCredentials(r.Credentials)
+}
+
+func (r *RemoteAgent) GetVersion() byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.version
+}
+
+func (r *RemoteAgent) UpdateVersion(p packet.LSNMPvS_Packet) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.version = packet.NegotiateVersion(packet.GetDefaultVersion(), p.GetVersion())
+}
+
+func (r *RemoteAgent) GetLastUpdate() time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.lastUpdate
+}
+
+func (r *RemoteAgent) touch() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.lastUpdate = time.Now()
 }
 
 func (r *RemoteAgent) GetAsItem() Item {
-	r.MIB.UpdateName()
 	return Item{
-		Name:        r.MIB.Name,
+		Name:        r.MIB.GetName(),
 		IP:          r.Address,
-		LastUpdated: r.LastUpdate,
+		LastUpdated: r.GetLastUpdate(),
 	}
 }
 
@@ -38,6 +81,7 @@ type DomoticMIBManager struct {
 	RemoteAgentsOrdered []string
 	RemoteAgentsLock    *sync.RWMutex
 	Logger              *CustomLogger.CustomLogger
+	ConfigPath          string
 	UiMode              byte
 	CurrentAgentInUI    string
 	HomeList            *list.Model
@@ -48,9 +92,22 @@ type DomoticMIBManager struct {
 	ValueToSet   	  	*types.CompleteCodableValue
 	TextInputToSet 		textinput.Model
 	CurrentInputStage 	byte
+	ConditionalSet    	bool
+	// Credentials used with each agent, by address, and with the others
+	// under ""
+	Credentials         map[string]packet.Credentials
+	// NotificationTransport receives the notifications when they're sent to
+	// another port than responses, it's nil otherwise
+	NotificationTransport netfuncs.Transport
 }
 
 func NewDomoticMIBManager(ymlConfig string) (DomoticMIBManager, error) {
+	return NewDomoticMIBManagerOn(ymlConfig, netfuncs.ListenUDP)
+}
+
+// NewDomoticMIBManagerOn creates the manager configured in ymlConfig
+// listening with listen, like on a netfuncs.MemoryNetwork in tests.
+func NewDomoticMIBManagerOn(ymlConfig string, listen netfuncs.ListenFunc) (DomoticMIBManager, error) {
 	logger := CustomLogger.NewCustomLogger()
 	logger.LogInfo("DomoticMIBManager Created", "StartUP")
 	config, err := LoadMIBManagerConfig(ymlConfig)
@@ -58,12 +115,70 @@ func NewDomoticMIBManager(ymlConfig string) (DomoticMIBManager, error) {
 		logger.LogError(err.Error(), "StartUP")
 		return DomoticMIBManager{}, err
 	}
+	keyring, err := NewKeyringFromConfig(config.Keys)
+	if err != nil {
+		logger.LogError(err.Error(), "StartUP")
+		return DomoticMIBManager{}, err
+	}
+	packet.SetKeyring(keyring)
+	logger.LogInfo(fmt.Sprintf("Keyring Loaded, active key is %q", keyring.ActiveKeyID()), "StartUP")
+	if err := applyProtocolVersion(config.ProtocolVersion); err != nil {
+		logger.LogError(err.Error(), "StartUP")
+		return DomoticMIBManager{}, err
+	}
+	if err := applyLimits(config.Limits); err != nil {
+		logger.LogError(err.Error(), "StartUP")
+		return DomoticMIBManager{}, err
+	}
+	if err := applyCapture(config.Capture, &logger); err != nil {
+		logger.LogError(err.Error(), "StartUP")
+		return DomoticMIBManager{}, err
+	}
+	network, err := NewNetworkFromConfig(config.Network)
+	if err != nil {
+		logger.LogError(err.Error(), "StartUP")
+		return DomoticMIBManager{}, err
+	}
+	// Packets are answered at the address of the agent they came from, which
+	// the handlers look up
+	network.ReplyToSource = true
+	transport, err := network.Listen(listen, network.ResponsePort)
+	if err != nil {
+		logger.LogError(err.Error(), "StartUP")
+		return DomoticMIBManager{}, err
+	}
+	logger.LogInfo("Listening for responses on "+transport.LocalAddr().String(), "StartUP")
+	var notificationTransport netfuncs.Transport
+	if network.NotificationPort != network.ResponsePort {
+		if notificationTransport, err = network.Listen(listen, network.NotificationPort); err != nil {
+			transport.Close()
+			logger.LogError(err.Error(), "StartUP")
+			return DomoticMIBManager{}, err
+		}
+		logger.LogInfo("Listening for notifications on "+notificationTransport.LocalAddr().String(), "StartUP")
+	}
+	if group := network.NotificationGroup; group != nil {
+		joining := transport
+		if notificationTransport != nil {
+			joining = notificationTransport
+		}
+		if err := joining.JoinGroup(group); err != nil {
+			transport.Close()
+			if notificationTransport != nil {
+				notificationTransport.Close()
+			}
+			logger.LogError(err.Error(), "StartUP")
+			return DomoticMIBManager{}, err
+		}
+		logger.LogInfo("Joined notification group "+group.IP.String(), "StartUP")
+	}
 	manager := DomoticMIBManager{
 		MIB:                 mib.NewMIB(&logger, []mib.StructureI{}),
 		RemoteAgents:        make(map[string]*RemoteAgent),
 		RemoteAgentsOrdered: []string{},
 		RemoteAgentsLock:    &sync.RWMutex{},
 		Logger:              &logger,
+		ConfigPath:          ymlConfig,
 		UiMode:              'n',
 		CurrentAgentInUI:    "",
 		HomeList:            NewList([]list.Item{}, logger.GetCommandString(), 0, 10),
@@ -74,35 +189,128 @@ func NewDomoticMIBManager(ymlConfig string) (DomoticMIBManager, error) {
 		TextInputToSet:      NewTextInput(20, "", ""),
 		CurrentInputStage:   0,
 	}
+	manager.Network = network
+	manager.Transport = transport
+	manager.NotificationTransport = notificationTransport
+	manager.Credentials = make(map[string]packet.Credentials)
+	for agent, credentials := range NewCredentialsFromConfig(config.Credentials) {
+		if agent != "" {
+			agent = manager.agentAddress(agent)
+		}
+		manager.Credentials[agent] = credentials
+	}
+	if err := applyReplayWindow(&manager.Packets, config.ReplayWindow); err != nil {
+		transport.Close()
+		if notificationTransport != nil {
+			notificationTransport.Close()
+		}
+		logger.LogError(err.Error(), "StartUP")
+		return DomoticMIBManager{}, err
+	}
 	for _, address := range config.RemoteAgentsAddresses {
 		manager.AddEmptyAgent(address)
 	}
 	return manager, nil
 }
 
-func (m *DomoticMIBManager) AddEmptyAgent(address string) {
+// agentAddress writes address like the address packets from the agent come
+// from, adding the port agents listen on when it has none.
+func (m *DomoticMIBManager) agentAddress(address string) string {
+	address = withDefaultPort(address, m.Network.RequestPort)
+	if udpAddr, err := net.ResolveUDPAddr("udp", address); err == nil {
+		return udpAddr.String()
+	}
+	return address
+}
+
+// AddEmptyAgent starts tracking the agent at address, which listens on the
+// configured RequestPort when address has no port, and returns it.
+func (m *DomoticMIBManager) AddEmptyAgent(address string) *RemoteAgent {
+	address = m.agentAddress(address)
 	m.RemoteAgentsLock.Lock()
 	defer m.RemoteAgentsLock.Unlock()
+	if remAgent, ok := m.RemoteAgents[address]; ok {
+		return remAgent
+	}
 	Device := NewDeviceGroup(DeviceConfig{})
 	Sensors := NewSensorsTable([]SensorConfig{})
 	Actuators := NewActuatorsTable([]ActuatorConfig{})
+	NotificationTargets := NewNotificationTargetsTable([]NotificationTargetConfig{})
 	newMIB := &DomoticMIBAgent{
-		MIB:             mib.NewMIB(m.Logger, []mib.StructureI{Device, Sensors, Actuators}),
-		Device:          Device,
-		Sensors:         Sensors,
-		Actuators:       Actuators,
-		Name:            "",
-		updateFrequency: 5 * time.Second,
-	}
-	m.RemoteAgents[address] = &RemoteAgent{
-		MIB:        newMIB,
-		Address:    address,
-		LastUpdate: time.Now(),
+		MIB:                 mib.NewMIB(m.Logger, []mib.StructureI{Device, Sensors, Actuators, NotificationTargets}),
+		Device:              Device,
+		Sensors:             Sensors,
+		Actuators:           Actuators,
+		NotificationTargets: NotificationTargets,
+		Name:                "",
+		updateFrequency:     5 * time.Second,
 	}
+	newMIB.Transport = m.Transport
+	credentials, ok := m.Credentials[address]
+	if !ok {
+		credentials = m.Credentials[""]
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		m.Logger.LogError(fmt.Sprintf("Error resolving agent %s: %v", address, err), "StartUP")
+	}
+	remAgent := &RemoteAgent{
+		MIB:         newMIB,
+		Address:     address,
+		udpAddr:     udpAddr,
+		lastUpdate:  time.Now(),
+		version:     packet.GetDefaultVersion(),
+		Credentials: credentials,
+	}
+	m.RemoteAgents[address] = remAgent
 	m.RemoteAgentsOrdered = append(m.RemoteAgentsOrdered, address)
+	return remAgent
+}
+
+// agentAt returns the agent a packet from addr came from. Agents may send
+// from other ports than the one they listen on, so when no agent is at addr
+// the only one on its host is picked.
+func (m *DomoticMIBManager) agentAt(addr *net.UDPAddr) (*RemoteAgent, bool) {
+	m.RemoteAgentsLock.RLock()
+	defer m.RemoteAgentsLock.RUnlock()
+	if remAgent, ok := m.RemoteAgents[addr.String()]; ok {
+		return remAgent, true
+	}
+	var found *RemoteAgent
+	for _, remAgent := range m.RemoteAgents {
+		if remAgent.udpAddr == nil || !remAgent.udpAddr.IP.Equal(addr.IP) {
+			continue
+		}
+		if found != nil {
+			return nil, false
+		}
+		found = remAgent
+	}
+	return found, found != nil
+}
+
+// agent returns the agent at address, nil if it isn't tracked.
+func (m *DomoticMIBManager) agent(address string) *RemoteAgent {
+	m.RemoteAgentsLock.RLock()
+	defer m.RemoteAgentsLock.RUnlock()
+	return m.RemoteAgents[address]
+}
+
+// agents returns every tracked agent, in the order they were added.
+func (m *DomoticMIBManager) agents() []*RemoteAgent {
+	m.RemoteAgentsLock.RLock()
+	defer m.RemoteAgentsLock.RUnlock()
+	agents := make([]*RemoteAgent, 0, len(m.RemoteAgentsOrdered))
+	for _, address := range m.RemoteAgentsOrdered {
+		agents = append(agents, m.RemoteAgents[address])
+	}
+	return agents
 }
 
 func (m *DomoticMIBManager) StartManager(sub chan struct{}) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go WatchKeyring(m.ConfigPath, loadManagerKeys, m.Logger, stop)
 	m.StartManagerUpdater(sub)
 	m.ListenForRequests(sub)
 }
@@ -110,8 +318,8 @@ func (m *DomoticMIBManager) StartManager(sub chan struct{}) {
 func (m *DomoticMIBManager) StartManagerUpdater(sub chan struct{}) {
 	go func() {
 		for {
-			for addr, agent := range m.RemoteAgents {
-				agent.MIB.RefreshAgent(addr)
+			for _, agent := range m.agents() {
+				agent.Refresh()
 			}
 			sub <- struct{}{}
 			time.Sleep(m.UpdateFrequency)
@@ -119,22 +327,43 @@ func (m *DomoticMIBManager) StartManagerUpdater(sub chan struct{}) {
 	}()
 }
 
+// ListenForRequests receives the responses and notifications of the agents,
+// on two sockets when they're sent to different ports.
 func (d *DomoticMIBManager) ListenForRequests(sub chan struct{}) {
-	addr := &net.UDPAddr{
-		IP:   net.ParseIP("0.0.0.0"),
-		Port: 12345,
+	if d.NotificationTransport != nil {
+		go d.listen(d.NotificationTransport, sub)
 	}
-	udpListener, _ := net.ListenUDP("udp", addr)
+	d.listen(d.Transport, sub)
+}
+
+func (d *DomoticMIBManager) listen(t netfuncs.Transport, sub chan struct{}) {
 	for {
-		buffer := make([]byte, 10000)
-		n, addr, _ := udpListener.ReadFromUDP(buffer)
+		buffer := make([]byte, packet.MaxPacketSize)
+		n, addr, err := t.Receive(buffer)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			d.Logger.LogError("Error receiving packet: "+err.Error(), "Request")
+			continue
+		}
+		frame, complete, err := d.Fragments.Add(addr.String(), buffer[:n])
+		if err == nil && !complete {
+			continue
+		}
 		newPacket := packet.LSNMPvS_Packet{}
-		_, e := newPacket.Decode(string(buffer[:n]))
-		if e != 0 {
+		if err == nil {
+			_, err = newPacket.Decode(frame)
+		}
+		if err != nil && !packet.Authenticated(err) {
+			d.Logger.LogError(err.Error(), "Request")
+			continue
+		}
+		if err != nil {
 			go func() {
-				errPacket := packet.NewErrorDecodingPacket(e)
-				netfuncs.Send(addr, []byte(errPacket.Encode()))
-				d.Logger.LogError(e.Error(), "Request")
+				errPacket := packet.NewErrorDecodingPacket(packet.DecodeErrorCode(err))
+				t.Send(addr, []byte(errPacket.Encode()))
+				d.Logger.LogError(err.Error(), "Request")
 			}()
 			continue
 		}
@@ -143,11 +372,9 @@ func (d *DomoticMIBManager) ListenForRequests(sub chan struct{}) {
 }
 
 func (m *DomoticMIBManager) GetList() []list.Item {
-	m.RemoteAgentsLock.RLock()
-	defer m.RemoteAgentsLock.RUnlock()
 	items := make([]list.Item, 0)
-	for _, agent := range m.RemoteAgentsOrdered {
-		items = append(items, m.RemoteAgents[agent].GetAsItem())
+	for _, agent := range m.agents() {
+		items = append(items, agent.GetAsItem())
 	}
 	return items
 }
@@ -160,46 +387,156 @@ func (m *DomoticMIBManager) HandleSet(r packet.LSNMPvS_Packet, addr *net.UDPAddr
 	return nil, nil, false
 }
 
+func (m *DomoticMIBManager) HandleGetNext(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
+	return nil, nil, false
+}
+
+func (m *DomoticMIBManager) HandleGetBulk(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
+	return nil, nil, false
+}
+
 func (m *DomoticMIBManager) HandleResponse(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
-	if !r.TryLogErrors(m.Logger) {
-		addr.Port = 12345
-		remAgent := m.RemoteAgents[addr.String()]
-		remAgent.LastUpdate = time.Now()
-		p, err, respond := remAgent.MIB.Update(r)
-		remAgent.MIB.UpdateName()
-		return p, err, respond
-	} else {
-		return nil, nil, false	
+	remAgent, ok := m.agentAt(addr)
+	if !ok {
+		return nil, fmt.Errorf("response from unknown agent %s", addr.String()), false
+	}
+	if remAgent.udpAddr != nil {
+		*addr = *remAgent.udpAddr
+	}
+	remAgent.UpdateVersion(r)
+	r.TryLogErrors(m.Logger)
+	if r.HasPacketError() {
+		return nil, nil, false
 	}
+	remAgent.touch()
+	p, err, respond := remAgent.MIB.Update(r)
+	if respond {
+		remAgent.prepare(p)
+	}
+	if respond && p.GetType() == 'B' {
+		m.FetchRows(remAgent, p)
+		return nil, err, false
+	}
+	return p, err, respond
+}
+
+// FetchRows sends the GetBulk request r to the remote agent in the
+// background, following up on the rows that don't fit in a single response.
+func (m *DomoticMIBManager) FetchRows(remAgent *RemoteAgent, r *packet.LSNMPvS_Packet) {
+	go func() {
+		pairs, err := m.MIB.GetBulk(remAgent.Address, r)
+		if err != nil {
+			m.Logger.LogError(fmt.Sprintf("GetBulk to %s stopped after %d objects: %v", remAgent.Address, len(pairs), err), "Request")
+			return
+		}
+		m.Logger.LogDebug(fmt.Sprintf("GetBulk to %s returned %d objects", remAgent.Address, len(pairs)), "Request")
+	}()
 }
 
 func (m *DomoticMIBManager) HandleNotification(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
-	addr.Port = 12345
-	addrStr := addr.String()
-	remAgent, ok := m.RemoteAgents[addrStr]
+	remAgent, ok := m.agentAt(addr)
 	if !ok {
-		m.AddEmptyAgent(addrStr)
-		remAgent = m.RemoteAgents[addrStr]
-		remAgent.MIB.RefreshAgent(addrStr)
+		remAgent = m.AddEmptyAgent((&net.UDPAddr{IP: addr.IP, Port: m.Network.RequestPort, Zone: addr.Zone}).String())
+	}
+	if remAgent.udpAddr != nil {
+		*addr = *remAgent.udpAddr
+	}
+	remAgent.UpdateVersion(r)
+	if !ok {
+		remAgent.Refresh()
 	}
 	p, err, respond := remAgent.MIB.Update(r)
-	remAgent.LastUpdate = time.Now()
-	remAgent.MIB.UpdateName()
+	remAgent.touch()
+	if respond {
+		remAgent.prepare(p)
+	}
 	return p, err, respond
 }
 
+// HandleInform updates the agent like a notification would and acknowledges
+// the inform with an empty response carrying its message id.
+func (m *DomoticMIBManager) HandleInform(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
+	p, err, respond := m.HandleNotification(r, addr)
+	if respond {
+		if sendErr := m.Transport.Send(addr, p.EncodeFrames()...); sendErr != nil {
+			m.Logger.LogError("Error sending request to "+addr.String()+": "+sendErr.Error(), "Request")
+		}
+	}
+	return r.NewResponsePacket(nil, m.GetUptime()), err, true
+}
+
 func (m *DomoticMIBManager) RefreshCurrentAgent() {
-	remAgent := m.RemoteAgents[m.CurrentAgentInUI]
-	remAgent.MIB.RefreshAgent(remAgent.Address)
+	remAgent := m.agent(m.CurrentAgentInUI)
+	remAgent.Refresh()
 }
 
+// WalkCurrentAgent discovers every object of the agent being inspected. Its
+// responses update the local copy of the agent's MIB as they arrive.
+func (m *DomoticMIBManager) WalkCurrentAgent() {
+	remAgent := m.agent(m.CurrentAgentInUI)
+	go func() {
+		pairs, err := m.MIB.Walk(remAgent.Address, remAgent.prepare, 0)
+		if err != nil {
+			m.Logger.LogError(fmt.Sprintf("Walk of %s stopped after %d objects: %v", remAgent.Address, len(pairs), err), "Walk")
+			return
+		}
+		m.Logger.LogInfo(fmt.Sprintf("Walk of %s found %d objects", remAgent.Address, len(pairs)), "Walk")
+	}()
+}
+
+// ParseValueToSet reads the value typed for a Set request, using the type of
+// the value last seen for the object being set.
+func (m *DomoticMIBManager) ParseValueToSet(text string) error {
+	value, err := types.ParseCodableValue(m.valueToSetTemplate(), text)
+	if err != nil {
+		return err
+	}
+	m.ValueToSet = value
+	return nil
+}
+
+// valueToSetTemplate returns the value last seen for the object being set, or
+// an integer if it's unknown.
+func (m *DomoticMIBManager) valueToSetTemplate() *types.CompleteCodableValue {
+	if template := m.knownValueToSet(); template != nil {
+		return template
+	}
+	return types.NewCodableInt(0)
+}
+
+// knownValueToSet returns the value last seen for the object being set, or nil
+// if it's unknown.
+func (m *DomoticMIBManager) knownValueToSet() *types.CompleteCodableValue {
+	remAgent := m.agent(m.CurrentAgentInUI)
+	if s, ok := remAgent.MIB.Structures[m.IIDToSet.Structure]; ok && m.IIDToSet.FirstIndex != nil {
+		index := *m.IIDToSet.FirstIndex - 1
+		if index >= 0 && index < s.Count(m.IIDToSet.Object) {
+			if current, pErr := s.Get(m.IIDToSet.Object, index); pErr == 0 {
+				return current
+			}
+		}
+	}
+	return nil
+}
+
+// SendSetRequest sends the value typed to the current agent. With
+// ConditionalSet it's only applied if the agent still has the value last seen
+// by the manager, so a change made by another manager isn't overwritten.
 func (m *DomoticMIBManager) SendSetRequest() {
 	iidCodableList := types.CodableList{}
 	iidCodableList.Append(types.NewCodableIID(m.IIDToSet.Structure, m.IIDToSet.Object, []int{*m.IIDToSet.FirstIndex}))
 	valueCodableList := types.CodableList{}
 	valueCodableList.Append(m.ValueToSet)
-	p := packet.NewSetResponsePacket(iidCodableList, valueCodableList)
-	netfuncs.SendStrAddr(m.CurrentAgentInUI, []byte(p.Encode()))
+	var p *packet.LSNMPvS_Packet
+	if m.ConditionalSet {
+		conditionCodableList := types.CodableList{}
+		conditionCodableList.Append(m.knownValueToSet())
+		p = packet.NewConditionalSetRequestPacket(iidCodableList, valueCodableList, conditionCodableList)
+	} else {
+		p = packet.NewSetResponsePacket(iidCodableList, valueCodableList)
+	}
+	m.agent(m.CurrentAgentInUI).prepare(p)
+	netfuncs.SendStrAddr(m.Transport, m.CurrentAgentInUI, p.EncodeFrames()...)
 }
 
 func (m *DomoticMIBManager) Render(width, height int) string {
@@ -222,7 +559,7 @@ func (m *DomoticMIBManager) Render(width, height int) string {
 		return m.RenderPacketsWithLipgloss(width, height, []string{"q: Exit", "n: Back"})
 	case 's':
 		var commands []string
-		renderedMIB := m.RemoteAgents[m.CurrentAgentInUI].MIB.RenderMIBWithLipgloss(width, height, []string{}, false)
+		renderedMIB := m.agent(m.CurrentAgentInUI).MIB.RenderMIBWithLipgloss(width, height, []string{}, false)
 		if m.WritingSetRequest {
 			commands = []string{"Enter: Confirm", "Esc: Cancel"}
 			title := ""
@@ -234,12 +571,16 @@ func (m *DomoticMIBManager) Render(width, height int) string {
 			case 3:
 				title = "Enter Index"
 			case 4:
-				title = "Enter Value"
+				title = "Enter Value (" + types.InputFormat(m.valueToSetTemplate()) + ")"
 			}
 			StructTitle := lipgloss.NewStyle().Foreground(lipgloss.Color("208")).Width(width).Align(lipgloss.Center).Border(lipgloss.NormalBorder(), false, false, true).BorderForeground(lipgloss.Color("208")).Render(title)
 			renderedMIB = lipgloss.JoinVertical(lipgloss.Center, renderedMIB, StructTitle, lipgloss.NewStyle().Padding(0,1).Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("208")).Render(m.TextInputToSet.View()))
 			} else {
-			commands = []string{"q: Exit", "n: Back", "s: Set Value", "r: Refresh"}
+			conditional := "off"
+			if m.ConditionalSet {
+				conditional = "on"
+			}
+			commands = []string{"q: Exit", "n: Back", "s: Set Value", "c: Conditional Set (" + conditional + ")", "r: Refresh", "w: Walk"}
 		}
 		renderedCommands := lipgloss.NewStyle().Align(lipgloss.Center).Foreground(lipgloss.Color("248")).Render(strings.Join(commands, " • "))
 		return lipgloss.JoinVertical(lipgloss.Center, renderedMIB, renderedCommands)
@@ -251,7 +592,7 @@ func (m *DomoticMIBManager) Render(width, height int) string {
 func (d *DomoticMIBManager) RenderPacketsWithLipgloss(width int, height int, controls []string) string {
 	commandsStyle := lipgloss.NewStyle().Align(lipgloss.Center).Foreground(lipgloss.Color("248"))
 	comStr := commandsStyle.Render(strings.Join(controls, " • "))
-	title := lipgloss.NewStyle().Align(lipgloss.Center).Render("Domotic MIB Manager - Packets")
+	title := lipgloss.NewStyle().Align(lipgloss.Center).Render("Domotic MIB Manager - Packets" + " - " + d.Fragments.Stats().String())
 	rendered := d.MIB.Packets.RenderPacketsWithLipGloss(width-4, height-4)
 	return lipgloss.JoinVertical(lipgloss.Center, title, lipgloss.NewStyle().Width(width-2).Height(height-4).Align(lipgloss.Bottom).Border(lipgloss.RoundedBorder()).Render(rendered), comStr)
 }
@@ -0,0 +1,383 @@
+package domoticmib
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	netfuncs "github.com/eivarin/LSNMPvS-DomoticSystem/NetFuncs"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+)
+
+const testAgentConfig = `device:
+  ID: %q
+  Type: "Lights"
+  nActuators: 1
+actuators:
+  - ID: "Light"
+    Type: "Light"
+    Status: 1
+    MinValue: 0
+    MaxValue: 5
+network:
+  ListenAddress: %q
+%s`
+
+const testManagerConfig = `RemoteAgentsAddresses: ["10.0.0.1", "10.0.0.2"]
+Network:
+  ListenAddress: "10.0.0.10"
+`
+
+func writeTestConfig(t *testing.T, name, config string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func drain(sub chan struct{}) {
+	for range sub {
+	}
+}
+
+func TestReplyToSourceByDefault(t *testing.T) {
+	off := false
+	for _, c := range []struct {
+		replyToSource *bool
+		expected      bool
+	}{{nil, true}, {&off, false}} {
+		network, err := NewNetworkFromConfig(NetworkConfig{ReplyToSource: c.replyToSource})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if network.ReplyToSource != c.expected {
+			t.Errorf("ReplyToSource is %v, expected %v", network.ReplyToSource, c.expected)
+		}
+	}
+}
+
+func TestNotificationGroupPort(t *testing.T) {
+	for group, valid := range map[string]bool{
+		"239.255.12.34":       true,
+		"239.255.12.34:12346": true,
+		"239.255.12.34:12347": false,
+		"[ff02::1234]:12347":  false,
+	} {
+		_, err := NewNetworkFromConfig(NetworkConfig{NotificationPort: 12346, NotificationGroup: group})
+		if valid != (err == nil) {
+			t.Errorf("NotificationGroup %s gave %v", group, err)
+		}
+	}
+}
+
+func TestNotificationHops(t *testing.T) {
+	for hops, valid := range map[int]bool{0: true, 1: true, 255: true, -1: false, 256: false} {
+		network, err := NewNetworkFromConfig(NetworkConfig{NotificationGroup: "239.255.12.34", NotificationHops: hops})
+		if valid != (err == nil) {
+			t.Errorf("NotificationHops %d gave %v", hops, err)
+		} else if valid && network.NotificationHops != hops {
+			t.Errorf("NotificationHops is %d, expected %d", network.NotificationHops, hops)
+		}
+	}
+}
+
+// TestFailedConstructorsCloseTheirSockets checks that devices failing after
+// they bound their sockets leave the addresses free.
+func TestFailedConstructorsCloseTheirSockets(t *testing.T) {
+	network := netfuncs.NewMemoryNetwork()
+	agentConfig := writeTestConfig(t, "agent.yml", fmt.Sprintf(testAgentConfig, "Agent", "10.0.0.1", "replayWindow: -1\n"))
+	if _, err := NewDomoticMIBOn(agentConfig, network.Listen); err == nil {
+		t.Fatal("agent with a negative replay window was created")
+	}
+	managerConfig := writeTestConfig(t, "manager.yml", testManagerConfig+"  NotificationPort: 12346\nReplayWindow: -1\n")
+	if _, err := NewDomoticMIBManagerOn(managerConfig, network.Listen); err == nil {
+		t.Fatal("manager with a negative replay window was created")
+	}
+	for _, addr := range []string{"10.0.0.1:12345", "10.0.0.10:12345", "10.0.0.10:12346"} {
+		transport, err := network.Listen(net.UDPAddrFromAddrPort(netip.MustParseAddrPort(addr)))
+		if err != nil {
+			t.Errorf("%s wasn't closed: %v", addr, err)
+			continue
+		}
+		transport.Close()
+	}
+}
+
+// TestAgentsAndManager wires two agents, both on port 12345 of their own
+// address, and a manager together on a memory network.
+func TestAgentsAndManager(t *testing.T) {
+	network := netfuncs.NewMemoryNetwork()
+	sub := make(chan struct{})
+	go drain(sub)
+	agents := make(map[string]*DomoticMIBAgent)
+	for address, id := range map[string]string{"10.0.0.1": "Kitchen", "10.0.0.2": "Room"} {
+		path := writeTestConfig(t, id+".yml", fmt.Sprintf(testAgentConfig, id, address, ""))
+		agent, err := NewDomoticMIBOn(path, network.Listen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { agent.Transport.Close() })
+		go agent.ListenForRequests(sub)
+		agents[address+":12345"] = &agent
+	}
+	manager, err := NewDomoticMIBManagerOn(writeTestConfig(t, "manager.yml", testManagerConfig), network.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { manager.Transport.Close() })
+	go manager.ListenForRequests(sub)
+
+	for address, agent := range agents {
+		remAgent := manager.agent(address)
+		if remAgent == nil {
+			t.Fatalf("manager doesn't know agent %s, only %v", address, manager.RemoteAgentsOrdered)
+		}
+		iidList := types.CodableList{}
+		iidList.Append(types.NewCodableIID(1, 1, []int{1}))
+		request := packet.NewGetRequestPacket(iidList)
+		remAgent.prepare(request)
+		resp, err := manager.SendRequest(address, request, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pairs := resp.GetIidValuePairList(); len(pairs) != 1 || pairs[0].Value.String() != agent.Name {
+			t.Errorf("%s answered %v, expected its id %s", address, pairs, agent.Name)
+		}
+
+		iidList = types.CodableList{}
+		iidList.Append(types.NewCodableIID(3, 3, []int{1}))
+		valueList := types.CodableList{}
+		valueList.Append(types.NewCodableInt(4))
+		request = packet.NewSetResponsePacket(iidList, valueList)
+		remAgent.prepare(request)
+		resp, err = manager.SendRequest(address, request, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.HasPacketError() {
+			t.Fatalf("set on %s failed with %v", address, resp.GetErrors())
+		}
+		index := 1
+		status, _ := agent.Get(nil, 3, 3, &index)
+		if v := status.Value.Value.(*CodableValues.CodableInt).Value; v != 4 {
+			t.Errorf("status of %s is %d after setting it to 4", address, v)
+		}
+	}
+}
+
+// TestNotificationDelivery sends notifications over IPv6 to a multicast group
+// the manager joined and straight to the manager, which learns of both agents
+// from them.
+func TestNotificationDelivery(t *testing.T) {
+	network := netfuncs.NewMemoryNetwork()
+	sub := make(chan struct{})
+	go drain(sub)
+	manager, err := NewDomoticMIBManagerOn(writeTestConfig(t, "manager.yml", `Network:
+  ListenAddress: "fd00::10"
+  NotificationGroup: "ff02::1234"
+`), network.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { manager.Transport.Close() })
+	go manager.ListenForRequests(sub)
+
+	agents := map[string]string{
+		"[fd00::1]:12345": "  NotificationGroup: \"ff02::1234\"\n",
+		"[fd00::2]:12345": "  NotificationTargets: [\"fd00::10\"]\n",
+	}
+	for address, delivery := range agents {
+		host := address[1:strings.Index(address, "]")]
+		path := writeTestConfig(t, host+".yml", fmt.Sprintf(testAgentConfig, host, host, delivery))
+		agent, err := NewDomoticMIBOn(path, network.Listen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { agent.Transport.Close() })
+		agent.Device.SendNotifications(agent.Transport, agent.NotificationAddrs(agent.Device), agent.GetUptime())
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(manager.GetList()) < len(agents) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	manager.RemoteAgentsLock.RLock()
+	defer manager.RemoteAgentsLock.RUnlock()
+	for address := range agents {
+		if _, ok := manager.RemoteAgents[address]; !ok {
+			t.Errorf("manager didn't get the notification of %s, only knows %v", address, manager.RemoteAgentsOrdered)
+		}
+	}
+}
+
+// TestNotificationTargets has a manager add a target to the notification
+// targets table of an agent, which keeps it after restarting.
+func TestNotificationTargets(t *testing.T) {
+	network := netfuncs.NewMemoryNetwork()
+	sub := make(chan struct{})
+	go drain(sub)
+	path := writeTestConfig(t, "kitchen.yml", fmt.Sprintf(testAgentConfig, "Kitchen", "10.0.0.1", ""))
+	agent, err := NewDomoticMIBOn(path, network.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go agent.ListenForRequests(sub)
+	manager, err := NewDomoticMIBManagerOn(writeTestConfig(t, "manager.yml", testManagerConfig), network.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { manager.Transport.Close() })
+	go manager.ListenForRequests(sub)
+	if addrs := agent.NotificationAddrs(agent.Device); len(addrs) != 1 || !addrs[0].IP.Equal(net.IPv4bcast) {
+		t.Errorf("notifications go to %v without targets, expected a broadcast", addrs)
+	}
+
+	set := func(iids []*types.CompleteCodableValue, values []*types.CompleteCodableValue) packet.LSNMPvS_Packet {
+		t.Helper()
+		iidList, valueList := types.CodableList{}, types.CodableList{}
+		for i := range iids {
+			iidList.Append(iids[i])
+			valueList.Append(values[i])
+		}
+		request := packet.NewSetResponsePacket(iidList, valueList)
+		manager.agent("10.0.0.1:12345").prepare(request)
+		resp, err := manager.SendRequest("10.0.0.1:12345", request, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	resp := set(
+		[]*types.CompleteCodableValue{types.NewCodableIID(4, 1, []int{2}), types.NewCodableIID(4, 3, []int{2})},
+		[]*types.CompleteCodableValue{types.NewCodableString("10.0.0.20"), types.NewCodableBool(true)},
+	)
+	if len(resp.GetErrors()) > 0 {
+		t.Fatalf("adding a target failed with %v", resp.GetErrors())
+	}
+	for _, invalid := range []struct {
+		iid   *types.CompleteCodableValue
+		value *types.CompleteCodableValue
+	}{
+		{types.NewCodableIID(4, 1, []int{1}), types.NewCodableString("not an address!")},
+		{types.NewCodableIID(4, 2, []int{1}), types.NewCodableInt(70000)},
+		{types.NewCodableIID(4, 4, []int{1}), types.NewCodableString("1,x")},
+	} {
+		if resp := set([]*types.CompleteCodableValue{invalid.iid}, []*types.CompleteCodableValue{invalid.value}); len(resp.GetErrors()) == 0 {
+			t.Errorf("setting %v to %v succeeded", invalid.iid, invalid.value)
+		}
+	}
+	if addrs := agent.NotificationAddrs(agent.Device); len(addrs) != 1 || addrs[0].String() != "10.0.0.20:12345" {
+		t.Errorf("notifications go to %v, expected the target", addrs)
+	}
+
+	target, err := network.Listen(&net.UDPAddr{IP: net.ParseIP("10.0.0.20"), Port: 12345})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { target.Close() })
+	agent.Device.SendNotifications(agent.Transport, agent.NotificationAddrs(agent.Device), agent.GetUptime())
+	if _, from, err := target.Receive(make([]byte, packet.MaxPacketSize)); err != nil || from.String() != "10.0.0.1:12345" {
+		t.Errorf("target received from %v with error %v, expected the notification of the agent", from, err)
+	}
+
+	// Only the notifications of group 5 go there now
+	set([]*types.CompleteCodableValue{types.NewCodableIID(4, 4, []int{2})}, []*types.CompleteCodableValue{types.NewCodableString("5")})
+	agent.Transport.Close()
+	restarted, err := NewDomoticMIBOn(path, network.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { restarted.Transport.Close() })
+	saved := restarted.NotificationTargets.Objects[1].(NotificationTargetsEntry).Config()
+	if expected := (NotificationTargetConfig{Address: "10.0.0.20", Enabled: true, Groups: "5"}); saved != expected {
+		t.Errorf("restarted with target %+v, expected %+v", saved, expected)
+	}
+	if count := restarted.NotificationTargets.Count(1); count != maxNotificationTargets {
+		t.Errorf("restarted with %d targets, expected %d", count, maxNotificationTargets)
+	}
+	if addrs := restarted.NotificationAddrs(restarted.Device); len(addrs) != 0 {
+		t.Errorf("notifications of the device go to %v, expected none", addrs)
+	}
+}
+
+// TestNotificationTargetRows checks that managers take and free the fixed
+// rows of the notification targets table through their address.
+func TestNotificationTargetRows(t *testing.T) {
+	path := writeTestConfig(t, "kitchen.yml", fmt.Sprintf(testAgentConfig, "Kitchen", "10.0.0.1", ""))
+	agent, err := NewDomoticMIBOn(path, netfuncs.NewMemoryNetwork().Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { agent.Transport.Close() })
+	set := func(index int, address string) []packet.ErrorEntry {
+		t.Helper()
+		iidList, valueList := types.CodableList{}, types.CodableList{}
+		iidList.Append(types.NewCodableIID(4, 1, []int{index}))
+		valueList.Append(types.NewCodableString(address))
+		iidList.Append(types.NewCodableIID(4, 3, []int{index}))
+		valueList.Append(types.NewCodableBool(true))
+		resp, _, _ := agent.HandleSet(*packet.NewSetResponsePacket(iidList, valueList), nil)
+		return resp.GetErrors()
+	}
+	if errs := set(maxNotificationTargets+1, "10.0.0.20"); len(errs) == 0 || errs[0].Code != packet.ErrorIndexOutOfRange {
+		t.Errorf("creating a row after the last one returned %v, expected it out of range", errs)
+	}
+	if errs := set(3, "10.0.0.20"); len(errs) > 0 {
+		t.Fatalf("taking a free row failed with %v", errs)
+	}
+	if addrs := agent.NotificationAddrs(agent.Device); len(addrs) != 1 || addrs[0].String() != "10.0.0.20:12345" {
+		t.Errorf("notifications go to %v, expected the target", addrs)
+	}
+	if errs := set(3, ""); len(errs) > 0 {
+		t.Fatalf("freeing the row failed with %v", errs)
+	}
+	if addrs := agent.NotificationAddrs(agent.Device); len(addrs) != 1 || !addrs[0].IP.Equal(net.IPv4bcast) {
+		t.Errorf("notifications go to %v after freeing the row, expected a broadcast", addrs)
+	}
+	if count := agent.NotificationTargets.Count(1); count != maxNotificationTargets {
+		t.Errorf("table has %d rows, expected %d", count, maxNotificationTargets)
+	}
+}
+
+// TestConcurrentTargetSets checks that the targets saved after concurrent
+// Sets are the ones the table ends with.
+func TestConcurrentTargetSets(t *testing.T) {
+	path := writeTestConfig(t, "kitchen.yml", fmt.Sprintf(testAgentConfig, "Kitchen", "10.0.0.1", ""))
+	agent, err := NewDomoticMIBOn(path, netfuncs.NewMemoryNetwork().Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { agent.Transport.Close() })
+	var wg sync.WaitGroup
+	for i := 1; i <= maxNotificationTargets; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			iidList, valueList := types.CodableList{}, types.CodableList{}
+			iidList.Append(types.NewCodableIID(4, 1, []int{i}))
+			valueList.Append(types.NewCodableString(fmt.Sprintf("10.0.0.%d", 20+i)))
+			if resp, _, _ := agent.HandleSet(*packet.NewSetResponsePacket(iidList, valueList), nil); len(resp.GetErrors()) > 0 {
+				t.Errorf("setting target %d failed with %v", i, resp.GetErrors())
+			}
+		}()
+	}
+	wg.Wait()
+	saved, err := loadNotificationTargets(agent.notificationTargetsFile, NetworkConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, entry := range agent.NotificationTargets.Objects {
+		if c := entry.(NotificationTargetsEntry).Config(); saved[i] != c {
+			t.Errorf("saved target %d is %+v, expected %+v", i+1, saved[i], c)
+		}
+	}
+}
@@ -26,14 +26,24 @@ func (a ActuatorsEntry) Set(objectIID int, value types.CompleteCodableValue) pac
 	return res
 }
 
+func (a ActuatorsEntry) LastChange() *types.CompleteCodableValue {
+	value, _ := a.TableEntry.Get(a.LastControlTime.ObjectIID)
+	return value
+}
+
 func (a ActuatorsEntry) CheckNewValueValidity(value types.CompleteCodableValue) packet.PacketErr {
-	var valToCheck, maxValue, minValue int
-	if value.DataType != 'I'{
+	status, _ := a.TableEntry.Get(a.Status.ObjectIID)
+	if value.DataType != status.DataType {
+		return packet.ErrorInvalidDataType
+	}
+	valToCheck, ok := numericValue(&value)
+	if !ok {
 		return packet.ErrorInvalidDataType
 	}
-	valToCheck = value.Value.(*CodableValues.CodableInt).Value
-	maxValue = a.MaxValue.Value.Value.(*CodableValues.CodableInt).Value
-	minValue = a.MinValue.Value.Value.(*CodableValues.CodableInt).Value
+	maxCodable, _ := a.TableEntry.Get(a.MaxValue.ObjectIID)
+	minCodable, _ := a.TableEntry.Get(a.MinValue.ObjectIID)
+	maxValue, _ := numericValue(maxCodable)
+	minValue, _ := numericValue(minCodable)
 	if valToCheck > maxValue || valToCheck < minValue {
 		return packet.ErrorValueOutOfRange
 	}
@@ -57,21 +67,25 @@ func (a ActuatorsEntry) GetTableEntry() mib.TableEntry {
 	return a.TableEntry
 }
 
+// ActuatorConfig declares an actuator whose status, minValue and maxValue are
+// of ValueType, one of "int", "decimal" with Scale decimal places or "bool".
 type ActuatorConfig struct {
-	ID       string `yaml:"ID"`
-	Type     string `yaml:"Type"`
-	Status   int    `yaml:"Status"`
-	MinValue int    `yaml:"MinValue"`
-	MaxValue int    `yaml:"MaxValue"`
+	ID        string  `yaml:"ID"`
+	Type      string  `yaml:"Type"`
+	ValueType string  `yaml:"ValueType"`
+	Scale     int     `yaml:"Scale"`
+	Status    float64 `yaml:"Status"`
+	MinValue  float64 `yaml:"MinValue"`
+	MaxValue  float64 `yaml:"MaxValue"`
 }
 
 func NewActuatorsEntry(c ActuatorConfig) ActuatorsEntry {
 	entry := ActuatorsEntry{
 		Id:              mib.NewObject("id", 1, "Tag identifying the actuator (the MacAddress, for example).", false, *types.NewCodableString(c.ID)),
 		ActuatorType:    mib.NewObject("actuatorType", 2, "Text description for the type of actuator (“Temperature”, for example).", false, *types.NewCodableString(c.Type)),
-		Status:          mib.NewObject("status", 3, "Configuration value set for the actuator (value must be between minValue and maxValue).", true, *types.NewCodableInt(c.Status)),
-		MinValue:        mib.NewObject("minValue", 4, "Minimum value possible for the configuration of the actuator.", false, *types.NewCodableInt(c.MinValue)),
-		MaxValue:        mib.NewObject("maxValue", 5, "Maximum value possible for the configuration of the actuator.", false, *types.NewCodableInt(c.MaxValue)),
+		Status:          mib.NewObject("status", 3, "Configuration value set for the actuator (value must be between minValue and maxValue).", true, *newNumericValue(c.ValueType, c.Scale, c.Status)),
+		MinValue:        mib.NewObject("minValue", 4, "Minimum value possible for the configuration of the actuator.", false, *newNumericValue(c.ValueType, c.Scale, c.MinValue)),
+		MaxValue:        mib.NewObject("maxValue", 5, "Maximum value possible for the configuration of the actuator.", false, *newNumericValue(c.ValueType, c.Scale, c.MaxValue)),
 		LastControlTime: mib.NewObject("lastControlTime", 6, "Date and time when the last configuration/control operation was executed.", false, *types.NewCodableTimestampNow()),
 	}
 	entry.TableEntry = mib.NewTableEntry([]*mib.Object{&entry.Id, &entry.ActuatorType, &entry.Status, &entry.MinValue, &entry.MaxValue, &entry.LastControlTime})
@@ -109,20 +123,20 @@ func NewActuatorsTable(c []ActuatorConfig) *mib.Table {
 // IID 3.2 }
 
 // actuators.status OBJECT {
-// TYPE Integer
+// TYPE Integer, Decimal or Boolean, as declared
 // ACESS read-write
 // DESCRIPTION "Configuration value set for the actuator (value must be between minValue and
 // maxValue)."
 // IID 3.3 }
 
 // actuators.minValue OBJECT {
-// TYPE Integer
+// TYPE The one of status
 // ACESS read-only
 // DESCRIPTION "Minimum value possible for the configuration of the actuator."
 // IID 3.4 }
 
 // actuators.maxValue OBJECT {
-// TYPE Integer
+// TYPE The one of status
 // ACESS read-only
 // DESCRIPTION "Maximum value possible for the configuration of the actuator."
 // IID 3.5 }
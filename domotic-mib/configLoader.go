@@ -1,19 +1,131 @@
 package domoticmib
 
 import (
+	"encoding/hex"
+	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	capture "github.com/eivarin/LSNMPvS-DomoticSystem/Capture"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/CustomLogger"
+	netfuncs "github.com/eivarin/LSNMPvS-DomoticSystem/NetFuncs"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/mib"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet"
 	"gopkg.in/yaml.v2"
 )
 
+const keyringPollInterval = 5 * time.Second
+
 type DomoticMIBAgentConfig struct {
 	Device    DeviceConfig     `yaml:"device"`
 	Sensors   []SensorConfig   `yaml:"sensors"`
 	Actuators []ActuatorConfig `yaml:"actuators"`
+	Keys      []KeyConfig      `yaml:"keys"`
+	// ProtocolVersion is the wire format used for notifications, responses
+	// always use the version of the request. Defaults to the newest one.
+	ProtocolVersion byte `yaml:"protocolVersion"`
+	// ReplayWindow is how many seconds the timestamp of a request may be away
+	// from the agent's clock before it's rejected as a replay.
+	ReplayWindow int `yaml:"replayWindow"`
+	// Access lists the managers allowed in. Without any every request is
+	// accepted.
+	Access []AccessConfig `yaml:"access"`
+	Views  []ViewConfig   `yaml:"views"`
+	Limits LimitsConfig   `yaml:"limits"`
+	// Capture is the file every datagram sent and received is written to, to
+	// be read with lsnmpdump. Nothing is captured when it's empty.
+	Capture string `yaml:"capture"`
+	Network NetworkConfig `yaml:"network"`
+	// NotificationTargetsFile is where the notification targets table is
+	// saved whenever it's set, the config path with a .targets.yml extension
+	// when it's empty.
+	NotificationTargetsFile string `yaml:"notificationTargetsFile"`
 }
 
 type DomoticMIBManagerConfig struct {
 	RemoteAgentsAddresses	 []string `yaml:"RemoteAgentsAddresses"`
+	Keys                     []KeyConfig `yaml:"Keys"`
+	// ProtocolVersion is the highest wire format used when talking to agents,
+	// each agent is then downgraded to the version it answers with.
+	ProtocolVersion          byte        `yaml:"ProtocolVersion"`
+	// ReplayWindow is how many seconds the timestamp of a packet may be away
+	// from the manager's clock before it's rejected as a replay.
+	ReplayWindow             int         `yaml:"ReplayWindow"`
+	Credentials              []CredentialsConfig `yaml:"Credentials"`
+	Limits                   LimitsConfig        `yaml:"Limits"`
+	Capture                  string              `yaml:"Capture"`
+	Network                  NetworkConfig       `yaml:"Network"`
+}
+
+// LimitsConfig bounds the packets a device accepts and the responses it sends.
+// Limits left out keep their defaults.
+type LimitsConfig struct {
+	MaxListLength   int `yaml:"MaxListLength"`
+	MaxExpandedIIDs int `yaml:"MaxExpandedIIDs"`
+	MaxStringLength int `yaml:"MaxStringLength"`
+	MaxResponseSize int `yaml:"MaxResponseSize"`
+}
+
+// NetworkConfig is the mib.Network of a device, any port left out being 12345
+// and ReplyToSource being on unless set to false. Managers send requests to
+// RequestPort when an agent's address has no port of its own.
+type NetworkConfig struct {
+	ListenAddress    string `yaml:"ListenAddress"`
+	RequestPort      int    `yaml:"RequestPort"`
+	ResponsePort     int    `yaml:"ResponsePort"`
+	NotificationPort int    `yaml:"NotificationPort"`
+	ReplyToSource    *bool  `yaml:"ReplyToSource"`
+	// NotificationGroup is the multicast group, like "239.255.12.34" or
+	// "ff02::1234%eth0", agents send notifications to instead of broadcasting
+	// them and managers join. Its port, when given, must be NotificationPort.
+	NotificationGroup string `yaml:"NotificationGroup"`
+	// NotificationHops is how many routers notifications sent to the
+	// NotificationGroup can cross, the system default of 1 when left out.
+	NotificationHops int `yaml:"NotificationHops"`
+	// NotificationTargets are the managers agents start sending notifications
+	// to instead, like "10.0.0.10" or "[fd00::10]:12346", at NotificationPort
+	// when they have no port. They fill the notification targets table until
+	// it's saved, managers changing it afterwards.
+	NotificationTargets []string `yaml:"NotificationTargets"`
+}
+
+// AccessConfig lets in whoever shows User and Secret. Access is "read" to
+// allow only Get requests or "write" to allow Sets too, and View names the
+// view limiting the objects they see, which are all of them when it's empty.
+type AccessConfig struct {
+	User   string `yaml:"User"`
+	Secret string `yaml:"Secret"`
+	Access string `yaml:"Access"`
+	View   string `yaml:"View"`
+}
+
+// ViewConfig includes and excludes subtrees of IIDs written like "2" for a
+// whole structure, "1.10" for an object or "3.3.1" for a single index.
+type ViewConfig struct {
+	Name    string   `yaml:"Name"`
+	Include []string `yaml:"Include"`
+	Exclude []string `yaml:"Exclude"`
+}
+
+// CredentialsConfig are the credentials used with the agent at Agent, written
+// like in RemoteAgentsAddresses, or with any agent without its own ones when
+// Agent is empty.
+type CredentialsConfig struct {
+	Agent  string `yaml:"Agent"`
+	User   string `yaml:"User"`
+	Secret string `yaml:"Secret"`
+}
+
+// KeyConfig describes one pre-shared key. Key is the hex encoding of a 16, 24
+// or 32 byte AES key, and exactly one key must be marked Active when more than
+// one is configured.
+type KeyConfig struct {
+	ID     string `yaml:"ID"`
+	Key    string `yaml:"Key"`
+	Active bool   `yaml:"Active"`
 }
 
 
@@ -41,4 +153,260 @@ func LoadMIBManagerConfig(ymlConfigPath string) (DomoticMIBManagerConfig, error)
 		return DomoticMIBManagerConfig{}, err
 	}
 	return config, nil
-}
\ No newline at end of file
+}
+
+func applyProtocolVersion(version byte) error {
+	if version == 0 {
+		return nil
+	}
+	return packet.SetDefaultVersion(version)
+}
+
+func applyLimits(config LimitsConfig) error {
+	l := packet.Limits(config)
+	if l.MaxListLength < 0 || l.MaxExpandedIIDs < 0 || l.MaxStringLength < 0 || l.MaxResponseSize < 0 {
+		return fmt.Errorf("invalid limits %+v", config)
+	}
+	packet.SetLimits(l)
+	return nil
+}
+
+func NewNetworkFromConfig(config NetworkConfig) (mib.Network, error) {
+	n := mib.DefaultNetwork()
+	n.ListenAddress = config.ListenAddress
+	if config.ReplyToSource != nil {
+		n.ReplyToSource = *config.ReplyToSource
+	}
+	for _, port := range []struct {
+		name  string
+		value int
+		field *int
+	}{
+		{"RequestPort", config.RequestPort, &n.RequestPort},
+		{"ResponsePort", config.ResponsePort, &n.ResponsePort},
+		{"NotificationPort", config.NotificationPort, &n.NotificationPort},
+	} {
+		if port.value < 0 || port.value > 65535 {
+			return mib.Network{}, fmt.Errorf("invalid %s %d", port.name, port.value)
+		}
+		if port.value != 0 {
+			*port.field = port.value
+		}
+	}
+	if config.NotificationGroup != "" {
+		group, err := net.ResolveUDPAddr("udp", withDefaultPort(config.NotificationGroup, n.NotificationPort))
+		if err != nil {
+			return mib.Network{}, err
+		}
+		if !group.IP.IsMulticast() {
+			return mib.Network{}, fmt.Errorf("NotificationGroup %s isn't a multicast address", config.NotificationGroup)
+		}
+		// Managers join the group on the socket bound to NotificationPort, so
+		// notifications sent to another port would never reach them
+		if group.Port != n.NotificationPort {
+			return mib.Network{}, fmt.Errorf("NotificationGroup %s has another port than NotificationPort %d", config.NotificationGroup, n.NotificationPort)
+		}
+		n.NotificationGroup = group
+	}
+	if config.NotificationHops < 0 || config.NotificationHops > 255 {
+		return mib.Network{}, fmt.Errorf("invalid NotificationHops %d", config.NotificationHops)
+	}
+	n.NotificationHops = config.NotificationHops
+	return n, nil
+}
+
+// withDefaultPort adds port to address when it has none, address being a
+// host, an IPv6 address with or without brackets or any of them with a port.
+func withDefaultPort(address string, port int) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"), strconv.Itoa(port))
+}
+
+func applyCapture(path string, logger *CustomLogger.CustomLogger) error {
+	if path == "" {
+		return nil
+	}
+	w, err := capture.Create(path)
+	if err != nil {
+		return err
+	}
+	netfuncs.SetCapture(w)
+	logger.LogInfo("Capturing packets to "+path, "StartUP")
+	return nil
+}
+
+func applyReplayWindow(packets *mib.RecPacketList, seconds int) error {
+	if seconds < 0 {
+		return fmt.Errorf("invalid replay window of %d seconds", seconds)
+	}
+	if seconds > 0 {
+		packets.SetReplayWindow(time.Duration(seconds) * time.Second)
+	}
+	return nil
+}
+
+func NewAccessControlFromConfig(access []AccessConfig, views []ViewConfig) (mib.AccessControl, error) {
+	viewsByName := make(map[string]*mib.View)
+	for _, vc := range views {
+		if _, ok := viewsByName[vc.Name]; ok || vc.Name == "" {
+			return nil, fmt.Errorf("view %q is configured more than once", vc.Name)
+		}
+		view, err := NewViewFromConfig(vc)
+		if err != nil {
+			return nil, err
+		}
+		viewsByName[vc.Name] = view
+	}
+	a := make(mib.AccessControl)
+	for _, ac := range access {
+		if _, ok := a[ac.User]; ok {
+			return nil, fmt.Errorf("user %q has access configured more than once", ac.User)
+		}
+		var level mib.AccessLevel
+		switch ac.Access {
+		case "read":
+			level = mib.ReadAccess
+		case "write":
+			level = mib.WriteAccess
+		default:
+			return nil, fmt.Errorf("user %q has unknown access %q", ac.User, ac.Access)
+		}
+		var view *mib.View
+		if ac.View != "" {
+			var ok bool
+			if view, ok = viewsByName[ac.View]; !ok {
+				return nil, fmt.Errorf("user %q has unknown view %q", ac.User, ac.View)
+			}
+		}
+		a[ac.User] = mib.Principal{Secret: ac.Secret, Access: level, View: view}
+	}
+	return a, nil
+}
+
+func NewViewFromConfig(vc ViewConfig) (*mib.View, error) {
+	view := &mib.View{Name: vc.Name}
+	for _, rules := range []struct {
+		subtrees []string
+		include  bool
+	}{{vc.Include, true}, {vc.Exclude, false}} {
+		for _, subtree := range rules.subtrees {
+			parts := strings.Split(subtree, ".")
+			if len(parts) > 3 {
+				return nil, fmt.Errorf("view %q has subtree %q with more than a structure, an object and an index", vc.Name, subtree)
+			}
+			rule := mib.ViewRule{Subtree: make([]int, len(parts)), Include: rules.include}
+			for i, part := range parts {
+				n, err := strconv.Atoi(part)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("view %q has invalid subtree %q", vc.Name, subtree)
+				}
+				rule.Subtree[i] = n
+			}
+			view.Rules = append(view.Rules, rule)
+		}
+	}
+	return view, nil
+}
+
+func NewCredentialsFromConfig(credentials []CredentialsConfig) map[string]packet.Credentials {
+	c := make(map[string]packet.Credentials)
+	for _, cc := range credentials {
+		c[cc.Agent] = packet.Credentials{User: cc.User, Secret: cc.Secret}
+	}
+	return c
+}
+
+func NewKeyringFromConfig(keys []KeyConfig) (*packet.Keyring, error) {
+	if len(keys) == 0 {
+		return packet.NewLegacyKeyring(), nil
+	}
+	k := packet.NewKeyring()
+	activeID := ""
+	for _, kc := range keys {
+		rawKey, err := hex.DecodeString(kc.Key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not valid hex: %w", kc.ID, err)
+		}
+		if err := k.AddKey(kc.ID, rawKey); err != nil {
+			return nil, err
+		}
+		if kc.Active {
+			if activeID != "" {
+				return nil, fmt.Errorf("keys %q and %q are both marked as active", activeID, kc.ID)
+			}
+			activeID = kc.ID
+		}
+	}
+	if activeID == "" {
+		if len(keys) > 1 {
+			return nil, fmt.Errorf("no active key configured")
+		}
+		activeID = keys[0].ID
+	}
+	if err := k.SetActive(activeID); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// WatchKeyring reloads the keys from the yml config whenever the file changes,
+// so keys can be added, activated and retired without restarting the device.
+// It returns once stop is closed.
+func WatchKeyring(ymlConfigPath string, loadKeys func(string) ([]KeyConfig, error), logger *CustomLogger.CustomLogger, stop <-chan struct{}) {
+	lastModTime := time.Time{}
+	if info, err := os.Stat(ymlConfigPath); err == nil {
+		lastModTime = info.ModTime()
+	}
+	ticker := time.NewTicker(keyringPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(ymlConfigPath)
+		if err != nil || !info.ModTime().After(lastModTime) {
+			continue
+		}
+		lastModTime = info.ModTime()
+		keys, err := loadKeys(ymlConfigPath)
+		if err == nil {
+			var k *packet.Keyring
+			k, err = NewKeyringFromConfig(keys)
+			if err == nil {
+				packet.SetKeyring(k)
+				logger.LogInfo(fmt.Sprintf("Keyring reloaded, active key is %q", k.ActiveKeyID()), "Keyring")
+				continue
+			}
+		}
+		logger.LogError("Error reloading keyring: "+err.Error(), "Keyring")
+	}
+}
+
+func loadAgentKeys(ymlConfigPath string) ([]KeyConfig, error) {
+	config, err := LoadMIBAgentConfig(ymlConfigPath)
+	return config.Keys, err
+}
+
+func loadManagerKeys(ymlConfigPath string) ([]KeyConfig, error) {
+	config, err := LoadMIBManagerConfig(ymlConfigPath)
+	return config.Keys, err
+}
+
+// LoadKeyring builds the keyring of an agent config, or of a manager config
+// when it has no keys, for tools that talk to devices using either.
+func LoadKeyring(ymlConfigPath string) (*packet.Keyring, error) {
+	keys, err := loadAgentKeys(ymlConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		if keys, err = loadManagerKeys(ymlConfigPath); err != nil {
+			return nil, err
+		}
+	}
+	return NewKeyringFromConfig(keys)
+}
@@ -21,6 +21,8 @@ type DeviceObjects struct {
 	LastTimeUpdated   *mib.Object
 	OperationalStatus *mib.Object
 	Reset             *mib.Object
+	InformsSent       *mib.Object
+	InformsUnacked    *mib.Object
 }
 
 func (d DeviceObjects) GetGroupObjects() mib.GroupObjects {
@@ -47,6 +49,11 @@ func (d DeviceObjects) UpdateLastTimeChanged() {
 	d.LastTimeUpdated.Lock.Unlock()
 }
 
+func (d DeviceObjects) LastChange() *types.CompleteCodableValue {
+	value, _ := d.LastTimeUpdated.Get()
+	return value
+}
+
 func (d DeviceObjects) UpdateOperationalStatus(status int) {
 	d.OperationalStatus.Value = *types.NewCodableInt(status)
 }
@@ -55,12 +62,22 @@ func (d DeviceObjects) CheckNewValueValidity(objectIID, index int, value types.C
 	return 0
 }
 
+const (
+	defaultInformRetries = 3
+	defaultInformTimeout = time.Second
+)
+
 type DeviceConfig struct {
 	ID         string `yaml:"ID"`
 	Type       string `yaml:"Type"`
 	BeaconRate int    `yaml:"BeaconRate"`
 	NSensors   int    `yaml:"nSensors"`
 	NActuators int    `yaml:"nActuators"`
+	// Informs makes the beacon an acknowledged notification, resent up to
+	// InformRetries times starting with a timeout of InformTimeout miliseconds.
+	Informs       bool `yaml:"Informs"`
+	InformRetries int  `yaml:"InformRetries"`
+	InformTimeout int  `yaml:"InformTimeout"`
 }
 
 func NewDeviceObjects(c DeviceConfig) DeviceObjects {
@@ -74,6 +91,8 @@ func NewDeviceObjects(c DeviceConfig) DeviceObjects {
 	lastTimeUpdated := mib.NewObject("lastTimeUpdated", 8, "Date and time of the last update of any object in the device L-MIBvS.", false, *types.NewCodableTimestamp(time.Now()))
 	operationalStatus := mib.NewObject("operationalStatus", 9, "The operational state of the device, where the value 0 corresponds to a standby operational state, 1 corresponds to a normal operational state and 2 or greater corresponds to an non-operational error state.", false, *types.NewCodableInt(1))
 	reset := mib.NewObject("reset", 10, "Value 0 means no reset and value 1 means a reset procedure must be done.", true, *types.NewCodableInt(0))
+	informsSent := mib.NewObject("informsSent", 11, "Number of acknowledged notifications issued by the device.", false, *types.NewCodableCounter(0))
+	informsUnacked := mib.NewObject("informsUnacknowledged", 12, "Number of acknowledged notifications that no manager acknowledged before the retries ran out.", false, *types.NewCodableCounter(0))
 	objects := DeviceObjects{
 		Id:                &id,
 		Type:              &t,
@@ -85,18 +104,31 @@ func NewDeviceObjects(c DeviceConfig) DeviceObjects {
 		LastTimeUpdated:   &lastTimeUpdated,
 		OperationalStatus: &operationalStatus,
 		Reset:             &reset,
+		InformsSent:       &informsSent,
+		InformsUnacked:    &informsUnacked,
 	}
-	objects.GroupObjects = mib.NewGroupObjects([]*mib.Object{&id, &t, &beaconRate, &nSensors, &nActuators, &dateAndTime, &upTime, &lastTimeUpdated, &operationalStatus, &reset})
+	objects.GroupObjects = mib.NewGroupObjects([]*mib.Object{&id, &t, &beaconRate, &nSensors, &nActuators, &dateAndTime, &upTime, &lastTimeUpdated, &operationalStatus, &reset, &informsSent, &informsUnacked})
 	return objects
 }
 
 func NewDeviceGroup(c DeviceConfig) *mib.Group {
 	DeviceObject := &mib.Group{
-		Structure:            mib.NewStructure("device", 1, "Simple list of objects, where each object represents a characteristic from a domotics device agent"),
-		Objects:              NewDeviceObjects(c),
-		HasNotifications:     true,
-		NotificationsObjects: []int{1, 2, 4, 5, 6, 7, 8, 9},
-		NotificationRateOid:  3,
+		Structure:                mib.NewStructure("device", 1, "Simple list of objects, where each object represents a characteristic from a domotics device agent"),
+		Objects:                  NewDeviceObjects(c),
+		HasNotifications:         true,
+		NotificationsObjects:     []int{1, 2, 4, 5, 6, 7, 8, 9},
+		NotificationRateOid:      3,
+		Informs:                  c.Informs,
+		InformRetries:            c.InformRetries,
+		InformTimeout:            time.Duration(c.InformTimeout) * time.Millisecond,
+		InformsSentOid:           11,
+		InformsUnacknowledgedOid: 12,
+	}
+	if DeviceObject.InformRetries == 0 {
+		DeviceObject.InformRetries = defaultInformRetries
+	}
+	if DeviceObject.InformTimeout == 0 {
+		DeviceObject.InformTimeout = defaultInformTimeout
 	}
 	return DeviceObject
 }
@@ -0,0 +1,328 @@
+package domoticmib
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/eivarin/LSNMPvS-DomoticSystem/mib"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+	"gopkg.in/yaml.v2"
+)
+
+// maxNotificationTargets is how many rows agents have for managers to fill.
+// Rows are never created or removed: like the row status of SNMP tables, the
+// address tells if a row is in use, so managers take a free row by setting
+// its address along with its other columns and free it by setting the address
+// back to empty.
+const maxNotificationTargets = 8
+
+type NotificationTargetsEntry struct {
+	mib.TableEntry
+	Address mib.Object
+	Port    mib.Object
+	Enabled mib.Object
+	Groups  mib.Object
+}
+
+func (n NotificationTargetsEntry) CheckNewValueValidity(value types.CompleteCodableValue) packet.PacketErr {
+	return 0
+}
+
+func (n NotificationTargetsEntry) CheckColumnValue(objectIID int, value types.CompleteCodableValue) packet.PacketErr {
+	switch objectIID {
+	case n.Address.ObjectIID:
+		if s, ok := value.Value.(*CodableValues.CodableString); ok && !validTargetAddress(s.Value) {
+			return packet.ErrorValueOutOfRange
+		}
+	case n.Port.ObjectIID:
+		if i, ok := value.Value.(*CodableValues.CodableInt); ok && (i.Value < 0 || i.Value > 65535) {
+			return packet.ErrorValueOutOfRange
+		}
+	case n.Groups.ObjectIID:
+		if s, ok := value.Value.(*CodableValues.CodableString); ok {
+			if _, err := parseTargetGroups(s.Value); err != nil {
+				return packet.ErrorValueOutOfRange
+			}
+		}
+	}
+	return 0
+}
+
+func (n NotificationTargetsEntry) Copy() mib.TableEntryI {
+	newEntry := NotificationTargetsEntry{
+		Address: *n.Address.Copy(),
+		Port:    *n.Port.Copy(),
+		Enabled: *n.Enabled.Copy(),
+		Groups:  *n.Groups.Copy(),
+	}
+	newEntry.TableEntry = mib.NewTableEntry([]*mib.Object{&newEntry.Address, &newEntry.Port, &newEntry.Enabled, &newEntry.Groups})
+	return newEntry
+}
+
+func (n NotificationTargetsEntry) GetTableEntry() mib.TableEntry {
+	return n.TableEntry
+}
+
+// Config returns the values of the row.
+func (n NotificationTargetsEntry) Config() NotificationTargetConfig {
+	address, _ := n.TableEntry.Get(n.Address.ObjectIID)
+	port, _ := n.TableEntry.Get(n.Port.ObjectIID)
+	enabled, _ := n.TableEntry.Get(n.Enabled.ObjectIID)
+	groups, _ := n.TableEntry.Get(n.Groups.ObjectIID)
+	return NotificationTargetConfig{
+		Address: address.Value.(*CodableValues.CodableString).Value,
+		Port:    port.Value.(*CodableValues.CodableInt).Value,
+		Enabled: enabled.Value.(*CodableValues.CodableBool).Value,
+		Groups:  groups.Value.(*CodableValues.CodableString).Value,
+	}
+}
+
+// NotificationTargetConfig is a manager notifications are sent to, at Port or
+// at the NotificationPort when it's 0. Groups lists the IIDs of the groups
+// whose notifications it gets, like "1" or "1,5", every one when it's empty.
+type NotificationTargetConfig struct {
+	Address string `yaml:"Address"`
+	Port    int    `yaml:"Port"`
+	Enabled bool   `yaml:"Enabled"`
+	Groups  string `yaml:"Groups"`
+}
+
+func NewNotificationTargetsEntry(c NotificationTargetConfig) NotificationTargetsEntry {
+	entry := NotificationTargetsEntry{
+		Address: mib.NewObject("address", 1, "Host name or IP address of the manager notifications are sent to, empty when the row is free.", true, *types.NewCodableString(c.Address)),
+		Port:    mib.NewObject("port", 2, "Port notifications are sent to, the notification port of the device when 0.", true, *types.NewCodableInt(c.Port)),
+		Enabled: mib.NewObject("enabled", 3, "Whether notifications are sent to the manager.", true, *types.NewCodableBool(c.Enabled)),
+		Groups:  mib.NewObject("groups", 4, "Comma separated IIDs of the groups whose notifications are sent, all of them when empty.", true, *types.NewCodableString(c.Groups)),
+	}
+	entry.TableEntry = mib.NewTableEntry([]*mib.Object{&entry.Address, &entry.Port, &entry.Enabled, &entry.Groups})
+	return entry
+}
+
+func NewNotificationTargetsTable(c []NotificationTargetConfig) *mib.Table {
+	targetsTable := &mib.Table{
+		Structure: mib.NewStructure("NotificationTargets", 4, "Table with the managers notifications are sent to."),
+		Columns:   NewNotificationTargetsEntry(NotificationTargetConfig{}),
+		Objects:   []mib.TableEntryI{},
+	}
+	for _, target := range c {
+		targetsTable.AddRow(NewNotificationTargetsEntry(target))
+	}
+	return targetsTable
+}
+
+func validTargetAddress(address string) bool {
+	if address == "" {
+		return true
+	}
+	if _, err := netip.ParseAddr(address); err == nil {
+		return true
+	}
+	for _, c := range address {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return len(address) <= 253
+}
+
+func parseTargetGroups(groups string) ([]int, error) {
+	res := make([]int, 0)
+	if strings.TrimSpace(groups) == "" {
+		return res, nil
+	}
+	for _, group := range strings.Split(groups, ",") {
+		iid, err := strconv.Atoi(strings.TrimSpace(group))
+		if err != nil || iid <= 0 {
+			return nil, fmt.Errorf("invalid group %q", group)
+		}
+		res = append(res, iid)
+	}
+	return res, nil
+}
+
+// notificationTargets sends the notifications of a group to the enabled rows
+// of the table that take them. Their addresses are resolved by refresh when
+// the rows are loaded or set, so sending notifications never waits on DNS.
+type notificationTargets struct {
+	table       *mib.Table
+	defaultPort int
+	lock        *sync.RWMutex
+	resolved    []resolvedTarget
+}
+
+// resolvedTarget is an enabled row, with a nil addr when it can't be
+// resolved.
+type resolvedTarget struct {
+	groups []int
+	addr   *net.UDPAddr
+}
+
+func newNotificationTargets(table *mib.Table, defaultPort int) *notificationTargets {
+	n := &notificationTargets{table: table, defaultPort: defaultPort, lock: &sync.RWMutex{}}
+	n.refresh()
+	return n
+}
+
+// refresh resolves the addresses of the enabled rows. Callers serialize it so
+// an older copy of the rows never replaces a newer one.
+func (n *notificationTargets) refresh() {
+	resolved := make([]resolvedTarget, 0)
+	for _, c := range targetConfigs(n.table) {
+		if c.Address == "" || !c.Enabled {
+			continue
+		}
+		target := resolvedTarget{}
+		groups, err := parseTargetGroups(c.Groups)
+		if err == nil {
+			target.groups = groups
+			port := c.Port
+			if port == 0 {
+				port = n.defaultPort
+			}
+			if addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(c.Address, strconv.Itoa(port))); err == nil {
+				target.addr = addr
+			}
+		}
+		resolved = append(resolved, target)
+	}
+	n.lock.Lock()
+	n.resolved = resolved
+	n.lock.Unlock()
+}
+
+func (n *notificationTargets) NotificationAddrs(structure int) ([]*net.UDPAddr, bool) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	addrs := make([]*net.UDPAddr, 0)
+	for _, target := range n.resolved {
+		if target.addr == nil || len(target.groups) > 0 && !slices.Contains(target.groups, structure) {
+			continue
+		}
+		addrs = append(addrs, target.addr)
+	}
+	return addrs, len(n.resolved) > 0
+}
+
+// targetConfigs returns the values of every row of table.
+func targetConfigs(table *mib.Table) []NotificationTargetConfig {
+	table.RLock()
+	defer table.RUnlock()
+	targets := make([]NotificationTargetConfig, 0, len(table.Objects))
+	for _, entry := range table.Objects {
+		targets = append(targets, entry.(NotificationTargetsEntry).Config())
+	}
+	return targets
+}
+
+// notificationTargetsPath is where the targets of the agent configured at
+// ymlConfigPath are kept, next to it unless configured otherwise.
+func notificationTargetsPath(ymlConfigPath, configured string) string {
+	if configured != "" {
+		return configured
+	}
+	return strings.TrimSuffix(ymlConfigPath, filepath.Ext(ymlConfigPath)) + ".targets.yml"
+}
+
+// loadNotificationTargets reads the targets saved at path, or builds them from
+// the NotificationTargets of the network config when nothing was saved yet,
+// with free rows up to maxNotificationTargets.
+func loadNotificationTargets(path string, config NetworkConfig) ([]NotificationTargetConfig, error) {
+	targets := make([]NotificationTargetConfig, 0)
+	bs, err := os.ReadFile(path)
+	if err == nil {
+		if err := yaml.Unmarshal(bs, &targets); err != nil {
+			return nil, fmt.Errorf("notification targets %s: %w", path, err)
+		}
+	} else if os.IsNotExist(err) {
+		for _, target := range config.NotificationTargets {
+			host, port, err := net.SplitHostPort(withDefaultPort(target, 0))
+			if err != nil {
+				return nil, err
+			}
+			p, err := strconv.Atoi(port)
+			if err != nil {
+				return nil, fmt.Errorf("NotificationTargets %s has an invalid port", target)
+			}
+			targets = append(targets, NotificationTargetConfig{Address: host, Port: p, Enabled: true})
+		}
+	} else {
+		return nil, err
+	}
+	for _, target := range targets {
+		if _, err := parseTargetGroups(target.Groups); err != nil || !validTargetAddress(target.Address) || target.Port < 0 || target.Port > 65535 {
+			return nil, fmt.Errorf("invalid notification target %+v", target)
+		}
+	}
+	for len(targets) < maxNotificationTargets {
+		targets = append(targets, NotificationTargetConfig{})
+	}
+	return targets, nil
+}
+
+// saveNotificationTargets writes the rows of table to path up to the last
+// one in use, replacing the file at once so a crash can't leave half of it.
+func saveNotificationTargets(path string, table *mib.Table) error {
+	targets := targetConfigs(table)
+	for len(targets) > 0 && targets[len(targets)-1] == (NotificationTargetConfig{}) {
+		targets = targets[:len(targets)-1]
+	}
+	bs, err := yaml.Marshal(targets)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// notificationTargets OBJECT {
+// TYPE Table
+// INCLUDE address, port, enabled, groups
+// DESCRIPTION "Table with the managers notifications are sent to. It always has 8 rows,
+// the ones with an empty address being free."
+// IID 4 }
+
+// notificationTargets.address OBJECT {
+// TYPE String
+// ACESS read-write
+// DESCRIPTION "Host name or IP address of the manager notifications are sent to, empty when the
+// row is free."
+// IID 4.1 }
+
+// notificationTargets.port OBJECT {
+// TYPE Integer
+// ACESS read-write
+// DESCRIPTION "Port notifications are sent to, the notification port of the device when 0."
+// IID 4.2 }
+
+// notificationTargets.enabled OBJECT {
+// TYPE Boolean
+// ACESS read-write
+// DESCRIPTION "Whether notifications are sent to the manager."
+// IID 4.3 }
+
+// notificationTargets.groups OBJECT {
+// TYPE String
+// ACESS read-write
+// DESCRIPTION "Comma separated IIDs of the groups whose notifications are sent, all of them when
+// empty."
+// IID 4.4 }
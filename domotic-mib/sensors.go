@@ -1,7 +1,6 @@
 package domoticmib
 
 import (
-	"strconv"
 	"time"
 
 	"github.com/eivarin/LSNMPvS-DomoticSystem/mib"
@@ -18,9 +17,13 @@ type SensorsEntry struct {
 	minValue         mib.Object
 	maxValue         mib.Object
 	lastSamplingTime mib.Object
-	virtual          struct {
+	// valueType and scale are what status, minValue and maxValue are declared
+	// with
+	valueType string
+	scale     int
+	virtual   struct {
 		gradientChange  bool
-		factor          int
+		factor          float64
 		actuatorGetInfo struct {
 			Object int
 			Index  int
@@ -40,6 +43,8 @@ func (s SensorsEntry) Copy() mib.TableEntryI {
 		minValue:         *s.minValue.Copy(),
 		maxValue:         *s.maxValue.Copy(),
 		lastSamplingTime: *s.lastSamplingTime.Copy(),
+		valueType:        s.valueType,
+		scale:            s.scale,
 	}
 	newEntry.virtual.gradientChange = s.virtual.gradientChange
 	newEntry.virtual.factor = s.virtual.factor
@@ -53,15 +58,22 @@ func (s SensorsEntry) GetTableEntry() mib.TableEntry {
 	return s.TableEntry
 }
 
+// SensorConfig declares a sensor whose status, minValue and maxValue are of
+// ValueType, one of "int", "decimal" with Scale decimal places, "bool" or
+// "counter". A virtual sensor follows the actuator at ActuatorGetInfo, moving
+// towards it by Factor on every update with GradientChange or becoming its
+// value times Factor otherwise, while a counter adds that to its count.
 type SensorConfig struct {
-	ID       string `yaml:"ID"`
-	Type     string `yaml:"Type"`
-	Status   int    `yaml:"Status"`
-	MinValue int    `yaml:"MinValue"`
-	MaxValue int    `yaml:"MaxValue"`
-	Virtual  struct {
-		GradientChange  bool `yaml:"GradientChange"`
-		Factor          int  `yaml:"Factor"`
+	ID        string  `yaml:"ID"`
+	Type      string  `yaml:"Type"`
+	ValueType string  `yaml:"ValueType"`
+	Scale     int     `yaml:"Scale"`
+	Status    float64 `yaml:"Status"`
+	MinValue  float64 `yaml:"MinValue"`
+	MaxValue  float64 `yaml:"MaxValue"`
+	Virtual   struct {
+		GradientChange  bool    `yaml:"GradientChange"`
+		Factor          float64 `yaml:"Factor"`
 		ActuatorGetInfo struct {
 			Object int `yaml:"Object"`
 			Index  int `yaml:"Index"`
@@ -73,10 +85,12 @@ func NewSensorsEntry(c SensorConfig) SensorsEntry {
 	entry := SensorsEntry{
 		id:               mib.NewObject("id", 1, "Tag identifying the sensor (the MacAddress, for example).", false, *types.NewCodableString(c.ID)),
 		sensorType:       mib.NewObject("type", 2, "Text description for the type of sensor (“Light”, for example).", false, *types.NewCodableString(c.Type)),
-		status:           mib.NewObject("status", 3, "Last value sampled by the sensor in percentage of the interval between minValue and maxValue.", false, *types.NewCodableInt(c.Status)),
-		minValue:         mib.NewObject("minValue", 4, "Minimum value possible for the sampling values of the sensor.", false, *types.NewCodableInt(c.MinValue)),
-		maxValue:         mib.NewObject("maxValue", 5, "Maximum value possible for the sampling values of the sensor.", false, *types.NewCodableInt(c.MaxValue)),
+		status:           mib.NewObject("status", 3, "Last value sampled by the sensor in percentage of the interval between minValue and maxValue.", false, *newNumericValue(c.ValueType, c.Scale, c.Status)),
+		minValue:         mib.NewObject("minValue", 4, "Minimum value possible for the sampling values of the sensor.", false, *newNumericValue(c.ValueType, c.Scale, c.MinValue)),
+		maxValue:         mib.NewObject("maxValue", 5, "Maximum value possible for the sampling values of the sensor.", false, *newNumericValue(c.ValueType, c.Scale, c.MaxValue)),
 		lastSamplingTime: mib.NewObject("lastSamplingTime", 6, "Time elapsed since the last sample was obtained by the sensor.", false, *types.NewCodableTimestampNow()),
+		valueType:        c.ValueType,
+		scale:            c.Scale,
 	}
 	entry.virtual.gradientChange = c.Virtual.GradientChange
 	entry.virtual.factor = c.Virtual.Factor
@@ -100,29 +114,27 @@ func NewSensorsTable(c []SensorConfig) *mib.Table {
 
 func (s SensorsEntry) UpdateValues(Actuators *mib.Table) (bool, string) {
 	aValue, _ := Actuators.Get(s.virtual.actuatorGetInfo.Object, s.virtual.actuatorGetInfo.Index-1)
-	actuatorValue := aValue.Value.(*CodableValues.CodableInt).Value
-	status := s.status
-	status.Lock.Lock()
-	currentValue := s.status.Value.Value.(*CodableValues.CodableInt)
-	oldValue := currentValue.Value
-	changed := false
-	if s.virtual.gradientChange {
-		if currentValue.Value < actuatorValue {
-			currentValue.Value += s.virtual.factor
-			changed = true
-		} else if currentValue.Value > actuatorValue {
-			currentValue.Value -= s.virtual.factor
-			changed = true
+	actuatorValue, _ := numericValue(aValue)
+	oldValue, _ := s.TableEntry.Get(s.status.ObjectIID)
+	currentValue, _ := numericValue(oldValue)
+	switch {
+	case s.valueType == CounterValue:
+		currentValue += max(actuatorValue*s.virtual.factor, 0)
+	case s.virtual.gradientChange:
+		if currentValue < actuatorValue {
+			currentValue += s.virtual.factor
+		} else if currentValue > actuatorValue {
+			currentValue -= s.virtual.factor
 		}
-	} else {
-		currentValue.Value = actuatorValue*s.virtual.factor
-		changed = true
+	default:
+		currentValue = actuatorValue * s.virtual.factor
 	}
-	status.Lock.Unlock()
+	newValue := newNumericValue(s.valueType, s.scale, currentValue)
+	changed := !newValue.Equals(oldValue)
 	logStr := ""
-	changed = changed && oldValue != currentValue.Value
 	if changed {
-		logStr = s.id.Value.String() + " updated: " + strconv.Itoa(oldValue) + " -> " + strconv.Itoa(currentValue.Value)
+		s.TableEntry.Update(s.status.ObjectIID, *newValue)
+		logStr = s.id.Value.String() + " updated: " + oldValue.Render() + " -> " + newValue.Render()
 		s.lastSamplingTime.Lock.Lock()
 		s.lastSamplingTime.Value.Value.(*CodableValues.Timestamp).Ts = time.Now()
 		s.lastSamplingTime.Lock.Unlock()
@@ -143,20 +155,20 @@ func (s SensorsEntry) UpdateValues(Actuators *mib.Table) (bool, string) {
 // IID 2.2 }
 
 // sensors.status OBJECT {
-// TYPE Integer
+// TYPE Integer, Decimal, Boolean or Counter, as declared
 // ACESS read-only
 // DESCRIPTION "Last value sampled by the sensor in percentage of the interval between
 // minValue and maxValue."
 // IID 2.3 }
 
 // sensors.minValue OBJECT {
-// TYPE Integer
+// TYPE The one of status
 // ACESS read-only
 // DESCRIPTION "Minimum value possible for the sampling values of the sensor."
 // IID 2.4 }
 
 // sensors.maxValue OBJECT {
-// TYPE Integer
+// TYPE The one of status
 // ACESS read-only
 // DESCRIPTION "Maximum value possible for the sampling values of the sensor."
 // IID 2.5 }
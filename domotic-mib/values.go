@@ -0,0 +1,86 @@
+package domoticmib
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+)
+
+// Value types the status of sensors and actuators can be declared with in
+// their ValueType, IntValue when it's left out.
+const (
+	IntValue     = "int"
+	DecimalValue = "decimal"
+	BoolValue    = "bool"
+	CounterValue = "counter"
+)
+
+// checkValueType tells if an object named id can be declared with valueType,
+// which must be one of allowed, and scale, which only decimals have.
+func checkValueType(id, valueType string, scale int, allowed ...string) error {
+	if valueType == "" {
+		valueType = IntValue
+	}
+	if !slices.Contains(allowed, valueType) {
+		return fmt.Errorf("%s has value type %q, expected one of %s", id, valueType, strings.Join(allowed, ", "))
+	}
+	if scale < 0 || scale > CodableValues.MaxDecimalScale || scale != 0 && valueType != DecimalValue {
+		return fmt.Errorf("%s has invalid scale %d for value type %q", id, scale, valueType)
+	}
+	return nil
+}
+
+// checkValueTypes checks the value types of the sensors and actuators of
+// config, counters only making sense for sensors.
+func checkValueTypes(config DomoticMIBAgentConfig) error {
+	for _, c := range config.Sensors {
+		if err := checkValueType(c.ID, c.ValueType, c.Scale, IntValue, DecimalValue, BoolValue, CounterValue); err != nil {
+			return err
+		}
+	}
+	for _, c := range config.Actuators {
+		if err := checkValueType(c.ID, c.ValueType, c.Scale, IntValue, DecimalValue, BoolValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newNumericValue builds a value of valueType worth number, rounded to scale
+// decimal places for decimals and to a whole number otherwise. Bools are on
+// for anything but 0 and counters never go below 0.
+func newNumericValue(valueType string, scale int, number float64) *types.CompleteCodableValue {
+	switch valueType {
+	case DecimalValue:
+		d := CodableValues.NewDecimalFromFloat(number, scale)
+		return types.NewCodableDecimal(d.Value, d.Scale)
+	case BoolValue:
+		return types.NewCodableBool(number != 0)
+	case CounterValue:
+		return types.NewCodableCounter(uint64(max(math.Round(number), 0)))
+	}
+	return types.NewCodableInt(int(math.Round(number)))
+}
+
+// numericValue returns v as a number, bools being 0 or 1, and false when it
+// isn't one.
+func numericValue(v *types.CompleteCodableValue) (float64, bool) {
+	switch value := v.Value.(type) {
+	case *CodableValues.CodableInt:
+		return float64(value.Value), true
+	case *CodableValues.CodableDecimal:
+		return value.Float64(), true
+	case *CodableValues.CodableCounter:
+		return float64(value.Value), true
+	case *CodableValues.CodableBool:
+		if value.Value {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,113 @@
+package domoticmib
+
+import (
+	"testing"
+
+	netfuncs "github.com/eivarin/LSNMPvS-DomoticSystem/NetFuncs"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types"
+)
+
+const testValueTypesConfig = `device:
+  ID: "Kitchen"
+  Type: "AC"
+  nSensors: 2
+  nActuators: 2
+sensors:
+  - ID: "Temperature"
+    Type: "Temperature"
+    ValueType: "decimal"
+    Scale: 1
+    Status: 20.0
+    MinValue: -10.0
+    MaxValue: 50.0
+    Virtual:
+      GradientChange: true
+      Factor: 0.5
+      ActuatorGetInfo:
+        Object: 3
+        Index: 1
+  - ID: "Energy"
+    Type: "Energy"
+    ValueType: "counter"
+    Virtual:
+      Factor: 2
+      ActuatorGetInfo:
+        Object: 3
+        Index: 2
+actuators:
+  - ID: "AC"
+    Type: "AC"
+    ValueType: "decimal"
+    Scale: 1
+    Status: 21.0
+    MinValue: 10.0
+    MaxValue: 30.0
+  - ID: "Heater"
+    Type: "Heater"
+    ValueType: "bool"
+    Status: 1
+    MaxValue: 1
+network:
+  ListenAddress: "10.0.0.1"
+`
+
+// TestDeclaredValueTypes runs sensors and actuators declared with decimal,
+// bool and counter values.
+func TestDeclaredValueTypes(t *testing.T) {
+	agent, err := NewDomoticMIBOn(writeTestConfig(t, "kitchen.yml", testValueTypesConfig), netfuncs.NewMemoryNetwork().Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { agent.Transport.Close() })
+	status := func(structure, index int) string {
+		t.Helper()
+		value, pErr := agent.Get(nil, structure, 3, &index)
+		if pErr != 0 {
+			t.Fatalf("getting %d.3.%d failed with %v", structure, index, pErr)
+		}
+		return value.Value.Render()
+	}
+
+	agent.UpdateSensorValues()
+	if temperature, energy := status(2, 1), status(2, 2); temperature != "20.5" || energy != "2" {
+		t.Errorf("sensors are %s and %s, expected 20.5 and 2", temperature, energy)
+	}
+
+	set := func(index int, value *types.CompleteCodableValue) packet.PacketErr {
+		errorList := agent.SetAll(nil, []types.IdValuePair{{IID: types.NewCodableIID(3, 3, []int{index}), Value: value}}, nil)
+		if len(errorList) == 0 {
+			return 0
+		}
+		return errorList[0].Code
+	}
+	if pErr := set(1, types.NewCodableDecimal(350, 1)); pErr != packet.ErrorValueOutOfRange {
+		t.Errorf("setting the AC to 35.0 returned %v, expected it out of range", pErr)
+	}
+	if pErr := set(1, types.NewCodableInt(25)); pErr != packet.ErrorInvalidDataType {
+		t.Errorf("setting the AC to an integer returned %v, expected an invalid data type", pErr)
+	}
+	if pErr := set(1, types.NewCodableDecimal(225, 1)); pErr != 0 {
+		t.Errorf("setting the AC to 22.5 failed with %v", pErr)
+	}
+	if pErr := set(2, types.NewCodableBool(false)); pErr != 0 {
+		t.Errorf("turning the heater off failed with %v", pErr)
+	}
+
+	agent.UpdateSensorValues()
+	if temperature, energy, heater := status(2, 1), status(2, 2), status(3, 2); temperature != "21.0" || energy != "2" || heater != "off" {
+		t.Errorf("temperature, energy and heater are %s, %s and %s, expected 21.0, 2 and off", temperature, energy, heater)
+	}
+}
+
+func TestCounterActuatorsAreRejected(t *testing.T) {
+	config := `actuators:
+  - ID: "Meter"
+    ValueType: "counter"
+network:
+  ListenAddress: "10.0.0.1"
+`
+	if _, err := NewDomoticMIBOn(writeTestConfig(t, "meter.yml", config), netfuncs.NewMemoryNetwork().Listen); err == nil {
+		t.Error("an actuator was declared as a counter")
+	}
+}
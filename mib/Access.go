@@ -0,0 +1,116 @@
+package mib
+
+import (
+	"crypto/subtle"
+	"slices"
+
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet"
+)
+
+type AccessLevel int
+
+const (
+	NoAccess AccessLevel = iota
+	ReadAccess
+	WriteAccess
+)
+
+// Principal is someone allowed into the MIB, like an SNMP community, once
+// they show their secret. They only see the objects in View, or every object
+// when it's nil.
+type Principal struct {
+	Secret string
+	Access AccessLevel
+	View   *View
+}
+
+// View is a named set of IID subtrees, like the views of SNMP's VACM.
+type View struct {
+	Name  string
+	Rules []ViewRule
+}
+
+// ViewRule includes or excludes every IID starting with Subtree, which lists
+// a structure, an object and an index.
+type ViewRule struct {
+	Subtree []int
+	Include bool
+}
+
+// Contains tells if the IID made of iid's structure, object and index is in
+// the view. The rule with the longest subtree holding it decides, with
+// exclusions winning ties, and IIDs outside every rule aren't in the view. A
+// nil view contains every IID.
+func (v *View) Contains(iid ...int) bool {
+	if v == nil {
+		return true
+	}
+	matched, included := -1, false
+	for _, rule := range v.Rules {
+		if len(rule.Subtree) > len(iid) || len(rule.Subtree) < matched {
+			continue
+		}
+		if !slices.Equal(rule.Subtree, iid[:len(rule.Subtree)]) {
+			continue
+		}
+		if len(rule.Subtree) > matched {
+			included = rule.Include
+		} else {
+			included = included && rule.Include
+		}
+		matched = len(rule.Subtree)
+	}
+	return included
+}
+
+// viewIID lists the parts of an IID checked by views.
+func viewIID(structure, objectIID int, index *int) []int {
+	if index == nil {
+		return []int{structure, objectIID}
+	}
+	return []int{structure, objectIID, *index}
+}
+
+// AccessControl maps users to what they're allowed to do. An empty one lets
+// every request through, like agents did before credentials existed.
+type AccessControl map[string]Principal
+
+// requiredAccess is the access level needed for a packet type. Responses and
+// notifications don't need any.
+func requiredAccess(pType byte) AccessLevel {
+	switch pType {
+	case 'G', 'X', 'B':
+		return ReadAccess
+	case 'S', 'C':
+		return WriteAccess
+	}
+	return NoAccess
+}
+
+// Authorize tells if the credentials of r allow it, returning
+// ErrorAuthorization otherwise.
+func (a AccessControl) Authorize(r packet.LSNMPvS_Packet) packet.PacketErr {
+	required := requiredAccess(r.GetType())
+	if len(a) == 0 || required == NoAccess {
+		return 0
+	}
+	credentials := r.GetCredentials()
+	principal, ok := a[credentials.User]
+	if !ok || subtle.ConstantTimeCompare([]byte(principal.Secret), []byte(credentials.Secret)) != 1 || principal.Access < required {
+		return packet.ErrorAuthorization
+	}
+	return 0
+}
+
+// ViewFor returns the view of whoever has credentials. When there's no access
+// control every IID can be seen.
+func (a AccessControl) ViewFor(credentials packet.Credentials) *View {
+	if len(a) == 0 {
+		return nil
+	}
+	principal, ok := a[credentials.User]
+	if !ok {
+		return &View{}
+	}
+	return principal.View
+}
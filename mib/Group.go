@@ -1,6 +1,7 @@
 package mib
 
 import (
+	"net"
 	"time"
 
 	netfuncs "github.com/eivarin/LSNMPvS-DomoticSystem/NetFuncs"
@@ -21,7 +22,7 @@ type GroupObjects map[int][]*Object
 
 func (g GroupObjects) Get(objectIID, index int) (*types.CompleteCodableValue, packet.PacketErr) {
 	if ok := g[objectIID]; ok != nil {
-		return g[objectIID][index].Value.Copy(), 0
+		return g[objectIID][index].Get()
 	} else {
 		return nil, packet.ErrorObjectIdDoesntExist
 	}
@@ -58,6 +59,14 @@ type Group struct {
 	HasNotifications     bool
 	NotificationsObjects []int
 	NotificationRateOid  int
+	// When Informs is set notifications must be acknowledged by a manager.
+	// Each one is resent up to InformRetries times, waiting InformTimeout for
+	// the first acknowledgement and twice as long after each retry.
+	Informs                  bool
+	InformRetries            int
+	InformTimeout            time.Duration
+	InformsSentOid           int
+	InformsUnacknowledgedOid int
 }
 
 func (g *Group) Get(objectIID, index int) (*types.CompleteCodableValue, packet.PacketErr) {
@@ -71,6 +80,24 @@ func (g *Group) Set(objectIID, index int, value types.CompleteCodableValue) pack
 	return g.Objects.Set(objectIID, index, value)
 }
 
+func (g *Group) Validate(objectIID, index int, value types.CompleteCodableValue) packet.PacketErr {
+	if err := g.Objects.CheckNewValueValidity(objectIID, index, value); err != 0 {
+		return err
+	}
+	objects := g.Objects.GetGroupObjects()[objectIID]
+	if index < 0 || index >= len(objects) {
+		return packet.ErrorObjectIdDoesntExist
+	}
+	return objects[index].Validate(value)
+}
+
+func (g *Group) LastChange(index int) (*types.CompleteCodableValue, bool) {
+	if objects, ok := g.Objects.(LastChangeI); ok {
+		return objects.LastChange(), true
+	}
+	return nil, false
+}
+
 func (g *Group) Update(objectIID, index int, value types.CompleteCodableValue) {
 	g.Objects.Update(objectIID, index, value)
 }
@@ -111,14 +138,14 @@ func (g *Group) RenderTableWithLipGloss(width int) string {
 	for i := 1; i <= leng; i++ {
 		for _, object := range gos[i] {
 			Titles = append(Titles, object.Name)
-			row = append(row, object.Value.String())
+			row = append(row, object.Value.Render())
 		}
 	}
 	Values = append(Values, row)
 	return g.renderStructureTableWithLipGloss(Titles, Values, width)
 }
 
-func (g *Group) SendNotifications(uptime *types.CompleteCodableValue) {
+func (g *Group) NotificationEntries() []types.IdValuePair {
 	Entrys := make([]types.IdValuePair, len(g.NotificationsObjects))
 	for i, objectIID := range g.NotificationsObjects {
 		val, _ := g.Get(objectIID, 0)
@@ -127,10 +154,15 @@ func (g *Group) SendNotifications(uptime *types.CompleteCodableValue) {
 			Value: val,
 		}
 	}
+	return Entrys
+}
+
+// SendNotifications sends the notification objects of g to addrs through t.
+func (g *Group) SendNotifications(t netfuncs.Transport, addrs []*net.UDPAddr, uptime *types.CompleteCodableValue) {
+	Entrys := g.NotificationEntries()
 	// fmt.Printf("Sending notifications: %v\n", Entrys)
 	p := packet.NewNotificationPacket(Entrys, uptime)
-	encStr := p.Encode()
-	netfuncs.SendBroadcast(12345, []byte(encStr))
+	netfuncs.SendAll(t, addrs, p.EncodeFrames()...)
 }
 
 func (g *Group) GetNotificationRate() time.Duration {
@@ -140,6 +172,24 @@ func (g *Group) GetNotificationRate() time.Duration {
 	return time.Duration(int64(notiRateCodable.Value.(*CodableValues.CodableInt).Value)) * time.Second
 }
 
+// IncrementCounter adds one to the counter object objectIID, doing nothing
+// when the group doesn't have it.
+func (g *Group) IncrementCounter(objectIID int) {
+	if objectIID == 0 {
+		return
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	value, pErr := g.Get(objectIID, 0)
+	if pErr != 0 {
+		return
+	}
+	if counter, ok := value.Value.(*CodableValues.CodableCounter); ok {
+		counter.Increment(1)
+		g.Update(objectIID, 0, *value)
+	}
+}
+
 func (g *Group) GetDimensions() map[int]int {
 	g.lock.RLock()
 	defer g.lock.RUnlock()
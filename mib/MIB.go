@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -16,29 +17,76 @@ import (
 	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
 )
 
+const (
+	// DefaultReplayWindow is how far the timestamp of a request can be from
+	// the receiver's clock, and for how long its message id is remembered.
+	DefaultReplayWindow = 30 * time.Second
+	// maxStoredPackets bounds the packets kept to be shown in the UI.
+	maxStoredPackets = 200
+	// maxUntimedIDs bounds the message ids kept of packets without a send
+	// time, the oldest being forgotten first.
+	maxUntimedIDs = 4096
+)
+
 type RecPacketList struct {
 	packets     *[]packet.LSNMPvS_Packet
-	packetsByID map[string]packet.LSNMPvS_Packet
+	packetsByID map[string]time.Time // when each message id can be forgotten, never if zero
+	untimedIDs  []string             // message ids without expiry, oldest first
+	window      time.Duration
 	lock        *sync.RWMutex
 }
 
 func NewRecPacketList() RecPacketList {
 	return RecPacketList{
 		packets:     &[]packet.LSNMPvS_Packet{},
-		packetsByID: make(map[string]packet.LSNMPvS_Packet),
+		packetsByID: make(map[string]time.Time),
+		window:      DefaultReplayWindow,
 		lock:        &sync.RWMutex{},
 	}
 }
 
+func (r *RecPacketList) SetReplayWindow(window time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.window = window
+}
+
+// AddPacket remembers p, failing with ErrorDuplicateMessageId if it's a
+// replay: its message id was already seen or it was sent outside the replay
+// window. Message ids of requests are forgotten once the window has passed,
+// since a replay of them from then on is rejected by its timestamp. Responses,
+// notifications and informs carry no send time, so the last maxUntimedIDs of
+// their message ids are kept for good instead.
 func (r *RecPacketList) AddPacket(p packet.LSNMPvS_Packet) packet.PacketErr {
+	return r.addPacketAt(p, time.Now())
+}
+
+func (r *RecPacketList) addPacketAt(p packet.LSNMPvS_Packet, now time.Time) packet.PacketErr {
 	r.lock.Lock()
 	defer r.lock.Unlock()
+	for mId, expiry := range r.packetsByID {
+		if !expiry.IsZero() && now.After(expiry) {
+			delete(r.packetsByID, mId)
+		}
+	}
 	mId := p.GetMessageID()
-	if _, ok := r.packetsByID[p.GetMessageID()]; ok {
+	if _, ok := r.packetsByID[mId]; ok || !p.InReplayWindow(now, r.window) {
 		return packet.ErrorDuplicateMessageId
 	}
-	r.packetsByID[mId] = p
+	if p.HasSendTime() {
+		r.packetsByID[mId] = now.Add(r.window)
+	} else {
+		r.packetsByID[mId] = time.Time{}
+		r.untimedIDs = append(r.untimedIDs, mId)
+		if len(r.untimedIDs) > maxUntimedIDs {
+			delete(r.packetsByID, r.untimedIDs[0])
+			r.untimedIDs = r.untimedIDs[1:]
+		}
+	}
 	*r.packets = append(*r.packets, p)
+	if len(*r.packets) > maxStoredPackets {
+		*r.packets = (*r.packets)[len(*r.packets)-maxStoredPackets:]
+	}
 	return 0
 }
 
@@ -64,6 +112,15 @@ type HandlerI interface {
 	HandleSet(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool)
 	HandleResponse(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool)
 	HandleNotification(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool)
+	HandleGetNext(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool)
+	HandleGetBulk(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool)
+	HandleInform(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool)
+}
+
+// NotificationTargetsI tells where the notifications of the group with IID
+// structure go, and whether any target is enabled at all.
+type NotificationTargetsI interface {
+	NotificationAddrs(structure int) ([]*net.UDPAddr, bool)
 }
 
 type MIB struct {
@@ -72,7 +129,17 @@ type MIB struct {
 	Tables     []*Table
 	Logger     *CustomLogger.CustomLogger
 	Packets    RecPacketList
-	StartTime  time.Time
+	Pending    PendingRequests
+	Fragments  *packet.Reassembler
+	Access     AccessControl
+	Network    Network
+	// Targets are where notifications go, the ones of Network when it's nil
+	// or has none enabled
+	Targets NotificationTargetsI
+	// Transport is the socket the device sends and receives packets through
+	Transport netfuncs.Transport
+	StartTime time.Time
+	setLock   *sync.Mutex
 }
 
 func NewMIB(logger *CustomLogger.CustomLogger, structures []StructureI) MIB {
@@ -83,6 +150,10 @@ func NewMIB(logger *CustomLogger.CustomLogger, structures []StructureI) MIB {
 		Logger:     logger,
 		StartTime:  time.Now(),
 		Packets:    NewRecPacketList(),
+		Pending:    NewPendingRequests(),
+		Fragments:  packet.NewReassembler(packet.DefaultFragmentTimeout),
+		Network:    DefaultNetwork(),
+		setLock:    &sync.Mutex{},
 	}
 	for _, structure := range structures {
 		switch s := structure.(type) {
@@ -106,7 +177,9 @@ func (m *MIB) AddTable(structure *Table) {
 	m.Structures[structure.StructureIID] = structure
 }
 
-func (m *MIB) Get(structure, objectIID int, index *int) (types.IdValuePair, packet.PacketErr) {
+// Get returns the value of structure.objectIID.index, as long as view
+// contains it.
+func (m *MIB) Get(view *View, structure, objectIID int, index *int) (types.IdValuePair, packet.PacketErr) {
 	var (
 		IID         *types.CompleteCodableValue
 		ObjectValue *types.CompleteCodableValue
@@ -119,13 +192,21 @@ func (m *MIB) Get(structure, objectIID int, index *int) (types.IdValuePair, pack
 		indexList = append(indexList, *index)
 	}
 	IID = types.NewCodableIID(structure, objectIID, indexList)
-	if s, ok := m.Structures[structure]; ok {
+	if s, ok := m.Structures[structure]; !ok {
+		pErr = packet.ErrorStructureDoesntExist
+	} else if !view.Contains(viewIID(structure, objectIID, index)...) {
+		pErr = packet.ErrorObjectIdDoesntExist
+	} else {
 		if objectIID == 0 {
 			if index != nil {
 				pErr = packet.ErrorInvalidIID
 			} else {
 				ObjectValue = types.NewCodableInt(s.Len())
 			}
+		} else if objectIID > s.Len() {
+			pErr = packet.ErrorObjectIdDoesntExist
+		} else if index == nil {
+			pErr = packet.ErrorInvalidIID
 		} else if objectIID > 0 {
 			objectLen := s.Count(objectIID)
 			if *index == 0 {
@@ -146,48 +227,224 @@ func (m *MIB) Get(structure, objectIID int, index *int) (types.IdValuePair, pack
 	}, pErr
 }
 
-func (m *MIB) Set(structure, objectIID int, index *int, value types.CompleteCodableValue) packet.PacketErr {
-	if s, ok := m.Structures[structure]; ok {
-		correctedIndex := 0
-		if index != nil {
-			correctedIndex = *index - 1
+// Next returns the first object after structure.objectIID.index, with IIDs
+// ordered by structure, then object and then index like SNMP's GetNext.
+// Counters like the number of rows, which use index 0, are skipped, and so are
+// the objects outside view.
+func (m *MIB) Next(view *View, structure, objectIID, index int) (types.IdValuePair, packet.PacketErr) {
+	structureIIDs := make([]int, 0, len(m.Structures))
+	for sIID := range m.Structures {
+		if sIID >= structure {
+			structureIIDs = append(structureIIDs, sIID)
+		}
+	}
+	sort.Ints(structureIIDs)
+	for _, sIID := range structureIIDs {
+		dimensions := m.Structures[sIID].GetDimensions()
+		objectIIDs := make([]int, 0, len(dimensions))
+		for oIID := range dimensions {
+			if sIID > structure || oIID >= objectIID {
+				objectIIDs = append(objectIIDs, oIID)
+			}
+		}
+		sort.Ints(objectIIDs)
+		for _, oIID := range objectIIDs {
+			first := 1
+			if sIID == structure && oIID == objectIID {
+				first = max(index+1, 1)
+			}
+			for i := first; i <= dimensions[oIID]; i++ {
+				if view.Contains(sIID, oIID, i) {
+					return m.Get(view, sIID, oIID, &i)
+				}
+			}
 		}
+	}
+	return types.IdValuePair{}, packet.ErrorEndOfMib
+}
+
+func (m *MIB) Set(view *View, structure, objectIID int, index *int, value types.CompleteCodableValue) packet.PacketErr {
+	s, correctedIndex, pErr := m.locate(view, structure, objectIID, index)
+	if pErr != 0 {
+		return pErr
+	}
+	return s.Set(objectIID, correctedIndex, value)
+}
+
+// locate finds the structure and the 0 based index of an object to be set,
+// the first one when index is nil, as long as view contains it.
+func (m *MIB) locate(view *View, structure, objectIID int, index *int) (StructureI, int, packet.PacketErr) {
+	correctedIndex := 0
+	if index != nil {
+		correctedIndex = *index - 1
+	}
+	if !view.Contains(structure, objectIID, correctedIndex+1) {
+		return nil, 0, packet.ErrorObjectIdDoesntExist
+	}
+	if s, ok := m.Structures[structure]; ok {
 		if objectIID == 0 {
-			return packet.ErrorInvalidIID
+			return nil, 0, packet.ErrorInvalidIID
 		} else if correctedIndex < 0 || correctedIndex >= s.Count(objectIID) {
-			return packet.ErrorIndexOutOfRange
+			return nil, 0, packet.ErrorIndexOutOfRange
+		}
+		return s, correctedIndex, 0
+	}
+	return nil, 0, packet.ErrorStructureDoesntExist
+}
+
+type pendingWrite struct {
+	structure StructureI
+	objectIID int
+	index     int
+	value     types.CompleteCodableValue
+	old       *types.CompleteCodableValue
+}
+
+// SetAll applies the values of every pair or of none of them. They are all
+// validated before the first one is written, and if writing one still fails
+// the ones already written are restored. When conditions is given, the value of
+// each of its entries must also match the current value of the pair in the
+// same position. Pairs outside view can't be set. The returned errors point to
+// the failing pairs, counting from 1.
+func (m *MIB) SetAll(view *View, pairs, conditions []types.IdValuePair) []packet.ErrorEntry {
+	m.setLock.Lock()
+	defer m.setLock.Unlock()
+	errorList := make([]packet.ErrorEntry, 0)
+	writes := make([]pendingWrite, len(pairs))
+	for i, pair := range pairs {
+		pErr := packet.PacketErr(packet.ErrorUnmatchedIIDValueList)
+		if pair.Value != nil {
+			iid := pair.IID.Value.(*CodableValues.IID)
+			writes[i] = pendingWrite{objectIID: iid.Object, value: *pair.Value}
+			writes[i].structure, writes[i].index, pErr = m.locate(view, iid.Structure, iid.Object, iid.FirstIndex)
+			if pErr == 0 {
+				pErr = writes[i].structure.Validate(iid.Object, writes[i].index, *pair.Value)
+			}
+			if pErr == 0 && i < len(conditions) {
+				pErr = writes[i].checkCondition(conditions[i].Value)
+			}
+		}
+		if pErr != 0 {
+			errorList = append(errorList, packet.ErrorEntry{Index: i + 1, Code: pErr})
+		}
+	}
+	if len(errorList) > 0 {
+		return errorList
+	}
+	unlock := m.lockStructures(writes)
+	defer unlock()
+	for i := range writes {
+		w := &writes[i]
+		old, pErr := w.structure.Get(w.objectIID, w.index)
+		if pErr == 0 {
+			pErr = w.structure.Set(w.objectIID, w.index, w.value)
+		}
+		if pErr != 0 {
+			for j := i - 1; j >= 0; j-- {
+				writes[j].structure.Update(writes[j].objectIID, writes[j].index, *writes[j].old)
+			}
+			return []packet.ErrorEntry{{Index: i + 1, Code: pErr}}
+		}
+		w.old = old
+	}
+	return errorList
+}
+
+// checkCondition tells if the object to be written still has the expected
+// value. Null or missing conditions always hold.
+func (w pendingWrite) checkCondition(expected *types.CompleteCodableValue) packet.PacketErr {
+	if expected == nil || expected.DataType == 'N' {
+		return 0
+	}
+	current, pErr := w.structure.Get(w.objectIID, w.index)
+	if pErr != 0 {
+		return pErr
+	}
+	expectedTs, expectingTs := expected.Value.(*CodableValues.Timestamp)
+	if _, isTs := current.Value.(*CodableValues.Timestamp); expectingTs && !isTs {
+		lastChange, ok := w.structure.LastChange(w.index)
+		if !ok {
+			return packet.ErrorInvalidDataType
 		}
+		current = lastChange
+	}
+	if currentTs, isTs := current.Value.(*CodableValues.Timestamp); expectingTs && isTs {
+		// Timestamps only keep their milliseconds on the wire
+		if currentTs.Ts.UnixMilli() != expectedTs.Ts.UnixMilli() {
+			return packet.ErrorConditionFailed
+		}
+		return 0
+	}
+	if !current.Equals(expected) {
+		return packet.ErrorConditionFailed
+	}
+	return 0
+}
 
-		return s.Set(objectIID, correctedIndex, value)
+// lockStructures write locks every structure changed by writes, in the order
+// of their IIDs, so nobody reads them while only part of a Set is applied.
+func (m *MIB) lockStructures(writes []pendingWrite) func() {
+	structureIIDs := make([]int, 0)
+	for _, w := range writes {
+		if !slices.Contains(structureIIDs, w.structure.GetStructureIID()) {
+			structureIIDs = append(structureIIDs, w.structure.GetStructureIID())
+		}
+	}
+	sort.Ints(structureIIDs)
+	for _, sIID := range structureIIDs {
+		m.Structures[sIID].Lock()
+	}
+	return func() {
+		for _, sIID := range structureIIDs {
+			m.Structures[sIID].Unlock()
+		}
 	}
-	return packet.ErrorStructureDoesntExist
 }
 
+// Update stores the values of a response or notification. When it carries the
+// number of rows of an object, a GetBulk request for every column of that
+// structure is returned so the rows can be fetched.
 func (m *MIB) Update(r packet.LSNMPvS_Packet) (*packet.LSNMPvS_Packet, error, bool) {
-	needsNewGet := false
-	iidListToGet := make(types.CodableList, 0)
+	rowsToGet := make(map[int]int)
 	for _, idValuePair := range r.GetIidValuePairList() {
 		iid := idValuePair.IID.Value.(*CodableValues.IID)
 		value := idValuePair.Value
+		if value == nil || value.DataType == 'N' {
+			continue
+		}
 		if s, ok := m.Structures[iid.Structure]; ok {
 			correctedIndex := 0
 			if iid.FirstIndex != nil {
 				correctedIndex = *iid.FirstIndex - 1
 			}
 			if correctedIndex == -1 {
-				s.PopulateObjectIDWithLength(iid.Object, value.Value.(*CodableValues.CodableInt).Value)
-				needsNewGet = true
-				numberOfObjects := s.Len()
-				for i := 1; i <= numberOfObjects; i++ {
-					iidListToGet.Append(types.NewCodableIID(iid.Structure, i, []int{0,0}))
-				}
+				rows := value.Value.(*CodableValues.CodableInt).Value
+				s.PopulateObjectIDWithLength(iid.Object, rows)
+				rowsToGet[iid.Structure] = max(rowsToGet[iid.Structure], rows)
 			} else {
+				s.Lock()
 				s.Update(iid.Object, correctedIndex, *value)
+				s.Unlock()
 			}
 		}
 	}
-	if needsNewGet {
-		return packet.NewGetRequestPacket(iidListToGet), nil, true
+	if len(rowsToGet) > 0 {
+		structureIIDs := make([]int, 0, len(rowsToGet))
+		for sIID := range rowsToGet {
+			structureIIDs = append(structureIIDs, sIID)
+		}
+		sort.Ints(structureIIDs)
+		iidListToGet := make(types.CodableList)
+		maxRepetitions := 0
+		for _, sIID := range structureIIDs {
+			for i := 1; i <= m.Structures[sIID].Len(); i++ {
+				iidListToGet.Append(types.NewCodableIID(sIID, i, []int{0}))
+			}
+			maxRepetitions = max(maxRepetitions, rowsToGet[sIID])
+		}
+		p := packet.NewGetBulkRequestPacket(iidListToGet, 0, maxRepetitions, 0)
+		p.SetVersion(r.GetVersion())
+		return p, nil, true
 	}
 	return nil, nil, false
 }
@@ -199,7 +456,11 @@ func (m *MIB) StartNotificationLoop(sub chan struct{}) {
 				for {
 					time.Sleep(g.GetNotificationRate())
 					uptime := m.GetUptime()
-					g.SendNotifications(uptime)
+					if g.Informs {
+						go m.SendInform(g, uptime, sub)
+					} else {
+						g.SendNotifications(m.Transport, m.NotificationAddrs(g), uptime)
+					}
 					sub <- struct{}{}
 				}
 			}(group)
@@ -207,10 +468,52 @@ func (m *MIB) StartNotificationLoop(sub chan struct{}) {
 	}
 }
 
+// NotificationAddrs returns where the notifications of g are sent.
+func (m *MIB) NotificationAddrs(g *Group) []*net.UDPAddr {
+	if m.Targets != nil {
+		if addrs, ok := m.Targets.NotificationAddrs(g.StructureIID); ok {
+			return addrs
+		}
+	}
+	return m.Network.NotificationAddrs()
+}
+
+// SendInform sends an acknowledged notification with the objects of g,
+// resending the same packet with exponential backoff until a manager
+// acknowledges it or the retries of the group run out.
+func (m *MIB) SendInform(g *Group, uptime *types.CompleteCodableValue, sub chan struct{}) {
+	p := packet.NewInformPacket(g.NotificationEntries(), uptime)
+	acked := m.Pending.add(p.GetMessageID())
+	defer m.Pending.remove(p.GetMessageID())
+	g.IncrementCounter(g.InformsSentOid)
+	frames := p.EncodeFrames()
+	timeout := g.InformTimeout
+	for attempt := 0; attempt <= g.InformRetries; attempt++ {
+		if err := netfuncs.SendAll(m.Transport, m.NotificationAddrs(g), frames...); err != nil {
+			m.Logger.LogError("Error sending inform: "+err.Error(), "Notification")
+		}
+		select {
+		case <-acked:
+			m.Logger.LogDebug(fmt.Sprintf("Inform %s acknowledged after %d retries", p.GetMessageID(), attempt), "Notification")
+			return
+		case <-time.After(timeout):
+		}
+		timeout *= 2
+	}
+	g.IncrementCounter(g.InformsUnacknowledgedOid)
+	m.Logger.LogError(fmt.Sprintf("Inform %s wasn't acknowledged after %d retries", p.GetMessageID(), g.InformRetries), "Notification")
+	sub <- struct{}{}
+}
+
 func (m *MIB) GetUptime() *types.CompleteCodableValue {
 	return types.NewCodableDuration(time.Since(m.StartTime))
 }
 
+// HandleRequest verifies r and passes it to handler, sending back the answer
+// it returns. A request that fails, whether it doesn't verify, is a replay,
+// isn't authorized or its handler fails, is answered with a response carrying
+// the error at index 0. Failed responses, notifications and informs are only
+// logged.
 func (m *MIB) HandleRequest(r packet.LSNMPvS_Packet, remAddr net.UDPAddr, sub chan struct{}, handler HandlerI) {
 	var (
 		handlingErr error
@@ -218,8 +521,18 @@ func (m *MIB) HandleRequest(r packet.LSNMPvS_Packet, remAddr net.UDPAddr, sub ch
 		respond     bool
 	)
 	rType, verifyErr := r.VerifyAndGetType()
+	// Acknowledgements of informs share the message id of the inform, which
+	// was already seen when it's received back from the broadcast
+	delivered := verifyErr == 0 && rType == 'R' && m.Pending.Deliver(r)
 	duplicatePacketErr := m.Packets.AddPacket(r)
+	if delivered {
+		duplicatePacketErr = 0
+	}
+	var authErr packet.PacketErr
 	if verifyErr == 0 && duplicatePacketErr == 0 {
+		authErr = m.Access.Authorize(r)
+	}
+	if verifyErr == 0 && duplicatePacketErr == 0 && authErr == 0 {
 		var handlingFunc func(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool)
 		loggingText := ""
 		switch rType {
@@ -229,12 +542,24 @@ func (m *MIB) HandleRequest(r packet.LSNMPvS_Packet, remAddr net.UDPAddr, sub ch
 		case 'S':
 			loggingText = "Received Set Packet"
 			handlingFunc = handler.HandleSet
+		case 'C':
+			loggingText = "Received Conditional Set Packet"
+			handlingFunc = handler.HandleSet
 		case 'R':
 			loggingText = "Received Response Packet"
 			handlingFunc = handler.HandleResponse
 		case 'N':
 			loggingText = "Received Notification Packet"
 			handlingFunc = handler.HandleNotification
+		case 'X':
+			loggingText = "Received GetNext Packet"
+			handlingFunc = handler.HandleGetNext
+		case 'B':
+			loggingText = "Received GetBulk Packet"
+			handlingFunc = handler.HandleGetBulk
+		case 'I':
+			loggingText = "Received Inform Packet"
+			handlingFunc = handler.HandleInform
 		default:
 			m.Logger.LogError("Packet type error that should not happen(Unhandled Valid Response Type)", "Request")
 			return
@@ -245,26 +570,42 @@ func (m *MIB) HandleRequest(r packet.LSNMPvS_Packet, remAddr net.UDPAddr, sub ch
 		var pErr packet.PacketErr
 		if verifyErr != 0 {
 			pErr = verifyErr
-		} else {
+		} else if duplicatePacketErr != 0 {
 			pErr = duplicatePacketErr
+		} else {
+			pErr = authErr
 		}
 		respPacket, handlingErr, respond = pErr.Compile(r)
 	}
 	reqDescr := fmt.Sprintf("%c from %s", rType, remAddr.String())
 	if handlingErr != nil {
 		m.Logger.LogError("Error handling "+reqDescr+": "+handlingErr.Error(), "Request")
-		return
+		// Only requests are answered with errors, answering a response or a
+		// notification could start an endless exchange of errors
+		if !respond || !r.IsRequest() {
+			return
+		}
 	}
 	if !respond {
 		sub <- struct{}{}
 		return
 	}
-	remAddr.Port = 12345
-	err := netfuncs.Send(&remAddr, []byte(respPacket.Encode()))
+	remAddr = m.Network.replyAddr(remAddr)
+	encoded := respPacket.Encode()
+	if maxSize := packet.GetLimits().MaxResponseSize; len(encoded) > maxSize {
+		m.Logger.LogError(fmt.Sprintf("Response to %s has %d bytes, more than the limit of %d", reqDescr, len(encoded), maxSize), "Request")
+		respPacket, handlingErr, _ = packet.PacketErr(packet.ErrorTooBig).Compile(r)
+		encoded = respPacket.Encode()
+	}
+	err := m.Transport.Send(&remAddr, packet.FragmentFrame(encoded, respPacket.GetMessageID())...)
 	if err != nil {
 		m.Logger.LogError("Error sending response to "+reqDescr+": "+err.Error(), "Request")
 		return
 	}
+	if handlingErr != nil {
+		sub <- struct{}{}
+		return
+	}
 	m.Logger.LogInfo(reqDescr+" Handled Successfully", "Request")
 	sub <- struct{}{}
 }
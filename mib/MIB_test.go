@@ -0,0 +1,449 @@
+package mib
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eivarin/LSNMPvS-DomoticSystem/CustomLogger"
+	netfuncs "github.com/eivarin/LSNMPvS-DomoticSystem/NetFuncs"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+)
+
+type testGroupObjects struct {
+	GroupObjects
+	// failOn makes the commit of that object fail after it was validated.
+	failOn int
+}
+
+func (g testGroupObjects) GetGroupObjects() GroupObjects {
+	return g.GroupObjects
+}
+
+func (g testGroupObjects) Set(objectIID int, index int, value types.CompleteCodableValue) packet.PacketErr {
+	if objectIID == g.failOn {
+		return packet.ErrorValueOutOfRange
+	}
+	return g.GroupObjects.Set(objectIID, index, value)
+}
+
+func (g testGroupObjects) CheckNewValueValidity(objectIID, index int, value types.CompleteCodableValue) packet.PacketErr {
+	return 0
+}
+
+type testEntry struct {
+	TableEntry
+}
+
+func (e testEntry) CheckNewValueValidity(value types.CompleteCodableValue) packet.PacketErr {
+	if v := value.Value.(*CodableValues.CodableInt).Value; v < 0 || v > 10 {
+		return packet.ErrorValueOutOfRange
+	}
+	return 0
+}
+
+func (e testEntry) Copy() TableEntryI {
+	return testEntry{e.TableEntry.Copy()}
+}
+
+func newTestEntry(name string, status int) testEntry {
+	id := NewObject("id", 1, "", false, *types.NewCodableString(name))
+	st := NewObject("status", 2, "", true, *types.NewCodableInt(status))
+	return testEntry{NewTableEntry([]*Object{&id, &st})}
+}
+
+// newTestMIB has a group (1) with a read only object 1 and writable objects 2
+// and 3, and a table (2) with two rows whose status can be set from 0 to 10.
+func newTestMIB(failOn int) *MIB {
+	name := NewObject("name", 1, "", false, *types.NewCodableString("test"))
+	rate := NewObject("rate", 2, "", true, *types.NewCodableInt(5))
+	mode := NewObject("mode", 3, "", true, *types.NewCodableInt(1))
+	group := &Group{
+		Structure: NewStructure("group", 1, ""),
+		Objects:   testGroupObjects{NewGroupObjects([]*Object{&name, &rate, &mode}), failOn},
+	}
+	table := &Table{
+		Structure: NewStructure("table", 2, ""),
+		Columns:   newTestEntry("", 0),
+		Objects:   []TableEntryI{newTestEntry("a", 1), newTestEntry("b", 2)},
+	}
+	m := NewMIB(nil, []StructureI{group, table})
+	return &m
+}
+
+func setPair(structure, object int, indexes []int, value *types.CompleteCodableValue) types.IdValuePair {
+	return types.IdValuePair{IID: types.NewCodableIID(structure, object, indexes), Value: value}
+}
+
+func checkInt(t *testing.T, m *MIB, structure, object, index, expected int) {
+	t.Helper()
+	pair, pErr := m.Get(nil, structure, object, &index)
+	if pErr != 0 {
+		t.Fatalf("Get %d.%d.%d: %v", structure, object, index, pErr)
+	}
+	if v := pair.Value.Value.(*CodableValues.CodableInt).Value; v != expected {
+		t.Errorf("%d.%d.%d is %d, expected %d", structure, object, index, v, expected)
+	}
+}
+
+func checkErrors(t *testing.T, errorList []packet.ErrorEntry, expected []packet.ErrorEntry) {
+	t.Helper()
+	if len(errorList) != len(expected) {
+		t.Fatalf("Got errors %v, expected %v", errorList, expected)
+	}
+	for i := range expected {
+		if errorList[i] != expected[i] {
+			t.Errorf("Got error %v, expected %v", errorList[i], expected[i])
+		}
+	}
+}
+
+func TestSetAllValid(t *testing.T) {
+	m := newTestMIB(0)
+	errorList := m.SetAll(nil, []types.IdValuePair{
+		setPair(1, 2, []int{}, types.NewCodableInt(7)),
+		setPair(2, 2, []int{2}, types.NewCodableInt(9)),
+		setPair(1, 3, []int{1}, types.NewCodableInt(0)),
+	}, nil)
+	checkErrors(t, errorList, nil)
+	checkInt(t, m, 1, 2, 1, 7)
+	checkInt(t, m, 2, 2, 2, 9)
+	checkInt(t, m, 1, 3, 1, 0)
+}
+
+func TestSetAllMixed(t *testing.T) {
+	cases := []struct {
+		name     string
+		pairs    []types.IdValuePair
+		expected []packet.ErrorEntry
+	}{
+		{"read only", []types.IdValuePair{
+			setPair(1, 2, []int{}, types.NewCodableInt(7)),
+			setPair(1, 1, []int{}, types.NewCodableString("other")),
+			setPair(2, 2, []int{1}, types.NewCodableInt(3)),
+		}, []packet.ErrorEntry{{Index: 2, Code: packet.ErrorChangingReadOnlyValue}}},
+		{"out of range", []types.IdValuePair{
+			setPair(2, 2, []int{1}, types.NewCodableInt(3)),
+			setPair(1, 2, []int{}, types.NewCodableInt(7)),
+			setPair(2, 2, []int{2}, types.NewCodableInt(11)),
+		}, []packet.ErrorEntry{{Index: 3, Code: packet.ErrorValueOutOfRange}}},
+		{"several", []types.IdValuePair{
+			setPair(3, 1, []int{}, types.NewCodableInt(1)),
+			setPair(1, 2, []int{}, types.NewCodableInt(7)),
+			setPair(2, 2, []int{3}, types.NewCodableInt(1)),
+			setPair(1, 3, []int{}, types.NewCodableString("wrong")),
+			setPair(1, 3, []int{}, nil),
+		}, []packet.ErrorEntry{
+			{Index: 1, Code: packet.ErrorStructureDoesntExist},
+			{Index: 3, Code: packet.ErrorIndexOutOfRange},
+			{Index: 4, Code: packet.ErrorInvalidDataType},
+			{Index: 5, Code: packet.ErrorUnmatchedIIDValueList},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := newTestMIB(0)
+			checkErrors(t, m.SetAll(nil, c.pairs, nil), c.expected)
+			checkInt(t, m, 1, 2, 1, 5)
+			checkInt(t, m, 1, 3, 1, 1)
+			checkInt(t, m, 2, 2, 1, 1)
+			checkInt(t, m, 2, 2, 2, 2)
+		})
+	}
+}
+
+func TestSetAllRollback(t *testing.T) {
+	m := newTestMIB(3)
+	errorList := m.SetAll(nil, []types.IdValuePair{
+		setPair(1, 2, []int{}, types.NewCodableInt(7)),
+		setPair(2, 2, []int{1}, types.NewCodableInt(4)),
+		setPair(1, 3, []int{}, types.NewCodableInt(0)),
+	}, nil)
+	checkErrors(t, errorList, []packet.ErrorEntry{{Index: 3, Code: packet.ErrorValueOutOfRange}})
+	checkInt(t, m, 1, 2, 1, 5)
+	checkInt(t, m, 2, 2, 1, 1)
+	checkInt(t, m, 1, 3, 1, 1)
+}
+
+func TestSetAllConditions(t *testing.T) {
+	m := newTestMIB(0)
+	pairs := []types.IdValuePair{
+		setPair(1, 2, []int{}, types.NewCodableInt(7)),
+		setPair(2, 2, []int{2}, types.NewCodableInt(9)),
+	}
+	conditions := []types.IdValuePair{
+		setPair(1, 2, []int{}, types.NewCodableInt(5)),
+		setPair(2, 2, []int{2}, types.NewCodableInt(3)),
+	}
+	checkErrors(t, m.SetAll(nil, pairs, conditions), []packet.ErrorEntry{{Index: 2, Code: packet.ErrorConditionFailed}})
+	checkInt(t, m, 1, 2, 1, 5)
+	checkInt(t, m, 2, 2, 2, 2)
+	conditions[1].Value = types.NewCodableInt(2)
+	checkErrors(t, m.SetAll(nil, pairs, conditions), nil)
+	checkInt(t, m, 1, 2, 1, 7)
+	checkInt(t, m, 2, 2, 2, 9)
+	// The second manager still expects the values seen before the first Set
+	checkErrors(t, m.SetAll(nil, pairs, conditions), []packet.ErrorEntry{
+		{Index: 1, Code: packet.ErrorConditionFailed},
+		{Index: 2, Code: packet.ErrorConditionFailed},
+	})
+}
+
+func TestRecPacketListReplay(t *testing.T) {
+	r := NewRecPacketList()
+	p := packet.NewGetRequestPacket(types.CodableList{})
+	now := time.Now()
+	if pErr := r.addPacketAt(*p, now); pErr != 0 {
+		t.Fatalf("Fresh packet rejected: %v", pErr)
+	}
+	if pErr := r.addPacketAt(*p, now.Add(time.Second)); pErr != packet.ErrorDuplicateMessageId {
+		t.Errorf("Duplicate packet got %v", pErr)
+	}
+	later := now.Add(DefaultReplayWindow + time.Second)
+	if pErr := r.addPacketAt(*p, later); pErr != packet.ErrorDuplicateMessageId {
+		t.Errorf("Packet replayed after the window got %v", pErr)
+	}
+	if len(r.packetsByID) != 0 {
+		t.Errorf("%d message ids still remembered after the window", len(r.packetsByID))
+	}
+	early := packet.NewGetRequestPacket(types.CodableList{})
+	if pErr := r.addPacketAt(*early, now.Add(-DefaultReplayWindow-time.Second)); pErr != packet.ErrorDuplicateMessageId {
+		t.Errorf("Packet from the future got %v", pErr)
+	}
+}
+
+func TestRecPacketListReplayWithoutSendTime(t *testing.T) {
+	r := NewRecPacketList()
+	n := packet.NewNotificationPacket(nil, types.NewCodableDuration(time.Minute))
+	now := time.Now()
+	if pErr := r.addPacketAt(*n, now); pErr != 0 {
+		t.Fatalf("Fresh notification rejected: %v", pErr)
+	}
+	if pErr := r.addPacketAt(*n, now.Add(time.Hour)); pErr != packet.ErrorDuplicateMessageId {
+		t.Errorf("Notification replayed after the window got %v", pErr)
+	}
+	for i := 0; i < maxUntimedIDs; i++ {
+		r.addPacketAt(*packet.NewNotificationPacket(nil, types.NewCodableDuration(time.Minute)), now)
+	}
+	if len(r.packetsByID) != maxUntimedIDs || len(r.untimedIDs) != maxUntimedIDs {
+		t.Errorf("%d message ids remembered, expected %d", len(r.packetsByID), maxUntimedIDs)
+	}
+	if pErr := r.addPacketAt(*n, now); pErr != 0 {
+		t.Errorf("Oldest notification still remembered: %v", pErr)
+	}
+}
+
+func TestAccessControl(t *testing.T) {
+	access := AccessControl{
+		"monitor": {Secret: "read-secret", Access: ReadAccess},
+		"admin":   {Secret: "write-secret", Access: WriteAccess},
+	}
+	get := packet.NewGetRequestPacket(types.CodableList{})
+	set := packet.NewSetResponsePacket(types.CodableList{}, types.CodableList{})
+	cases := []struct {
+		r           *packet.LSNMPvS_Packet
+		credentials packet.Credentials
+		expected    packet.PacketErr
+	}{
+		{get, packet.Credentials{User: "monitor", Secret: "read-secret"}, 0},
+		{set, packet.Credentials{User: "monitor", Secret: "read-secret"}, packet.ErrorAuthorization},
+		{set, packet.Credentials{User: "admin", Secret: "write-secret"}, 0},
+		{get, packet.Credentials{User: "admin", Secret: "read-secret"}, packet.ErrorAuthorization},
+		{get, packet.Credentials{User: "guest", Secret: ""}, packet.ErrorAuthorization},
+		{get, packet.Credentials{}, packet.ErrorAuthorization},
+	}
+	for _, c := range cases {
+		c.r.SetCredentials(c.credentials)
+		if pErr := access.Authorize(*c.r); pErr != c.expected {
+			t.Errorf("%c from %q got %v, expected %v", c.r.GetType(), c.credentials.User, pErr, c.expected)
+		}
+	}
+	response := get.NewResponsePacket(nil, types.NewCodableDuration(0))
+	if pErr := access.Authorize(*response); pErr != 0 {
+		t.Errorf("Response without credentials got %v", pErr)
+	}
+	if pErr := (AccessControl{}).Authorize(*set); pErr != 0 {
+		t.Errorf("Agent without access configured rejected a Set with %v", pErr)
+	}
+}
+
+func TestViews(t *testing.T) {
+	// The whole group but its object 3, and the first row of the table
+	view := &View{Name: "guest", Rules: []ViewRule{
+		{Subtree: []int{1}, Include: true},
+		{Subtree: []int{1, 3}, Include: false},
+		{Subtree: []int{2, 1, 1}, Include: true},
+		{Subtree: []int{2, 2, 1}, Include: true},
+		{Subtree: []int{2, 2, 1}, Include: false},
+	}}
+	m := newTestMIB(0)
+	one := 1
+	if _, pErr := m.Get(view, 1, 2, &one); pErr != 0 {
+		t.Errorf("Included object got %v", pErr)
+	}
+	if _, pErr := m.Get(view, 1, 3, &one); pErr != packet.ErrorObjectIdDoesntExist {
+		t.Errorf("Excluded object got %v", pErr)
+	}
+	if _, pErr := m.Get(view, 2, 2, &one); pErr != packet.ErrorObjectIdDoesntExist {
+		t.Errorf("Object excluded on a tie got %v", pErr)
+	}
+	expected := [][3]int{{1, 1, 1}, {1, 2, 1}, {2, 1, 1}}
+	current := [3]int{0, 0, 0}
+	for i := 0; ; i++ {
+		pair, pErr := m.Next(view, current[0], current[1], current[2])
+		if pErr == packet.ErrorEndOfMib {
+			if i != len(expected) {
+				t.Errorf("Walk ended after %d objects, expected %d", i, len(expected))
+			}
+			break
+		}
+		iid := pair.IID.Value.(*CodableValues.IID)
+		current = [3]int{iid.Structure, iid.Object, *iid.FirstIndex}
+		if i >= len(expected) || current != expected[i] {
+			t.Fatalf("Walk got %v as object %d", current, i+1)
+		}
+	}
+	errorList := m.SetAll(view, []types.IdValuePair{
+		setPair(1, 2, []int{}, types.NewCodableInt(7)),
+		setPair(1, 3, []int{}, types.NewCodableInt(0)),
+	}, nil)
+	checkErrors(t, errorList, []packet.ErrorEntry{{Index: 2, Code: packet.ErrorObjectIdDoesntExist}})
+	checkInt(t, m, 1, 2, 1, 5)
+}
+
+// TestConcurrentGetAndSet walks a table while it's being set, which must
+// neither race nor deadlock.
+func TestConcurrentGetAndSet(t *testing.T) {
+	m := newTestMIB(0)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				m.SetAll(nil, []types.IdValuePair{setPair(2, 2, []int{1 + i%2}, types.NewCodableInt(i%10))}, nil)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				m.Next(nil, 2, 2, i%2)
+				one := 1
+				m.Get(nil, 2, 2, &one)
+			}
+		}()
+		wg.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Get and Set deadlocked")
+	}
+}
+
+// TestViewsWithoutIndex checks that setting an object without an index, which
+// writes its first row, is checked against that row.
+func TestViewsWithoutIndex(t *testing.T) {
+	view := &View{Name: "guest", Rules: []ViewRule{
+		{Subtree: []int{2}, Include: true},
+		{Subtree: []int{2, 2, 1}, Include: false},
+	}}
+	m := newTestMIB(0)
+	errorList := m.SetAll(view, []types.IdValuePair{setPair(2, 2, []int{}, types.NewCodableInt(7))}, nil)
+	checkErrors(t, errorList, []packet.ErrorEntry{{Index: 1, Code: packet.ErrorObjectIdDoesntExist}})
+	if pErr := m.Set(view, 2, 2, nil, *types.NewCodableInt(7)); pErr != packet.ErrorObjectIdDoesntExist {
+		t.Errorf("Set of an excluded first row got %v", pErr)
+	}
+	checkInt(t, m, 2, 2, 1, 1)
+	two := 2
+	if pErr := m.Set(view, 2, 2, &two, *types.NewCodableInt(7)); pErr != 0 {
+		t.Errorf("Set of an included row got %v", pErr)
+	}
+	checkInt(t, m, 2, 2, 2, 7)
+}
+
+// failingHandler fails every packet it handles with ErrorTooBig.
+type failingHandler struct{}
+
+func (failingHandler) fail(r packet.LSNMPvS_Packet) (*packet.LSNMPvS_Packet, error, bool) {
+	return packet.PacketErr(packet.ErrorTooBig).Compile(r)
+}
+
+func (h failingHandler) HandleGet(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
+	return h.fail(r)
+}
+
+func (h failingHandler) HandleSet(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
+	return h.fail(r)
+}
+
+func (h failingHandler) HandleResponse(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
+	return h.fail(r)
+}
+
+func (h failingHandler) HandleNotification(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
+	return h.fail(r)
+}
+
+func (h failingHandler) HandleGetNext(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
+	return h.fail(r)
+}
+
+func (h failingHandler) HandleGetBulk(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
+	return h.fail(r)
+}
+
+func (h failingHandler) HandleInform(r packet.LSNMPvS_Packet, addr *net.UDPAddr) (*packet.LSNMPvS_Packet, error, bool) {
+	return h.fail(r)
+}
+
+// TestHandleRequestAnswersFailedRequests checks that a request that fails is
+// answered with its error while a response that fails isn't answered.
+func TestHandleRequestAnswersFailedRequests(t *testing.T) {
+	network := netfuncs.NewMemoryNetwork()
+	m := newTestMIB(0)
+	logger := CustomLogger.NewCustomLogger()
+	m.Logger = &logger
+	m.Network.ReplyToSource = true
+	var err error
+	if m.Transport, err = network.Listen(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: DefaultPort}); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Transport.Close()
+	client, err := network.Listen(&net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: DefaultPort})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	sub := make(chan struct{}, 2)
+
+	iidList := types.CodableList{}
+	iidList.Append(types.NewCodableIID(1, 1, nil))
+	response := packet.NewGetRequestPacket(iidList).NewResponsePacket(nil, m.GetUptime())
+	m.HandleRequest(*response, *client.LocalAddr(), sub, failingHandler{})
+	request := packet.NewGetRequestPacket(iidList)
+	m.HandleRequest(*request, *client.LocalAddr(), sub, failingHandler{})
+
+	buffer := make([]byte, packet.MaxPacketSize)
+	n, from, err := client.Receive(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, complete, err := packet.NewReassembler(packet.DefaultFragmentTimeout).Add(from.String(), buffer[:n])
+	if err != nil || !complete {
+		t.Fatalf("answer can't be reassembled: %v", err)
+	}
+	answer := packet.LSNMPvS_Packet{}
+	if _, err := answer.Decode(frame); err != nil {
+		t.Fatal(err)
+	}
+	if answer.GetMessageID() != request.GetMessageID() {
+		t.Errorf("the first answer is to %s, expected the one to the request %s", answer.GetMessageID(), request.GetMessageID())
+	}
+	checkErrors(t, answer.GetErrors(), []packet.ErrorEntry{{Index: 0, Code: packet.ErrorTooBig}})
+}
@@ -0,0 +1,72 @@
+package mib
+
+import (
+	"net"
+	"strconv"
+
+	netfuncs "github.com/eivarin/LSNMPvS-DomoticSystem/NetFuncs"
+)
+
+// DefaultPort is the port every device uses unless configured otherwise.
+const DefaultPort = 12345
+
+// Network is where a device listens and the ports it sends packets to.
+// Agents listen for requests on RequestPort, answer them where they came from
+// and send notifications to NotificationPort, managers listen on ResponsePort
+// and NotificationPort and send requests to agents at RequestPort.
+//
+// Notifications without targets of their own go to NotificationGroup, and are
+// broadcast when there's no group.
+type Network struct {
+	// ListenAddress is the address listened on, every one when it's empty.
+	ListenAddress    string
+	RequestPort      int
+	ResponsePort     int
+	NotificationPort int
+	// ReplyToSource answers each request at the address it came from instead
+	// of at ResponsePort. It's on by default, so answers reach managers behind
+	// NAT and tools sending from any port; turning it off only suits managers
+	// that send requests from a port other than the ResponsePort they listen
+	// on.
+	ReplyToSource bool
+	// NotificationGroup is the multicast group agents send notifications to
+	// and managers join, nil to broadcast them
+	NotificationGroup *net.UDPAddr
+	// NotificationHops is how many routers notifications sent to
+	// NotificationGroup can cross, 0 to keep the default of the system
+	NotificationHops int
+}
+
+func DefaultNetwork() Network {
+	return Network{
+		RequestPort:      DefaultPort,
+		ResponsePort:     DefaultPort,
+		NotificationPort: DefaultPort,
+		ReplyToSource:    true,
+	}
+}
+
+// Listen binds a transport with listen to port at the listen address.
+func (n Network) Listen(listen netfuncs.ListenFunc, port int) (netfuncs.Transport, error) {
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(n.ListenAddress, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	return listen(addr)
+}
+
+// NotificationAddrs returns where notifications without targets are sent.
+func (n Network) NotificationAddrs() []*net.UDPAddr {
+	if n.NotificationGroup != nil {
+		return []*net.UDPAddr{n.NotificationGroup}
+	}
+	return []*net.UDPAddr{{IP: net.IPv4bcast, Port: n.NotificationPort}}
+}
+
+// replyAddr returns where the answer to a packet from remAddr goes.
+func (n Network) replyAddr(remAddr net.UDPAddr) net.UDPAddr {
+	if !n.ReplyToSource {
+		remAddr.Port = n.ResponsePort
+	}
+	return remAddr
+}
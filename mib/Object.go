@@ -35,11 +35,22 @@ func (o *Object) Get() (*types.CompleteCodableValue, packet.PacketErr) {
 }
 
 func (o *Object) Set(newValue types.CompleteCodableValue) packet.PacketErr {
-	if o.AllowWrite {
-		o.Update(newValue)
-		return 0
+	if err := o.Validate(newValue); err != 0 {
+		return err
 	}
-	return packet.ErrorChangingReadOnlyValue
+	o.Update(newValue)
+	return 0
+}
+
+// Validate checks if newValue can be set without setting it.
+func (o *Object) Validate(newValue types.CompleteCodableValue) packet.PacketErr {
+	if !o.AllowWrite {
+		return packet.ErrorChangingReadOnlyValue
+	}
+	if newValue.DataType != o.Value.DataType || newValue.Length != o.Value.Length {
+		return packet.ErrorInvalidDataType
+	}
+	return 0
 }
 
 func (o *Object) Update(newValue types.CompleteCodableValue) {
@@ -69,10 +69,20 @@ type StructureI interface {
 	GetStructureIID() int
 	GetDescription() string
 	Set(objectIID, index int, value types.CompleteCodableValue) packet.PacketErr
+	Validate(objectIID, index int, value types.CompleteCodableValue) packet.PacketErr
 	Update(objectIID, index int, value types.CompleteCodableValue)
 	PopulateObjectIDWithLength(objectIID int, length int)
 	RenderTableWithLipGloss(width int) string
 	Len() int
 	Count(objectIID int) int
 	GetDimensions() map[int]int
+	LastChange(index int) (*types.CompleteCodableValue, bool)
+	Lock()
+	Unlock()
+}
+
+// LastChangeI is implemented by group objects and table entries that keep the
+// time they were last changed, so conditional Sets can be made on it.
+type LastChangeI interface {
+	LastChange() *types.CompleteCodableValue
 }
@@ -1,6 +1,8 @@
 package mib
 
 import (
+	"slices"
+
 	"github.com/eivarin/LSNMPvS-DomoticSystem/packet"
 	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types"
 )
@@ -14,11 +16,17 @@ type TableEntryI interface {
 	Copy() TableEntryI
 }
 
+// ColumnValidatorI is implemented by table entries whose writable columns
+// take different values, to check value for the column objectIID.
+type ColumnValidatorI interface {
+	CheckColumnValue(objectIID int, value types.CompleteCodableValue) packet.PacketErr
+}
+
 type TableEntry map[int]*Object
 
 func (t TableEntry) Get(objectIID int) (*types.CompleteCodableValue, packet.PacketErr) {
 	if ok := t[objectIID]; ok != nil {
-		return t[objectIID].Value.Copy(), 0
+		return t[objectIID].Get()
 	} else {
 		return nil, packet.ErrorObjectIdDoesntExist
 	}
@@ -90,24 +98,54 @@ func (t *Table) Set(objectIID, index int, value types.CompleteCodableValue) pack
 	// if res == 0 {
 	// 	t.Objects[correctedIndex] = tEntry
 	// }
-	if err := t.Objects[index].CheckNewValueValidity(value); err != 0 {
+	if err := t.checkValue(objectIID, index, value); err != 0 {
 		return err
 	}
 	return t.Objects[index].Set(objectIID, value)
 }
 
+func (t *Table) checkValue(objectIID, index int, value types.CompleteCodableValue) packet.PacketErr {
+	if err := t.Objects[index].CheckNewValueValidity(value); err != 0 {
+		return err
+	}
+	if v, ok := t.Objects[index].(ColumnValidatorI); ok {
+		return v.CheckColumnValue(objectIID, value)
+	}
+	return 0
+}
+
+func (t *Table) Validate(objectIID, index int, value types.CompleteCodableValue) packet.PacketErr {
+	if err := t.checkValue(objectIID, index, value); err != 0 {
+		return err
+	}
+	object, ok := t.Objects[index].GetTableEntry()[objectIID]
+	if !ok {
+		return packet.ErrorObjectIdDoesntExist
+	}
+	return object.Validate(value)
+}
+
+func (t *Table) LastChange(index int) (*types.CompleteCodableValue, bool) {
+	if entry, ok := t.Objects[index].(LastChangeI); ok {
+		return entry.LastChange(), true
+	}
+	return nil, false
+}
+
+// Update stores value in the row at index, adding empty rows up to it. The
+// caller holds the lock of the table, since rows may be added.
 func (t *Table) Update(objectIID, index int, value types.CompleteCodableValue) {
 	for index >= len(t.Objects) {
-		newEntry := t.Columns.Copy()
-		t.AddRow(newEntry)
+		t.Objects = append(t.Objects, t.Columns.Copy())
 	}
 	t.Objects[index].Update(objectIID, value)
 }
 
 func (t *Table) PopulateObjectIDWithLength(objectIID int, length int){
-	for i:= t.Count(objectIID) ; i < length; i = t.Count(objectIID) {
-		newEntry := t.Columns.Copy()
-		t.AddRow(newEntry)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for len(t.Objects) < length {
+		t.Objects = append(t.Objects, t.Columns.Copy())
 	}
 }
 
@@ -127,12 +165,15 @@ func (t *Table) RenderTableWithLipGloss(width int) string {
 	for i := 1; i <= leng; i++ {
 		Titles = append(Titles, columnsTableEntry[i].Name)
 	}
-	for _, entry := range t.Objects {
+	t.lock.RLock()
+	entries := slices.Clone(t.Objects)
+	t.lock.RUnlock()
+	for _, entry := range entries {
 		var row []string
 		tEntry := entry.GetTableEntry()
 		for j := 1; j <= leng; j++ {
 			v, _ := tEntry.Get(j)
-			row = append(row, v.String())
+			row = append(row, v.Render())
 		}
 		Values = append(Values, row)
 	}
@@ -156,7 +197,7 @@ func (t *Table) GetDimensions() map[int]int {
 	defer t.lock.RUnlock()
 	res := make(map[int]int)
 	for _, entry := range t.Columns.GetTableEntry() {
-		res[entry.ObjectIID] = t.Count(entry.ObjectIID)
+		res[entry.ObjectIID] = len(t.Objects)
 	}
 	return res
 }
@@ -0,0 +1,173 @@
+package mib
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	netfuncs "github.com/eivarin/LSNMPvS-DomoticSystem/NetFuncs"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+)
+
+const DefaultRequestTimeout = 2 * time.Second
+
+// PendingRequests keeps the requests waiting for a response, indexed by
+// message id, so a response can be handed to whoever sent the request.
+type PendingRequests struct {
+	requests map[string]chan packet.LSNMPvS_Packet
+	lock     *sync.Mutex
+}
+
+func NewPendingRequests() PendingRequests {
+	return PendingRequests{
+		requests: make(map[string]chan packet.LSNMPvS_Packet),
+		lock:     &sync.Mutex{},
+	}
+}
+
+func (p *PendingRequests) add(messageId string) chan packet.LSNMPvS_Packet {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	c := make(chan packet.LSNMPvS_Packet, 1)
+	p.requests[messageId] = c
+	return c
+}
+
+func (p *PendingRequests) remove(messageId string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.requests, messageId)
+}
+
+// Deliver hands r to the request with the same message id, returning false
+// when nobody is waiting for it.
+func (p *PendingRequests) Deliver(r packet.LSNMPvS_Packet) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	c, ok := p.requests[r.GetMessageID()]
+	if !ok {
+		return false
+	}
+	delete(p.requests, r.GetMessageID())
+	c <- r
+	return true
+}
+
+// SendRequest sends r to address and waits for its response, which still
+// goes through HandleRequest like any other packet.
+func (m *MIB) SendRequest(address string, r *packet.LSNMPvS_Packet, timeout time.Duration) (packet.LSNMPvS_Packet, error) {
+	c := m.Pending.add(r.GetMessageID())
+	defer m.Pending.remove(r.GetMessageID())
+	if err := netfuncs.SendStrAddr(m.Transport, address, r.EncodeFrames()...); err != nil {
+		return packet.LSNMPvS_Packet{}, err
+	}
+	select {
+	case resp := <-c:
+		return resp, nil
+	case <-time.After(timeout):
+		return packet.LSNMPvS_Packet{}, fmt.Errorf("no response from %s after %v", address, timeout)
+	}
+}
+
+// Walk retrieves every object of the agent at address inside structure, or of
+// the whole MIB when structure is 0, with one GetNext request per object.
+// prepare sets up each request for the agent, like its version and
+// credentials.
+func (m *MIB) Walk(address string, prepare func(*packet.LSNMPvS_Packet), structure int) ([]types.IdValuePair, error) {
+	result := make([]types.IdValuePair, 0)
+	current := CodableValues.NewIIDSingleIndex(structure, 0, 0)
+	for {
+		iidList := types.CodableList{}
+		iidList.Append(types.NewCodableIID(current.Structure, current.Object, []int{*current.FirstIndex}))
+		r := packet.NewGetNextRequestPacket(iidList)
+		prepare(r)
+		resp, err := m.SendRequest(address, r, DefaultRequestTimeout)
+		if err != nil {
+			return result, err
+		}
+		if resp.HasError(packet.ErrorEndOfMib) {
+			return result, nil
+		}
+		if errs := resp.GetErrors(); len(errs) > 0 {
+			return result, errs[0]
+		}
+		pairs := resp.GetIidValuePairList()
+		if len(pairs) != 1 {
+			return result, packet.PacketErr(packet.ErrorUnmatchedIIDValueList)
+		}
+		next, ok := pairs[0].IID.Value.(*CodableValues.IID)
+		if !ok || next.FirstIndex == nil {
+			return result, packet.PacketErr(packet.ErrorInvalidIID)
+		}
+		if structure != 0 && next.Structure != structure {
+			return result, nil
+		}
+		if current.Compare(next) >= 0 {
+			return result, fmt.Errorf("agent %s returned %v, which doesn't come after %v", address, next, current)
+		}
+		result = append(result, pairs[0])
+		current = next
+	}
+}
+
+// GetBulk sends the GetBulk request r to address and keeps asking for the
+// rows that didn't fit in each response, until max-repetitions rows were
+// received or every column reached the end of the MIB.
+func (m *MIB) GetBulk(address string, r *packet.LSNMPvS_Packet) ([]types.IdValuePair, error) {
+	nonRepeaters, maxRepetitions, maxSize, pErr := r.GetBulkParameters()
+	if pErr != 0 {
+		return nil, pErr
+	}
+	result := make([]types.IdValuePair, 0)
+	for {
+		resp, err := m.SendRequest(address, r, DefaultRequestTimeout)
+		if err != nil {
+			return result, err
+		}
+		if resp.HasPacketError() {
+			return result, resp.GetErrors()[0]
+		}
+		pairs := resp.GetIidValuePairList()
+		if len(pairs) < nonRepeaters {
+			return result, packet.PacketErr(packet.ErrorUnmatchedIIDValueList)
+		}
+		ended := make(map[int]bool)
+		for _, e := range resp.GetErrors() {
+			if e.Code != packet.ErrorEndOfMib {
+				return result, e
+			}
+			ended[e.Index-1] = true
+		}
+		columns := len(r.GetIidValuePairList()) - nonRepeaters
+		rows := 0
+		if columns > 0 {
+			rows = min((len(pairs)-nonRepeaters)/columns, maxRepetitions)
+		}
+		if rows == 0 && maxRepetitions > 0 && columns > 0 {
+			return result, fmt.Errorf("agent %s returned no rows for the GetBulk request", address)
+		}
+		continuation := types.CodableList{}
+		lastRow := nonRepeaters + (rows-1)*columns
+		for i, pair := range pairs[:nonRepeaters+rows*columns] {
+			if ended[i] {
+				continue
+			}
+			result = append(result, pair)
+			if rows > 0 && i >= lastRow {
+				continuation.Append(pair.IID)
+			}
+		}
+		maxRepetitions -= rows
+		nonRepeaters = 0
+		if maxRepetitions <= 0 || len(continuation) == 0 {
+			break
+		}
+		credentials := r.GetCredentials()
+		r = packet.NewGetBulkRequestPacket(continuation, 0, maxRepetitions, maxSize)
+		r.SetVersion(resp.GetVersion())
+		r.SetCredentials(credentials)
+	}
+	return result, nil
+}
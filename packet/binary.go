@@ -0,0 +1,152 @@
+package packet
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+)
+
+const (
+	ProtocolV1 byte = iota + 1 // null terminated text encoding
+	ProtocolV2                 // length prefixed binary encoding
+)
+
+// defaultVersion is shared by every device of the process, like the limits.
+var defaultVersion atomic.Uint32
+
+func init() {
+	defaultVersion.Store(uint32(ProtocolV2))
+}
+
+func IsSupportedVersion(version byte) bool {
+	return version == ProtocolV1 || version == ProtocolV2
+}
+
+// SetDefaultVersion sets the protocol version used for packets that don't
+// answer another packet, such as requests and notifications.
+func SetDefaultVersion(version byte) error {
+	if !IsSupportedVersion(version) {
+		return fmt.Errorf("unsupported protocol version %d", version)
+	}
+	defaultVersion.Store(uint32(version))
+	return nil
+}
+
+func GetDefaultVersion() byte {
+	return byte(defaultVersion.Load())
+}
+
+// NegotiateVersion picks the version to use with a peer that was last heard
+// speaking peerVersion: the highest version both sides support.
+func NegotiateVersion(preferred, peerVersion byte) byte {
+	if !IsSupportedVersion(peerVersion) {
+		return preferred
+	}
+	return min(preferred, peerVersion)
+}
+
+func (p *LSNMPvS_Packet) encodeBinary() string {
+	encoded := CodableValues.EncodeBinaryString(p.tag)
+	encoded += string(p.pType)
+	encoded += p.timestamp.EncodeBinary()
+	encoded += CodableValues.EncodeBinaryString(p.messageId)
+	encoded += p.iidList.EncodeBinary()
+	encoded += p.valueList.EncodeBinary()
+	encoded += CodableValues.EncodeUvarint(uint64(len(p.errorList)))
+	for _, v := range p.errorList {
+		encoded += CodableValues.EncodeBinaryInt(int(v.Code))
+	}
+	encoded += CodableValues.EncodeUvarint(uint64(len(p.errorList)))
+	for _, v := range p.errorList {
+		encoded += CodableValues.EncodeBinaryInt(v.Index)
+	}
+	if p.credentials != (Credentials{}) {
+		encoded += CodableValues.EncodeBinaryString(p.credentials.User)
+		encoded += CodableValues.EncodeBinaryString(p.credentials.Secret)
+	}
+	return encoded
+}
+
+func (p *LSNMPvS_Packet) decodeBinary(data string) (string, error) {
+	var err error
+	var rest string
+	p.tag, rest, err = CodableValues.DecodeBinaryString(data)
+	if err != nil {
+		return "", &DecodeError{"tag", err}
+	}
+	if len(rest) == 0 {
+		return "", &DecodeError{"type", CodableValues.ErrUnexpectedEnd}
+	}
+	p.pType = rest[0]
+	p.timestamp = &types.CompleteCodableValue{}
+	rest, err = p.timestamp.DecodeBinary(rest[1:])
+	if err != nil {
+		return "", &DecodeError{"timestamp", err}
+	}
+	p.messageId, rest, err = CodableValues.DecodeBinaryString(rest)
+	if err != nil {
+		return "", &DecodeError{"message id", err}
+	}
+	p.iidList = types.CodableList{}
+	rest, err = p.iidList.DecodeBinary(rest)
+	if err != nil {
+		return "", &DecodeError{"iid list", err}
+	}
+	for i, iid := range p.iidList {
+		if _, ok := iid.Value.(*CodableValues.IID); !ok {
+			return "", &DecodeError{"iid list", fmt.Errorf("list item %d isn't an iid", i)}
+		}
+	}
+	p.valueList = types.CodableList{}
+	rest, err = p.valueList.DecodeBinary(rest)
+	if err != nil {
+		return "", &DecodeError{"value list", err}
+	}
+	var length int
+	length, rest, err = CodableValues.DecodeBinaryLength(rest)
+	if err != nil {
+		return "", &DecodeError{"error list", err}
+	}
+	p.errorList = make([]ErrorEntry, length)
+	for i := 0; i < length; i++ {
+		var code int
+		code, rest, err = CodableValues.DecodeBinaryInt(rest)
+		if err != nil {
+			return "", &DecodeError{"error list", fmt.Errorf("list item %d: %w", i+1, err)}
+		}
+		p.errorList[i].Code = PacketErr(code)
+	}
+	if len(rest) == 0 {
+		return rest, nil
+	}
+	length, rest, err = CodableValues.DecodeBinaryLength(rest)
+	if err != nil {
+		return "", &DecodeError{"error indexes", err}
+	}
+	if length != len(p.errorList) {
+		return "", &DecodeError{"error indexes", fmt.Errorf("list length %d: %w", length, CodableValues.ErrInvalidLength)}
+	}
+	for i := 0; i < length; i++ {
+		p.errorList[i].Index, rest, err = CodableValues.DecodeBinaryInt(rest)
+		if err != nil {
+			return "", &DecodeError{"error indexes", fmt.Errorf("list item %d: %w", i+1, err)}
+		}
+	}
+	if err := p.checkErrorIndexes(); err != nil {
+		return "", &DecodeError{"error indexes", err}
+	}
+	if len(rest) == 0 {
+		return rest, nil
+	}
+	p.credentials.User, rest, err = CodableValues.DecodeBinaryString(rest)
+	if err != nil {
+		return "", &DecodeError{"credentials", err}
+	}
+	p.credentials.Secret, rest, err = CodableValues.DecodeBinaryString(rest)
+	if err != nil {
+		return "", &DecodeError{"credentials", err}
+	}
+	return rest, nil
+}
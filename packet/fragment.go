@@ -0,0 +1,219 @@
+package packet
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+)
+
+const (
+	// fragmentMarker starts every fragment. It can't start a whole frame,
+	// which begins with a printable key id in ProtocolV1 or with ProtocolV2.
+	fragmentMarker byte = 0x7f
+
+	// MaxMessageSize is the biggest encoded packet that can be sent, split
+	// into fragments when it doesn't fit in a single datagram.
+	MaxMessageSize = 512 * 1024
+
+	// DefaultFragmentTimeout is how long the fragments of a packet are kept
+	// waiting for the rest of them.
+	DefaultFragmentTimeout = 5 * time.Second
+
+	maxFragments           = 1024
+	maxPendingReassemblies = 64
+	// maxPendingPerSource keeps a single address from taking every pending
+	// reassembly, its oldest one being given up on to start another.
+	maxPendingPerSource = 8
+)
+
+// EncodeFrames encodes the packet into the datagrams that carry it: the frame
+// itself when it fits in one, or its fragments otherwise.
+func (p *LSNMPvS_Packet) EncodeFrames() [][]byte {
+	return FragmentFrame(p.Encode(), p.messageId)
+}
+
+// FragmentFrame splits an encoded frame into numbered fragments tied to the
+// message id of its packet, each fitting in a single datagram. Frames that
+// already fit are returned as they are.
+func FragmentFrame(frame, messageID string) [][]byte {
+	return fragment(frame, messageID, MaxPacketSize)
+}
+
+func fragment(frame, messageID string, datagramSize int) [][]byte {
+	if len(frame) <= datagramSize {
+		return [][]byte{[]byte(frame)}
+	}
+	// Room for the index and count to grow from 1 to 3 bytes each
+	chunkSize := datagramSize - len(fragmentHeader(messageID, 0, 0)) - 4
+	count := (len(frame) + chunkSize - 1) / chunkSize
+	fragments := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		chunk := frame[i*chunkSize : min((i+1)*chunkSize, len(frame))]
+		fragments = append(fragments, []byte(fragmentHeader(messageID, i, count)+chunk))
+	}
+	return fragments
+}
+
+func fragmentHeader(messageID string, index, count int) string {
+	header := string(fragmentMarker) + CodableValues.EncodeBinaryString(messageID)
+	header += CodableValues.EncodeUvarint(uint64(index))
+	header += CodableValues.EncodeUvarint(uint64(count))
+	return header
+}
+
+func decodeFragment(data string) (string, int, int, string, error) {
+	messageID, rest, err := CodableValues.DecodeBinaryString(data[1:])
+	if err != nil {
+		return "", 0, 0, "", err
+	}
+	index, rest, err := CodableValues.DecodeUvarint(rest)
+	if err != nil {
+		return "", 0, 0, "", err
+	}
+	count, rest, err := CodableValues.DecodeUvarint(rest)
+	if err != nil {
+		return "", 0, 0, "", err
+	}
+	if count > maxFragments {
+		return "", 0, 0, "", fmt.Errorf("%d fragments: %w", count, CodableValues.ErrTooBig)
+	}
+	if count < 2 || index >= count {
+		return "", 0, 0, "", fmt.Errorf("fragment %d of %d: %w", index, count, CodableValues.ErrInvalidLength)
+	}
+	return messageID, int(index), int(count), rest, nil
+}
+
+// ReassemblyStats counts what happened to the fragments a Reassembler got.
+type ReassemblyStats struct {
+	Completed int // packets put back together
+	Pending   int // packets still waiting for fragments
+	TimedOut  int // packets given up on because fragments stopped arriving
+	Dropped   int // fragments that were invalid or over the limits
+}
+
+func (s ReassemblyStats) String() string {
+	return fmt.Sprintf("Fragmented: %d reassembled, %d pending, %d timed out, %d dropped", s.Completed, s.Pending, s.TimedOut, s.Dropped)
+}
+
+type reassembly struct {
+	source    string
+	started   uint64
+	fragments []string
+	received  int
+	size      int
+	expiry    time.Time
+}
+
+// Reassembler puts fragmented packets back together. Fragments are grouped by
+// the address they came from and their message id, and packets still missing
+// fragments after the timeout are given up on.
+type Reassembler struct {
+	pending map[string]*reassembly
+	timeout time.Duration
+	stats   ReassemblyStats
+	// started counts the reassemblies begun, ordering them by age
+	started uint64
+	lock    *sync.Mutex
+}
+
+func NewReassembler(timeout time.Duration) *Reassembler {
+	return &Reassembler{
+		pending: make(map[string]*reassembly),
+		timeout: timeout,
+		lock:    &sync.Mutex{},
+	}
+}
+
+// Add takes a datagram received from source and returns the frame to decode
+// once it's complete. Datagrams that aren't fragments are complete frames.
+func (r *Reassembler) Add(source string, datagram []byte) (string, bool, error) {
+	return r.addAt(source, datagram, time.Now())
+}
+
+func (r *Reassembler) addAt(source string, datagram []byte, now time.Time) (string, bool, error) {
+	data := string(datagram)
+	if len(data) == 0 || data[0] != fragmentMarker {
+		return data, true, nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.expire(now)
+	messageID, index, count, chunk, err := decodeFragment(data)
+	if err != nil {
+		r.stats.Dropped++
+		return "", false, &DecodeError{"fragment", err}
+	}
+	key := source + "/" + messageID
+	current, ok := r.pending[key]
+	if !ok {
+		r.evictOldestFrom(source)
+		if len(r.pending) >= maxPendingReassemblies {
+			r.stats.Dropped++
+			return "", false, &DecodeError{"fragment", fmt.Errorf("too many pending packets: %w", CodableValues.ErrTooBig)}
+		}
+		r.started++
+		current = &reassembly{source: source, started: r.started, fragments: make([]string, count), expiry: now.Add(r.timeout)}
+		r.pending[key] = current
+	}
+	if len(current.fragments) != count || current.fragments[index] != "" || chunk == "" {
+		r.stats.Dropped++
+		return "", false, &DecodeError{"fragment", fmt.Errorf("fragment %d of %d doesn't match its packet: %w", index, count, CodableValues.ErrInvalidLength)}
+	}
+	if current.size+len(chunk) > MaxMessageSize {
+		delete(r.pending, key)
+		r.stats.Dropped++
+		return "", false, &DecodeError{"fragment", fmt.Errorf("packet over %d bytes: %w", MaxMessageSize, CodableValues.ErrTooBig)}
+	}
+	current.fragments[index] = chunk
+	current.received++
+	current.size += len(chunk)
+	if current.received < count {
+		return "", false, nil
+	}
+	delete(r.pending, key)
+	r.stats.Completed++
+	return strings.Join(current.fragments, ""), true, nil
+}
+
+// evictOldestFrom gives up on the oldest packet from source when it already
+// has maxPendingPerSource of them.
+func (r *Reassembler) evictOldestFrom(source string) {
+	count := 0
+	oldestKey := ""
+	for key, current := range r.pending {
+		if current.source != source {
+			continue
+		}
+		count++
+		if oldestKey == "" || current.started < r.pending[oldestKey].started {
+			oldestKey = key
+		}
+	}
+	if count >= maxPendingPerSource {
+		delete(r.pending, oldestKey)
+		r.stats.Dropped++
+	}
+}
+
+func (r *Reassembler) expire(now time.Time) {
+	for key, current := range r.pending {
+		if now.After(current.expiry) {
+			delete(r.pending, key)
+			r.stats.TimedOut++
+		}
+	}
+}
+
+// Stats returns how many packets were reassembled, are still incomplete or
+// were given up on.
+func (r *Reassembler) Stats() ReassemblyStats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.expire(time.Now())
+	stats := r.stats
+	stats.Pending = len(r.pending)
+	return stats
+}
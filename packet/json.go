@@ -0,0 +1,132 @@
+package packet
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+)
+
+// packetJSON is how packets are written in JSON. Values are tagged with their
+// type, so a document can be turned back into a packet and encoded again.
+type packetJSON struct {
+	Tag         string                      `json:"tag"`
+	Version     byte                        `json:"version"`
+	Type        string                      `json:"type"`
+	Timestamp   *types.CompleteCodableValue `json:"timestamp"`
+	MessageID   string                      `json:"messageId"`
+	IIDs        types.CodableList           `json:"iids"`
+	Values      types.CodableList           `json:"values"`
+	Errors      []errorJSON                 `json:"errors"`
+	Credentials *credentialsJSON            `json:"credentials,omitempty"`
+}
+
+// errorJSON is an ErrorEntry, with its message added for whoever reads it.
+// The message is ignored when reading packets.
+type errorJSON struct {
+	Index   int    `json:"index"`
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type credentialsJSON struct {
+	User   string `json:"user"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// MarshalJSON writes the packet with the user of its credentials but not
+// their secret, so documents can be shown or kept without leaking it.
+func (p *LSNMPvS_Packet) MarshalJSON() ([]byte, error) {
+	return p.marshalJSON(false)
+}
+
+// MarshalJSONWithSecret writes the packet like MarshalJSON but with the
+// secret of its credentials, for documents that must be read back into the
+// very same packet.
+func (p *LSNMPvS_Packet) MarshalJSONWithSecret() ([]byte, error) {
+	return p.marshalJSON(true)
+}
+
+func (p *LSNMPvS_Packet) marshalJSON(withSecret bool) ([]byte, error) {
+	doc := packetJSON{
+		Tag:       p.tag,
+		Version:   p.version,
+		Type:      string(p.pType),
+		Timestamp: p.timestamp,
+		MessageID: p.messageId,
+		IIDs:      p.iidList,
+		Values:    p.valueList,
+		Errors:    make([]errorJSON, 0, len(p.errorList)),
+	}
+	for _, e := range p.errorList {
+		doc.Errors = append(doc.Errors, errorJSON{Index: e.Index, Code: int(e.Code), Message: e.Code.Error()})
+	}
+	if p.credentials != (Credentials{}) {
+		doc.Credentials = &credentialsJSON{User: p.credentials.User}
+		if withSecret {
+			doc.Credentials.Secret = p.credentials.Secret
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON reads a packet written by MarshalJSON or
+// MarshalJSONWithSecret. Packets without a tag or version get the fixed tag
+// and the default version.
+func (p *LSNMPvS_Packet) UnmarshalJSON(data []byte) error {
+	var doc packetJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Type) != 1 {
+		return fmt.Errorf("invalid packet type %q", doc.Type)
+	}
+	if doc.Timestamp == nil {
+		return fmt.Errorf("packet without timestamp")
+	}
+	if doc.Tag == "" {
+		doc.Tag = fixedTag
+	}
+	if doc.Version == 0 {
+		doc.Version = GetDefaultVersion()
+	}
+	if !IsSupportedVersion(doc.Version) {
+		return fmt.Errorf("unsupported protocol version %d", doc.Version)
+	}
+	if doc.IIDs == nil {
+		doc.IIDs = types.CodableList{}
+	}
+	for i, iid := range doc.IIDs {
+		if _, ok := iid.Value.(*CodableValues.IID); !ok {
+			return &DecodeError{"iid list", fmt.Errorf("list item %d isn't an iid", i)}
+		}
+	}
+	if doc.Values == nil {
+		doc.Values = types.CodableList{}
+	}
+	errorList := make([]ErrorEntry, 0, len(doc.Errors))
+	for _, e := range doc.Errors {
+		errorList = append(errorList, ErrorEntry{Index: e.Index, Code: PacketErr(e.Code)})
+	}
+	var credentials Credentials
+	if doc.Credentials != nil {
+		credentials = Credentials{User: doc.Credentials.User, Secret: doc.Credentials.Secret}
+	}
+	decoded := LSNMPvS_Packet{
+		tag:         doc.Tag,
+		pType:       doc.Type[0],
+		timestamp:   doc.Timestamp,
+		messageId:   doc.MessageID,
+		iidList:     doc.IIDs,
+		valueList:   doc.Values,
+		errorList:   errorList,
+		version:     doc.Version,
+		credentials: credentials,
+	}
+	if err := decoded.checkErrorIndexes(); err != nil {
+		return &DecodeError{"error indexes", err}
+	}
+	*p = decoded
+	return nil
+}
@@ -0,0 +1,153 @@
+package packet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"sync"
+)
+
+// LegacyKeyID identifies the built-in key used when no keys are configured,
+// so deployments without a keyring section keep talking to each other.
+const LegacyKeyID = "default"
+
+// Keyring holds every pre-shared key a device accepts, indexed by key ID.
+// Packets are always sealed with the active key, but any key in the ring can
+// open them, which allows keys to be rotated one device at a time.
+type Keyring struct {
+	keys     map[string]cipher.AEAD
+	activeID string
+	lock     sync.RWMutex
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{
+		keys: make(map[string]cipher.AEAD),
+	}
+}
+
+func NewLegacyKeyring() *Keyring {
+	k := NewKeyring()
+	if err := k.AddKey(LegacyKeyID, []byte(fixedTag)); err != nil {
+		panic(err)
+	}
+	k.activeID = LegacyKeyID
+	return k
+}
+
+func (k *Keyring) AddKey(id string, key []byte) error {
+	if err := validateKeyID(id); err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("key %q: %w", id, err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("key %q: %w", id, err)
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.keys[id] = gcm
+	if k.activeID == "" {
+		k.activeID = id
+	}
+	return nil
+}
+
+// RemoveKey removes the key id from the keyring. The active key can't be
+// removed, packets couldn't be sealed without it, so another one must be made
+// active first.
+func (k *Keyring) RemoveKey(id string) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if k.activeID == id {
+		return fmt.Errorf("key %q is the active key", id)
+	}
+	delete(k.keys, id)
+	return nil
+}
+
+func (k *Keyring) SetActive(id string) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("key %q is not in the keyring", id)
+	}
+	k.activeID = id
+	return nil
+}
+
+func (k *Keyring) ActiveKeyID() string {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	return k.activeID
+}
+
+func (k *Keyring) KeyIDs() []string {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Replace swaps the contents of the keyring with the ones from other, so a
+// reloaded configuration takes effect for every packet encoded afterwards.
+func (k *Keyring) Replace(other *Keyring) {
+	other.lock.RLock()
+	keys := make(map[string]cipher.AEAD, len(other.keys))
+	for id, gcm := range other.keys {
+		keys[id] = gcm
+	}
+	activeID := other.activeID
+	other.lock.RUnlock()
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.keys = keys
+	k.activeID = activeID
+}
+
+func (k *Keyring) active() (string, cipher.AEAD, error) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	gcm, ok := k.keys[k.activeID]
+	if !ok {
+		return "", nil, fmt.Errorf("keyring has no active key")
+	}
+	return k.activeID, gcm, nil
+}
+
+func (k *Keyring) get(id string) (cipher.AEAD, bool) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	gcm, ok := k.keys[id]
+	return gcm, ok
+}
+
+func validateKeyID(id string) error {
+	if id == "" {
+		return fmt.Errorf("key id can't be empty")
+	}
+	for _, c := range []byte(id) {
+		if c < 0x21 || c > 0x7e {
+			return fmt.Errorf("key id %q must only contain printable ascii characters", id)
+		}
+	}
+	return nil
+}
+
+var keyring = NewLegacyKeyring()
+
+// GetKeyring returns the keyring used by Encode and Decode.
+func GetKeyring() *Keyring {
+	return keyring
+}
+
+// SetKeyring replaces the keys used by Encode and Decode.
+func SetKeyring(k *Keyring) {
+	keyring.Replace(k)
+}
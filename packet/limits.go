@@ -0,0 +1,63 @@
+package packet
+
+import (
+	"sync/atomic"
+
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+)
+
+// Limits bound how much work a single packet can make a device do, so a small
+// request can't be used to exhaust its memory or to amplify traffic.
+type Limits struct {
+	// MaxListLength is how many entries a decoded IID or value list can have.
+	MaxListLength int
+	// MaxExpandedIIDs is how many IIDs the ranges of a request can expand to.
+	MaxExpandedIIDs int
+	// MaxStringLength is how many bytes a decoded string can have.
+	MaxStringLength int
+	// MaxResponseSize is how many bytes an encoded response can have. Those
+	// bigger than a datagram are sent in fragments.
+	MaxResponseSize int
+}
+
+var DefaultLimits = Limits{
+	MaxListLength:   types.DefaultMaxListLength,
+	MaxExpandedIIDs: 1024,
+	MaxStringLength: CodableValues.DefaultMaxStringLength,
+	MaxResponseSize: 256 * 1024,
+}
+
+// limits are shared by every device of the process, which may be decoding
+// while another one sets them.
+var limits atomic.Pointer[Limits]
+
+func init() {
+	l := DefaultLimits
+	limits.Store(&l)
+}
+
+// SetLimits replaces the limits used when decoding and answering packets.
+// Limits left at 0 keep their default.
+func SetLimits(l Limits) {
+	if l.MaxListLength <= 0 {
+		l.MaxListLength = DefaultLimits.MaxListLength
+	}
+	if l.MaxExpandedIIDs <= 0 {
+		l.MaxExpandedIIDs = DefaultLimits.MaxExpandedIIDs
+	}
+	if l.MaxStringLength <= 0 {
+		l.MaxStringLength = DefaultLimits.MaxStringLength
+	}
+	if l.MaxResponseSize <= 0 {
+		l.MaxResponseSize = DefaultLimits.MaxResponseSize
+	}
+	l.MaxResponseSize = min(l.MaxResponseSize, MaxMessageSize)
+	limits.Store(&l)
+	types.SetMaxListLength(l.MaxListLength)
+	CodableValues.SetMaxStringLength(l.MaxStringLength)
+}
+
+func GetLimits() Limits {
+	return *limits.Load()
+}
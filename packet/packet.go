@@ -1,12 +1,14 @@
 package packet
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
+	crand "crypto/rand"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
-	"net"
 	"sort"
+	"strconv"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/lipgloss/table"
@@ -30,17 +32,25 @@ const (
 	ErrorObjectIdDoesntExist
 	ErrorIndexOutOfRange
 	ErrorValueOutOfRange
+	ErrorEndOfMib
+	ErrorTooBig
+	ErrorConditionFailed
+	ErrorAuthorization
 
 	fixedTag         = "kdk847ufh84jg87g"
 	possibleChars    = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 	possibleCharsLen = len(possibleChars)
 	messageIdLength  = 16
+
+	// MaxPacketSize is the biggest payload a single UDP datagram can carry,
+	// so it's both the size of receive buffers and of fragments.
+	MaxPacketSize = 65507
 )
 
 type PacketErr int
 
 func (e PacketErr) Compile(p LSNMPvS_Packet) (*LSNMPvS_Packet, error, bool) {
-	return p.NewErrorResponsePacket([]int{int(e)}), fmt.Errorf(e.Error()), true
+	return p.NewErrorResponsePacket([]ErrorEntry{{Index: 0, Code: e}}), fmt.Errorf(e.Error()), true
 }
 
 func (e PacketErr) Error() string {
@@ -74,10 +84,38 @@ func (e PacketErr) Error() string {
 		errorText = "duplicate message id"
 	case ErrorDecodingPacket:
 		errorText = "error decoding packet"
+	case ErrorEndOfMib:
+		errorText = "no more objects after the refered iid"
+	case ErrorTooBig:
+		errorText = "request or its response is bigger than allowed"
+	case ErrorConditionFailed:
+		errorText = "current value doesn't match the condition of the set"
+	case ErrorAuthorization:
+		errorText = "credentials don't allow the request"
 	}
 	return errorText
 }
 
+// ErrorEntry is an error reported in a response. Index points to the IID that
+// caused it, counting from 1 like SNMP's error-index, or is 0 when the error
+// applies to the whole packet.
+type ErrorEntry struct {
+	Index int
+	Code  PacketErr
+}
+
+func (e ErrorEntry) Error() string {
+	return fmt.Sprintf("Error code %d: %v", int(e.Code), e.Code)
+}
+
+// Credentials identify who sent a request, like an SNMP community or user, so
+// agents can decide what it's allowed to do. They travel encrypted with the
+// rest of the packet and are left empty in responses and notifications.
+type Credentials struct {
+	User   string
+	Secret string
+}
+
 func RandStringBytes() string {
 	b := make([]byte, messageIdLength)
 	for i := range b {
@@ -87,13 +125,15 @@ func RandStringBytes() string {
 }
 
 type LSNMPvS_Packet struct {
-	tag       string                      // tag
-	pType     byte                        // packet type
-	timestamp *types.CompleteCodableValue // timestamp
-	messageId string                      // message id
-	iidList   types.CodableList           // list of iid
-	valueList types.CodableList           // list of values
-	errorList []int                       // list of errors
+	tag         string                      // tag
+	pType       byte                        // packet type
+	timestamp   *types.CompleteCodableValue // timestamp
+	messageId   string                      // message id
+	iidList     types.CodableList           // list of iid
+	valueList   types.CodableList           // list of values
+	errorList   []ErrorEntry                // list of errors
+	version     byte                        // protocol version used on the wire
+	credentials Credentials                 // who sent the request
 }
 
 func NewGetRequestPacket(iidList types.CodableList) *LSNMPvS_Packet {
@@ -104,8 +144,68 @@ func NewGetRequestPacket(iidList types.CodableList) *LSNMPvS_Packet {
 		messageId: RandStringBytes(),
 		iidList:   iidList,
 		valueList: types.CodableList{},
-		errorList: []int{},
+		errorList: []ErrorEntry{},
+		version:   GetDefaultVersion(),
+	}
+}
+
+// NewGetNextRequestPacket asks for the value of the first object after each
+// IID of iidList, which is how a manager walks a MIB it doesn't know.
+func NewGetNextRequestPacket(iidList types.CodableList) *LSNMPvS_Packet {
+	return &LSNMPvS_Packet{
+		tag:       fixedTag,
+		pType:     'X',
+		timestamp: types.NewCodableTimestampNow(),
+		messageId: RandStringBytes(),
+		iidList:   iidList,
+		valueList: types.CodableList{},
+		errorList: []ErrorEntry{},
+		version:   GetDefaultVersion(),
+	}
+}
+
+// NewGetBulkRequestPacket asks for the object after each of the first
+// nonRepeaters IIDs once, and then for up to maxRepetitions consecutive objects
+// after each of the remaining ones, like SNMP's GetBulk. The response won't be
+// bigger than maxSize bytes, or MaxPacketSize when it is 0.
+func NewGetBulkRequestPacket(iidList types.CodableList, nonRepeaters, maxRepetitions, maxSize int) *LSNMPvS_Packet {
+	valueList := types.CodableList{}
+	valueList.Append(types.NewCodableInt(nonRepeaters))
+	valueList.Append(types.NewCodableInt(maxRepetitions))
+	valueList.Append(types.NewCodableInt(maxSize))
+	return &LSNMPvS_Packet{
+		tag:       fixedTag,
+		pType:     'B',
+		timestamp: types.NewCodableTimestampNow(),
+		messageId: RandStringBytes(),
+		iidList:   iidList,
+		valueList: valueList,
+		errorList: []ErrorEntry{},
+		version:   GetDefaultVersion(),
+	}
+}
+
+// GetBulkParameters returns the non-repeaters, max-repetitions and maximum
+// response size of a GetBulk request.
+func (p *LSNMPvS_Packet) GetBulkParameters() (int, int, int, PacketErr) {
+	params := [3]int{}
+	for i := range params {
+		value, ok := p.valueList[i+1]
+		if !ok {
+			return 0, 0, 0, ErrorUnmatchedIIDValueList
+		}
+		intValue, ok := value.Value.(*CodableValues.CodableInt)
+		if !ok || intValue.Value < 0 {
+			return 0, 0, 0, ErrorInvalidDataType
+		}
+		params[i] = intValue.Value
 	}
+	nonRepeaters, maxRepetitions, maxSize := params[0], params[1], params[2]
+	if maxSize == 0 {
+		maxSize = MaxPacketSize
+	}
+	maxSize = min(maxSize, GetLimits().MaxResponseSize)
+	return min(nonRepeaters, len(p.iidList)), maxRepetitions, maxSize, 0
 }
 
 func NewSetResponsePacket(iidList, valueList types.CodableList) *LSNMPvS_Packet {
@@ -116,7 +216,35 @@ func NewSetResponsePacket(iidList, valueList types.CodableList) *LSNMPvS_Packet
 		messageId: RandStringBytes(),
 		iidList:   iidList,
 		valueList: valueList,
-		errorList: []int{},
+		errorList: []ErrorEntry{},
+		version:   GetDefaultVersion(),
+	}
+}
+
+// NewConditionalSetRequestPacket is a Set that is only applied if every IID
+// still has the value of the same position of conditionList, which follows the
+// new values in the value list. A timestamp condition for an object that isn't
+// one is compared with the time the object's entry was last changed, and IIDs
+// without a condition get a Null one, which always holds.
+func NewConditionalSetRequestPacket(iidList, valueList, conditionList types.CodableList) *LSNMPvS_Packet {
+	values := types.CodableList{}
+	for i := 1; i <= len(iidList); i++ {
+		condition, ok := conditionList[i]
+		if !ok || condition == nil {
+			condition = types.NewCodableNull()
+		}
+		values.Add(i, valueList[i])
+		values.Add(len(iidList)+i, condition)
+	}
+	return &LSNMPvS_Packet{
+		tag:       fixedTag,
+		pType:     'C',
+		timestamp: types.NewCodableTimestampNow(),
+		messageId: RandStringBytes(),
+		iidList:   iidList,
+		valueList: values,
+		errorList: []ErrorEntry{},
+		version:   GetDefaultVersion(),
 	}
 }
 
@@ -125,14 +253,15 @@ func NewErrorDecodingPacket(pErr PacketErr) *LSNMPvS_Packet {
 		tag:       fixedTag,
 		pType:     'R',
 		timestamp: types.NewCodableTimestampNow(),
-		messageId: "ERROR",
+		messageId: RandStringBytes(),
 		iidList:   types.CodableList{},
 		valueList: types.CodableList{},
-		errorList: []int{int(pErr)},
+		errorList: []ErrorEntry{{Index: 0, Code: pErr}},
+		version:   ProtocolV1,
 	}
 }
 
-func (p *LSNMPvS_Packet) NewErrorResponsePacket(errorList []int) *LSNMPvS_Packet {
+func (p *LSNMPvS_Packet) NewErrorResponsePacket(errorList []ErrorEntry) *LSNMPvS_Packet {
 	return &LSNMPvS_Packet{
 		tag:       p.tag,
 		pType:     'R',
@@ -141,6 +270,7 @@ func (p *LSNMPvS_Packet) NewErrorResponsePacket(errorList []int) *LSNMPvS_Packet
 		iidList:   p.iidList,
 		valueList: p.valueList,
 		errorList: errorList,
+		version:   p.version,
 	}
 }
 
@@ -158,10 +288,19 @@ func (p *LSNMPvS_Packet) NewResponsePacket(l []types.IdValuePair, uptime *types.
 		messageId: p.messageId,
 		iidList:   iidList,
 		valueList: valueList,
-		errorList: []int{},
+		errorList: []ErrorEntry{},
+		version:   p.version,
 	}
 }
 
+// NewResponsePacketWithErrors answers a request where some IIDs failed, each
+// entry of errorList pointing to its position in l.
+func (p *LSNMPvS_Packet) NewResponsePacketWithErrors(l []types.IdValuePair, errorList []ErrorEntry, uptime *types.CompleteCodableValue) *LSNMPvS_Packet {
+	resp := p.NewResponsePacket(l, uptime)
+	resp.errorList = errorList
+	return resp
+}
+
 func NewNotificationPacket(l []types.IdValuePair, uptime *types.CompleteCodableValue) *LSNMPvS_Packet {
 	iidList := types.CodableList{}
 	valueList := types.CodableList{}
@@ -176,16 +315,59 @@ func NewNotificationPacket(l []types.IdValuePair, uptime *types.CompleteCodableV
 		messageId: RandStringBytes(),
 		iidList:   iidList,
 		valueList: valueList,
-		errorList: []int{},
+		errorList: []ErrorEntry{},
+		version:   GetDefaultVersion(),
 	}
 }
 
+// NewInformPacket is a notification that managers acknowledge with a response
+// carrying the same message id.
+func NewInformPacket(l []types.IdValuePair, uptime *types.CompleteCodableValue) *LSNMPvS_Packet {
+	p := NewNotificationPacket(l, uptime)
+	p.pType = 'I'
+	return p
+}
+
 func (p *LSNMPvS_Packet) AppendEntry(e types.IdValuePair) {
 	p.iidList.Append(e.IID)
 	p.valueList.Append(e.Value)
 }
 
+// AppendError reports pErr for the IID at index in the IID list, or for the
+// whole packet when index is 0.
+func (p *LSNMPvS_Packet) AppendError(index int, pErr PacketErr) {
+	p.errorList = append(p.errorList, ErrorEntry{Index: index, Code: pErr})
+}
+
+// EntrySize is how many bytes e adds to the encoded packet, which allows
+// filling a response up to a size limit without encoding it again each time.
+func (p *LSNMPvS_Packet) EntrySize(e types.IdValuePair) int {
+	if p.version == ProtocolV2 {
+		return len(e.IID.EncodeBinary()) + len(e.Value.EncodeBinary())
+	}
+	return len(e.IID.Encode()) + len(e.Value.Encode())
+}
+
+// ErrorEntrySize is how many bytes e adds to the encoded packet.
+func (p *LSNMPvS_Packet) ErrorEntrySize(e ErrorEntry) int {
+	if p.version == ProtocolV2 {
+		return len(CodableValues.EncodeBinaryInt(int(e.Code))) + len(CodableValues.EncodeBinaryInt(e.Index))
+	}
+	return len(CodableValues.EncodeInt(int(e.Code))) + len(CodableValues.EncodeInt(e.Index))
+}
+
 func (p *LSNMPvS_Packet) Encode() string {
+	return encryptFrame(p.version, p.encodePayload())
+}
+
+func (p *LSNMPvS_Packet) encodePayload() string {
+	if p.version == ProtocolV2 {
+		return p.encodeBinary()
+	}
+	return p.encodeText()
+}
+
+func (p *LSNMPvS_Packet) encodeText() string {
 	encoded := CodableValues.EncodeString(p.tag)
 	encoded += string(p.pType)
 	encoded += p.timestamp.Encode()
@@ -194,94 +376,243 @@ func (p *LSNMPvS_Packet) Encode() string {
 	encoded += p.valueList.Encode()
 	encoded += CodableValues.EncodeInt(len(p.errorList))
 	for _, v := range p.errorList {
-		encoded += CodableValues.EncodeInt(v)
+		encoded += CodableValues.EncodeInt(int(v.Code))
+	}
+	// The error indexes come last so older decoders, which stop reading after
+	// the error codes, can still read the packet.
+	encoded += CodableValues.EncodeInt(len(p.errorList))
+	for _, v := range p.errorList {
+		encoded += CodableValues.EncodeInt(v.Index)
 	}
-	return Encrypt(encoded)
+	// And the credentials after them, only when there are some
+	if p.credentials != (Credentials{}) {
+		encoded += CodableValues.EncodeString(p.credentials.User)
+		encoded += CodableValues.EncodeString(p.credentials.Secret)
+	}
+	return encoded
 }
 
 func Encrypt(plainText string) string {
-	aes, err := aes.NewCipher([]byte(fixedTag))
+	return encryptFrame(ProtocolV1, plainText)
+}
+
+func encryptFrame(version byte, plainText string) string {
+	keyID, gcm, err := keyring.active()
 	if err != nil {
 		panic(err)
 	}
-	gcm, err := cipher.NewGCM(aes)
-	if err != nil {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(crand.Reader, nonce); err != nil {
 		panic(err)
 	}
-	nonce := make([]byte, gcm.NonceSize())
-	for i := range nonce {
-		nonce[i] = byte(i)
+	cipherText := gcm.Seal(nonce, nonce, []byte(plainText), additionalData(version, keyID))
+	if version == ProtocolV2 {
+		return string(ProtocolV2) + CodableValues.EncodeBinaryString(keyID) + string(cipherText)
+	}
+	return CodableValues.EncodeString(keyID) + string(cipherText)
+}
+
+// DecodeError describes at which stage a received packet failed to decode.
+type DecodeError struct {
+	Stage string
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%v at %s: %v", PacketErr(ErrorDecodingPacket), e.Stage, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeErrorCode returns the code to answer a packet that failed to decode
+// with err.
+func DecodeErrorCode(err error) PacketErr {
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		return decodeErr.PacketErr()
 	}
-	cipherText := gcm.Seal(nonce, nonce, []byte(plainText), nil)
-	return string(cipherText)
+	return ErrorDecodingPacket
 }
 
-func (p *LSNMPvS_Packet) Decode(data string) (string, PacketErr) {
-	data = Decrypt(data)
+// Authenticated tells if err happened after its frame was decrypted, which
+// means it came from a peer sharing a key and it's safe to answer it. Frames
+// that failed to reassemble or decrypt should be dropped silently.
+func Authenticated(err error) bool {
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		return decodeErr.Stage != "decrypt" && decodeErr.Stage != "fragment"
+	}
+	return false
+}
+
+func (e *DecodeError) PacketErr() PacketErr {
+	if errors.Is(e.Err, CodableValues.ErrTooBig) {
+		return ErrorTooBig
+	}
+	return ErrorDecodingPacket
+}
+
+func (p *LSNMPvS_Packet) Decode(data string) (string, error) {
+	version, data, err := decryptFrame(data)
+	if err != nil {
+		return "", &DecodeError{"decrypt", err}
+	}
+	p.version = version
+	if version == ProtocolV2 {
+		return p.decodeBinary(data)
+	}
+	return p.decodePlainText(data)
+}
+
+func (p *LSNMPvS_Packet) decodePlainText(data string) (string, error) {
 	var err error
 	var rest string
 	p.tag, rest, err = CodableValues.DecodeString(data)
 	if err != nil {
-		return "", ErrorDecodingPacket
+		return "", &DecodeError{"tag", err}
+	}
+	if len(rest) == 0 {
+		return "", &DecodeError{"type", CodableValues.ErrUnexpectedEnd}
 	}
 	p.pType = rest[0]
 	p.timestamp = &types.CompleteCodableValue{}
 	rest, err = p.timestamp.Decode(rest[1:])
 	if err != nil {
-		return "", ErrorDecodingPacket
+		return "", &DecodeError{"timestamp", err}
 	}
 	p.messageId, rest, err = CodableValues.DecodeString(rest)
 	if err != nil {
-		return "", ErrorDecodingPacket
+		return "", &DecodeError{"message id", err}
 	}
 	p.iidList = types.CodableList{}
 	rest, err = p.iidList.Decode(rest)
 	if err != nil {
-		return "", ErrorDecodingPacket
+		return "", &DecodeError{"iid list", err}
+	}
+	for i, iid := range p.iidList {
+		if _, ok := iid.Value.(*CodableValues.IID); !ok {
+			return "", &DecodeError{"iid list", fmt.Errorf("list item %d isn't an iid", i)}
+		}
 	}
 	p.valueList = types.CodableList{}
 	rest, err = p.valueList.Decode(rest)
 	if err != nil {
-		return "", ErrorDecodingPacket
+		return "", &DecodeError{"value list", err}
 	}
 	var length int
 	length, rest, err = CodableValues.DecodeInt(rest)
 	if err != nil {
-		return "", ErrorDecodingPacket
+		return "", &DecodeError{"error list", err}
+	}
+	if length < 0 || length > len(rest) {
+		return "", &DecodeError{"error list", fmt.Errorf("list length %d: %w", length, CodableValues.ErrInvalidLength)}
+	}
+	p.errorList = make([]ErrorEntry, length)
+	for i := 0; i < length; i++ {
+		var code int
+		code, rest, err = CodableValues.DecodeInt(rest)
+		if err != nil {
+			return "", &DecodeError{"error list", fmt.Errorf("list item %d: %w", i+1, err)}
+		}
+		p.errorList[i].Code = PacketErr(code)
+	}
+	if len(rest) == 0 {
+		return rest, nil
+	}
+	length, rest, err = CodableValues.DecodeInt(rest)
+	if err != nil {
+		return "", &DecodeError{"error indexes", err}
+	}
+	if length != len(p.errorList) {
+		return "", &DecodeError{"error indexes", fmt.Errorf("list length %d: %w", length, CodableValues.ErrInvalidLength)}
 	}
-	p.errorList = make([]int, length)
 	for i := 0; i < length; i++ {
-		p.errorList[i], rest, err = CodableValues.DecodeInt(rest)
+		p.errorList[i].Index, rest, err = CodableValues.DecodeInt(rest)
 		if err != nil {
-			return "", ErrorDecodingPacket
+			return "", &DecodeError{"error indexes", fmt.Errorf("list item %d: %w", i+1, err)}
 		}
 	}
-	return rest, 0
+	if err := p.checkErrorIndexes(); err != nil {
+		return "", &DecodeError{"error indexes", err}
+	}
+	if len(rest) == 0 {
+		return rest, nil
+	}
+	p.credentials.User, rest, err = CodableValues.DecodeString(rest)
+	if err != nil {
+		return "", &DecodeError{"credentials", err}
+	}
+	p.credentials.Secret, rest, err = CodableValues.DecodeString(rest)
+	if err != nil {
+		return "", &DecodeError{"credentials", err}
+	}
+	return rest, nil
 }
 
-func Decrypt(cipherText string) string {
-	aes, err := aes.NewCipher([]byte(fixedTag))
-	if err != nil {
-		panic(err)
+func (p *LSNMPvS_Packet) checkErrorIndexes() error {
+	for i, e := range p.errorList {
+		if e.Index < 0 || e.Index > len(p.iidList) {
+			return fmt.Errorf("list item %d: index %d out of range", i+1, e.Index)
+		}
+	}
+	return nil
+}
+
+func Decrypt(cipherText string) (string, error) {
+	_, plainText, err := decryptFrame(cipherText)
+	return plainText, err
+}
+
+// decryptFrame opens a packet frame of any supported version. Version 2
+// frames start with the version byte, while version 1 frames start directly
+// with the key id, which can never begin with that byte.
+func decryptFrame(cipherText string) (byte, string, error) {
+	var (
+		version byte
+		keyID   string
+		err     error
+	)
+	if len(cipherText) > 0 && cipherText[0] == ProtocolV2 {
+		version = ProtocolV2
+		keyID, cipherText, err = CodableValues.DecodeBinaryString(cipherText[1:])
+	} else {
+		version = ProtocolV1
+		keyID, cipherText, err = CodableValues.DecodeString(cipherText)
 	}
-	gcm, err := cipher.NewGCM(aes)
 	if err != nil {
-		panic(err)
+		return 0, "", err
+	}
+	gcm, ok := keyring.get(keyID)
+	if !ok {
+		return 0, "", fmt.Errorf("unknown key id %q", keyID)
 	}
 	nonceSize := gcm.NonceSize()
+	if len(cipherText) < nonceSize+gcm.Overhead() {
+		return 0, "", fmt.Errorf("ciphertext too short")
+	}
 	nonce, cipherText := cipherText[:nonceSize], cipherText[nonceSize:]
-	plainText, err := gcm.Open(nil, []byte(nonce), []byte(cipherText), nil)
+	plainText, err := gcm.Open(nil, []byte(nonce), []byte(cipherText), additionalData(version, keyID))
 	if err != nil {
-		panic(err)
+		return 0, "", err
 	}
-	return string(plainText)
+	return version, string(plainText), nil
 }
 
+// additionalData authenticates the header of a frame along with its payload,
+// so its version or key id can't be swapped without the frame failing to open.
+func additionalData(version byte, keyID string) []byte {
+	return append([]byte{version}, keyID...)
+}
 
 func (p *LSNMPvS_Packet) Equal(other *LSNMPvS_Packet) bool {
 	if p.tag != other.tag {
 		return false
 	}
+	if p.version != other.version {
+		return false
+	}
 	if p.pType != other.pType {
 		return false
 	}
@@ -291,6 +622,9 @@ func (p *LSNMPvS_Packet) Equal(other *LSNMPvS_Packet) bool {
 	if p.messageId != other.messageId {
 		return false
 	}
+	if p.credentials != other.credentials {
+		return false
+	}
 	if len(p.errorList) != len(other.errorList) {
 		return false
 	}
@@ -304,6 +638,7 @@ func (p *LSNMPvS_Packet) Equal(other *LSNMPvS_Packet) bool {
 
 func (p *LSNMPvS_Packet) String() string {
 	return "Tag: " + p.tag + "\n" +
+		"Version: " + strconv.Itoa(int(p.version)) + "\n" +
 		"Type: " + string(p.pType) + "\n" +
 		"Timestamp: " + p.timestamp.String() + "\n" +
 		"Message ID: " + p.messageId + "\n" +
@@ -317,8 +652,8 @@ func (p *LSNMPvS_Packet) RenderPacketWithLipgloss(width int) string {
 	tWidth := width - 4
 	TitleStyle := lipgloss.NewStyle().Width(tWidth).Align(lipgloss.Center).Border(lipgloss.RoundedBorder(), false, false, true).BorderForeground(lipgloss.ANSIColor(208)).Foreground(lipgloss.ANSIColor(208))
 	// TableStyle := table.New().Width(tWidth).Border(lipgloss.RoundedBorder()).BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("99")))
-	Headers := []string{"Tag", "Type", "Timestamp", "Message ID"}
-	Values := []string{p.tag, string(p.pType), p.timestamp.String(), p.messageId}
+	Headers := []string{"Tag", "Version", "Type", "Timestamp", "Message ID"}
+	Values := []string{p.tag, strconv.Itoa(int(p.version)), string(p.pType), p.timestamp.String(), p.messageId}
 	rendered = TitleStyle.Render("Headers")
 	rendered = lipgloss.JoinVertical(lipgloss.Center, rendered, renderTableWithLipGloss(Headers, Values, tWidth), TitleStyle.Render("IID Values Pairs"))
 	if len(p.iidList) > 0 {
@@ -330,18 +665,20 @@ func (p *LSNMPvS_Packet) RenderPacketWithLipgloss(width int) string {
 			if i > len(p.valueList) {
 				Value = append(Value, "")
 			} else {
-				Value = append(Value, p.valueList[i].String())
+				Value = append(Value, p.valueList[i].Render())
 			}
 		}
 		rendered = lipgloss.JoinVertical(lipgloss.Center, rendered, renderTableWithLipGloss(IID, Value, tWidth))
 	}
 	rendered = lipgloss.JoinVertical(lipgloss.Center, rendered, TitleStyle.Render("Errors"))
 	if len(p.errorList) > 0 {
+		Sources := []string{}
 		Errors := []string{}
 		for _, v := range p.errorList {
-			Errors = append(Errors, fmt.Sprintf("Error code %d: %v", v, PacketErr(v)))
+			Sources = append(Sources, p.errorSource(v))
+			Errors = append(Errors, v.Error())
 		}
-		rendered = lipgloss.JoinVertical(lipgloss.Center, rendered, renderTableWithLipGloss([]string{"Errors"}, Errors, tWidth))
+		rendered = lipgloss.JoinVertical(lipgloss.Center, rendered, renderTableWithLipGloss(Sources, Errors, tWidth))
 	}
 	rendered = lipgloss.NewStyle().Width(width - 2).Align(lipgloss.Center).Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.ANSIColor(27)).Render(rendered)
 	return rendered
@@ -367,15 +704,22 @@ func (p *LSNMPvS_Packet) VerifyAndGetType() (byte, PacketErr) {
 	if p.tag != fixedTag {
 		return 0, ErrorIncorrectTag
 	}
-	if p.pType != 'G' && p.pType != 'S' && p.pType != 'R' && p.pType != 'N' {
+	if p.pType != 'G' && p.pType != 'S' && p.pType != 'R' && p.pType != 'N' && p.pType != 'X' && p.pType != 'B' && p.pType != 'I' && p.pType != 'C' {
 		return 0, ErrorInvalidType
 	}
 	return p.pType, 0
 }
 
+// GetIidValuePairList returns the entries of the packet in the order of its
+// IID list, so their positions match the indexes of its errors.
 func (p *LSNMPvS_Packet) GetIidValuePairList() []types.IdValuePair {
 	var idValuePairList []types.IdValuePair
+	var iList []int
 	for i := range p.iidList {
+		iList = append(iList, i)
+	}
+	sort.Ints(iList)
+	for _, i := range iList {
 		idValuePairList = append(idValuePairList, types.IdValuePair{
 			IID:   p.iidList[i],
 			Value: p.valueList[i],
@@ -384,7 +728,22 @@ func (p *LSNMPvS_Packet) GetIidValuePairList() []types.IdValuePair {
 	return idValuePairList
 }
 
-func (p *LSNMPvS_Packet) GetUncompressedIdValuePairList(structureLengths map[int]map[int]int) ([]types.IdValuePair, bool) {
+// GetUncompressedIdValuePairList expands the ranges of the IID list, returning
+// ErrorInvalidGroupIndexes for invalid ranges and ErrorTooBig when they expand
+// to more IIDs than allowed.
+func (p *LSNMPvS_Packet) GetUncompressedIdValuePairList(structureLengths map[int]map[int]int) ([]types.IdValuePair, PacketErr) {
+	return p.uncompress(structureLengths, 0)
+}
+
+// GetUncompressedConditionList returns the conditions of a conditional Set
+// matching the entries of GetUncompressedIdValuePairList.
+func (p *LSNMPvS_Packet) GetUncompressedConditionList(structureLengths map[int]map[int]int) ([]types.IdValuePair, PacketErr) {
+	return p.uncompress(structureLengths, len(p.iidList))
+}
+
+// uncompress pairs every IID expanded from the IID list with the value found
+// offset positions after the IID's own in the value list.
+func (p *LSNMPvS_Packet) uncompress(structureLengths map[int]map[int]int, offset int) ([]types.IdValuePair, PacketErr) {
 	var idValuePairList []types.IdValuePair
 	var iList []int
 	for i := range p.iidList {
@@ -392,14 +751,17 @@ func (p *LSNMPvS_Packet) GetUncompressedIdValuePairList(structureLengths map[int
 	}
 	sort.Ints(iList)
 	for _, i := range iList {
-		v, ok := p.valueList[i]
+		v, ok := p.valueList[i+offset]
 		if !ok {
 			v = nil
 		}
 		compressedIID := p.iidList[i].Value.(*CodableValues.IID)
 		uncompressedList, res := compressedIID.GenListOfIIDs(structureLengths[compressedIID.Structure][compressedIID.Object])
 		if !res {
-			return nil, false
+			return nil, ErrorInvalidGroupIndexes
+		}
+		if len(idValuePairList)+len(uncompressedList) > GetLimits().MaxExpandedIIDs {
+			return nil, ErrorTooBig
 		}
 		for _, rawIID := range uncompressedList {
 			if rawIID.FirstIndex == nil {
@@ -416,25 +778,74 @@ func (p *LSNMPvS_Packet) GetUncompressedIdValuePairList(structureLengths map[int
 			})
 		}
 	}
-	return idValuePairList, true
+	return idValuePairList, 0
 }
 
-func (p *LSNMPvS_Packet) SendPacketTo(remAddr net.UDPAddr) error {
-	encoded := p.Encode()
-	conn, err := net.DialUDP("udp", nil, &remAddr)
-	if err != nil {
-		return err
+func (p *LSNMPvS_Packet) GetMessageID() string {
+	return p.messageId
+}
+
+func (p *LSNMPvS_Packet) GetType() byte {
+	return p.pType
+}
+
+// GetTimestamp returns when a request was sent, or the uptime of the device
+// that sent a response or notification.
+func (p *LSNMPvS_Packet) GetTimestamp() *types.CompleteCodableValue {
+	return p.timestamp
+}
+
+// GetValueList returns every value of the packet, including those after the
+// ones paired with IIDs, like the conditions of a conditional Set.
+func (p *LSNMPvS_Packet) GetValueList() types.CodableList {
+	return p.valueList
+}
+
+// IsRequest tells if the packet expects a response.
+func (p *LSNMPvS_Packet) IsRequest() bool {
+	switch p.pType {
+	case 'G', 'S', 'X', 'B', 'I', 'C':
+		return true
 	}
-	_, err = conn.Write([]byte(encoded))
-	return err
+	return false
 }
 
-func (p *LSNMPvS_Packet) GetMessageID() string {
-	return p.messageId
+// Reissue gives a request a new message id and timestamp, so it can be sent
+// again without being rejected as a replay.
+func (p *LSNMPvS_Packet) Reissue() {
+	p.messageId = RandStringBytes()
+	p.timestamp = types.NewCodableTimestampNow()
+}
+
+func (p *LSNMPvS_Packet) GetVersion() byte {
+	return p.version
+}
+
+func (p *LSNMPvS_Packet) SetVersion(version byte) {
+	p.version = version
+}
+
+// HasSendTime tells if the timestamp of the packet is the date it was sent,
+// as in requests. Responses, notifications and informs carry the uptime of
+// the agent instead.
+func (p *LSNMPvS_Packet) HasSendTime() bool {
+	_, ok := p.timestamp.Value.(*CodableValues.Timestamp)
+	return ok
+}
+
+// InReplayWindow tells if the packet was sent less than window away from now.
+// Packets without a send time are always in the window, so only their message
+// id tells a replay of them apart.
+func (p *LSNMPvS_Packet) InReplayWindow(now time.Time, window time.Duration) bool {
+	ts, ok := p.timestamp.Value.(*CodableValues.Timestamp)
+	if !ok {
+		return true
+	}
+	age := now.Sub(ts.Ts)
+	return age <= window && age >= -window
 }
 
 func (p *LSNMPvS_Packet) VerifyIfPacketIsDuplicate(other *LSNMPvS_Packet) bool {
-	// if other.timestamp.Value.(*CodableValues.Timestamp).Ts.Sub(p.timestamp.Value.(*CodableValues.Timestamp).Ts) < 10 * time.Second {
 	if other.pType == p.pType && other.messageId == p.messageId && p.pType != 'N' {
 		return true
 	} else {
@@ -442,10 +853,51 @@ func (p *LSNMPvS_Packet) VerifyIfPacketIsDuplicate(other *LSNMPvS_Packet) bool {
 	}
 }
 
+func (p *LSNMPvS_Packet) GetCredentials() Credentials {
+	return p.credentials
+}
+
+func (p *LSNMPvS_Packet) SetCredentials(credentials Credentials) {
+	p.credentials = credentials
+}
+
+func (p *LSNMPvS_Packet) GetErrors() []ErrorEntry {
+	return p.errorList
+}
+
+// HasError tells if pErr was reported for the packet or any of its IIDs.
+func (p *LSNMPvS_Packet) HasError(pErr PacketErr) bool {
+	for _, v := range p.errorList {
+		if v.Code == pErr {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPacketError tells if any error applies to the whole packet rather than
+// to a single IID, in which case none of its values can be trusted.
+func (p *LSNMPvS_Packet) HasPacketError() bool {
+	for _, v := range p.errorList {
+		if v.Index == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// errorSource describes what caused e, the IID it points to or the packet.
+func (p *LSNMPvS_Packet) errorSource(e ErrorEntry) string {
+	if iid, ok := p.iidList[e.Index]; ok && e.Index > 0 {
+		return iid.String()
+	}
+	return "Packet"
+}
+
 func (p *LSNMPvS_Packet) TryLogErrors(logger *CustomLogger.CustomLogger) bool {
 	if len(p.errorList) > 0 {
 		for _, v := range p.errorList {
-			logger.LogError(fmt.Sprintf("Error code %d: %v", v, PacketErr(v)), "Request")
+			logger.LogError(fmt.Sprintf("%s on %s", v.Error(), p.errorSource(v)), "Request")
 		}
 		return true
 	}
@@ -1,11 +1,15 @@
 package packet
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types"
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
 )
 
 func TestPacketCoding(t *testing.T) {
@@ -22,7 +26,7 @@ func TestPacketCoding(t *testing.T) {
 	// }
 	p1 := &LSNMPvS_Packet{}
 	_, err := p1.Decode(encoded)
-	if err != 0 {
+	if err != nil {
 		t.Errorf(err.Error())
 	}
 	if !p1.Equal(p) {
@@ -32,12 +36,592 @@ func TestPacketCoding(t *testing.T) {
 	fmt.Println(p1)
 }
 
+func TestPacketCodingV1(t *testing.T) {
+	p := newExampleResponsePacket()
+	p.SetVersion(ProtocolV1)
+	encoded := p.Encode()
+	if encoded[0] == ProtocolV2 {
+		t.Errorf("Version 1 frame starts with the version 2 marker")
+	}
+	p1 := &LSNMPvS_Packet{}
+	if _, err := p1.Decode(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if p1.GetVersion() != ProtocolV1 || !p1.Equal(p) {
+		t.Errorf("Error in Decoding version 1 Packet")
+	}
+}
+
+func TestPacketCodingV2(t *testing.T) {
+	p := newExampleResponsePacket()
+	p.SetVersion(ProtocolV2)
+	encoded := p.Encode()
+	if encoded[0] != ProtocolV2 {
+		t.Errorf("Version 2 frame doesn't start with its version")
+	}
+	p1 := &LSNMPvS_Packet{}
+	if _, err := p1.Decode(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if p1.GetVersion() != ProtocolV2 || !p1.Equal(p) {
+		t.Errorf("Error in Decoding version 2 Packet")
+	}
+	if len(p.encodeBinary()) >= len(p.encodeText()) {
+		t.Errorf("Binary encoding isn't smaller than the text one")
+	}
+}
+
+func TestPacketCodingUnsafeStrings(t *testing.T) {
+	for _, version := range []byte{ProtocolV1, ProtocolV2} {
+		p := NewNotificationPacket([]types.IdValuePair{
+			{IID: types.NewCodableIID(1, 1, []int{1}), Value: types.NewCodableString("Kitchen\x00Agent")},
+			{IID: types.NewCodableIID(1, 2, []int{1}), Value: types.NewCodableString("Luz e\nAr Condicionado 💡")},
+		}, types.NewCodableDuration(time.Minute))
+		p.messageId = "id\x00with\x01nulls"
+		p.SetVersion(version)
+		p1 := &LSNMPvS_Packet{}
+		if _, err := p1.Decode(p.Encode()); err != nil {
+			t.Fatalf("Version %d: %v", version, err)
+		}
+		if !p1.Equal(p) {
+			t.Errorf("Version %d: strings with null bytes weren't preserved", version)
+		}
+	}
+}
+
+func TestPacketCodingErrorIndexes(t *testing.T) {
+	for _, version := range []byte{ProtocolV1, ProtocolV2} {
+		request := newExampleGetPacket()
+		p := request.NewResponsePacketWithErrors([]types.IdValuePair{
+			{IID: types.NewCodableIID(1, 1, []int{1}), Value: types.NewCodableString("KitchenAgent")},
+			{IID: types.NewCodableIID(1, 9, []int{1}), Value: types.NewCodableNull()},
+			{IID: types.NewCodableIID(2, 3, []int{7}), Value: types.NewCodableNull()},
+		}, []ErrorEntry{{Index: 2, Code: ErrorObjectIdDoesntExist}, {Index: 3, Code: ErrorIndexOutOfRange}}, types.NewCodableDuration(time.Minute))
+		p.SetVersion(version)
+		p1 := &LSNMPvS_Packet{}
+		if _, err := p1.Decode(p.Encode()); err != nil {
+			t.Fatalf("Version %d: %v", version, err)
+		}
+		if !p1.Equal(p) || p1.HasPacketError() {
+			t.Errorf("Version %d: error indexes weren't preserved", version)
+		}
+		if p1.errorSource(p1.GetErrors()[1]) != p1.iidList[3].String() {
+			t.Errorf("Version %d: error doesn't point to its iid", version)
+		}
+	}
+}
+
+func TestPacketDecodingWithoutErrorIndexes(t *testing.T) {
+	p := NewErrorDecodingPacket(ErrorIncorrectTag)
+	p.timestamp = types.NewCodableTimestamp(time.Date(2024, 7, 8, 23, 0, 15, 152000000, time.UTC))
+	payload := p.encodeText()
+	// Packets from older devices end right after the error codes
+	legacy := payload[:len(payload)-len("1\x000\x00")]
+	p1 := &LSNMPvS_Packet{}
+	if _, err := p1.decodePlainText(legacy); err != nil {
+		t.Fatal(err)
+	}
+	p1.version = ProtocolV1
+	if !p1.Equal(p) || !p1.HasPacketError() {
+		t.Errorf("Errors without indexes should apply to the whole packet")
+	}
+	p.AppendError(5, ErrorInvalidIID)
+	if _, err := p1.decodePlainText(p.encodeText()); err == nil {
+		t.Errorf("Error indexes outside the iid list should fail to decode")
+	}
+}
+
+func TestPacketCodingCredentials(t *testing.T) {
+	for _, version := range []byte{ProtocolV1, ProtocolV2} {
+		p := newExampleGetPacket()
+		p.timestamp = types.NewCodableTimestamp(time.Date(2024, 7, 8, 23, 0, 15, 152000000, time.UTC))
+		p.SetVersion(version)
+		p.SetCredentials(Credentials{User: "admin", Secret: "s3cr\x00t"})
+		p1 := &LSNMPvS_Packet{}
+		if _, err := p1.Decode(p.Encode()); err != nil {
+			t.Fatalf("Version %d: %v", version, err)
+		}
+		if !p1.Equal(p) || p1.GetCredentials() != p.GetCredentials() {
+			t.Errorf("Version %d: credentials weren't preserved, got %+v", version, p1.GetCredentials())
+		}
+		// Responses don't carry the credentials of the request
+		resp := p1.NewResponsePacket(nil, types.NewCodableDuration(time.Minute))
+		if resp.GetCredentials() != (Credentials{}) {
+			t.Errorf("Version %d: response carries credentials", version)
+		}
+	}
+}
+
+func TestGetNextPacketCoding(t *testing.T) {
+	iidList := types.CodableList{}
+	iidList.Append(types.NewCodableIID(2, 3, []int{1}))
+	p := NewGetNextRequestPacket(iidList)
+	p.timestamp = types.NewCodableTimestamp(time.Date(2024, 7, 8, 23, 0, 15, 152000000, time.UTC))
+	p1 := &LSNMPvS_Packet{}
+	if _, err := p1.Decode(p.Encode()); err != nil {
+		t.Fatal(err)
+	}
+	if pType, pErr := p1.VerifyAndGetType(); pErr != 0 || pType != 'X' || !p1.Equal(p) {
+		t.Errorf("Error in Decoding GetNext Packet")
+	}
+}
+
+func TestConditionalSetPacketCoding(t *testing.T) {
+	iidList := types.CodableList{}
+	iidList.Append(types.NewCodableIID(3, 3, []int{1, 2}))
+	iidList.Append(types.NewCodableIID(1, 3, []int{}))
+	valueList := types.CodableList{}
+	valueList.Append(types.NewCodableInt(4))
+	valueList.Append(types.NewCodableInt(30))
+	conditionList := types.CodableList{}
+	conditionList.Append(types.NewCodableInt(1))
+	p := NewConditionalSetRequestPacket(iidList, valueList, conditionList)
+	p1 := &LSNMPvS_Packet{}
+	if _, err := p1.Decode(p.Encode()); err != nil {
+		t.Fatal(err)
+	}
+	if pType, pErr := p1.VerifyAndGetType(); pErr != 0 || pType != 'C' || !p1.IsRequest() {
+		t.Fatalf("Error in Decoding Conditional Set Packet")
+	}
+	lengths := map[int]map[int]int{3: {3: 2}, 1: {3: 1}}
+	pairs, pErr := p1.GetUncompressedIdValuePairList(lengths)
+	conditions, pErrConditions := p1.GetUncompressedConditionList(lengths)
+	if pErr != 0 || pErrConditions != 0 || len(pairs) != 3 || len(conditions) != 3 {
+		t.Fatalf("Got %d pairs and %d conditions, expected 3", len(pairs), len(conditions))
+	}
+	for i, expected := range []int{1, 1} {
+		if !conditions[i].IID.Equals(pairs[i].IID) || !conditions[i].Value.Equals(types.NewCodableInt(expected)) {
+			t.Errorf("Condition %d is %v for %v", i+1, conditions[i].Value, conditions[i].IID)
+		}
+	}
+	if !pairs[2].Value.Equals(types.NewCodableInt(30)) || conditions[2].Value.DataType != 'N' {
+		t.Errorf("IID without condition got %v", conditions[2].Value)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	defer SetLimits(DefaultLimits)
+	SetLimits(Limits{MaxListLength: 2, MaxExpandedIIDs: 3, MaxStringLength: 4})
+	for _, version := range []byte{ProtocolV1, ProtocolV2} {
+		iidList := types.CodableList{}
+		for i := 1; i <= 3; i++ {
+			iidList.Append(types.NewCodableIID(1, i, []int{}))
+		}
+		p := NewGetRequestPacket(iidList)
+		p.SetVersion(version)
+		if _, err := (&LSNMPvS_Packet{}).Decode(p.Encode()); DecodeErrorCode(err) != ErrorTooBig {
+			t.Errorf("Version %d: decoding a list over the limit gave %v", version, err)
+		}
+		iidList = types.CodableList{}
+		iidList.Append(types.NewCodableIID(1, 1, []int{}))
+		valueList := types.CodableList{}
+		valueList.Append(types.NewCodableString("12345"))
+		p = NewSetResponsePacket(iidList, valueList)
+		p.SetVersion(version)
+		if _, err := (&LSNMPvS_Packet{}).Decode(p.Encode()); DecodeErrorCode(err) != ErrorTooBig {
+			t.Errorf("Version %d: decoding a string over the limit gave %v", version, err)
+		}
+	}
+	if DecodeErrorCode(fmt.Errorf("not a decode error")) != ErrorDecodingPacket {
+		t.Errorf("Other errors should be decoding errors")
+	}
+	iidList := types.CodableList{}
+	iidList.Append(types.NewCodableIID(2, 1, []int{1, 3}))
+	p := NewGetRequestPacket(iidList)
+	lengths := map[int]map[int]int{2: {1: 10, 2: 10}}
+	if pairs, pErr := p.GetUncompressedIdValuePairList(lengths); pErr != 0 || len(pairs) != 3 {
+		t.Errorf("Expanding 3 IIDs gave %d pairs and error %d", len(pairs), pErr)
+	}
+	iidList.Append(types.NewCodableIID(2, 2, []int{1, 1}))
+	if _, pErr := p.GetUncompressedIdValuePairList(lengths); pErr != ErrorTooBig {
+		t.Errorf("Expanding 4 IIDs gave error %d", pErr)
+	}
+	iidList = types.CodableList{}
+	iidList.Append(types.NewCodableIID(2, 1, []int{3, 1}))
+	if _, pErr := NewGetRequestPacket(iidList).GetUncompressedIdValuePairList(lengths); pErr != ErrorInvalidGroupIndexes {
+		t.Errorf("Invalid range gave error %d", pErr)
+	}
+}
+
+func TestFragmentation(t *testing.T) {
+	iidList := types.CodableList{}
+	valueList := types.CodableList{}
+	for i := 1; i <= 20; i++ {
+		iidList.Append(types.NewCodableIID(2, 1, []int{i}))
+		valueList.Append(types.NewCodableString(fmt.Sprintf("sensor number %d", i)))
+	}
+	p := NewSetResponsePacket(iidList, valueList)
+	frame := p.Encode()
+	if frames := FragmentFrame(frame, p.GetMessageID()); len(frames) != 1 || string(frames[0]) != frame {
+		t.Fatalf("Frame that fits in a datagram was fragmented")
+	}
+	fragments := fragment(frame, p.GetMessageID(), 100)
+	if len(fragments) < 3 {
+		t.Fatalf("Got %d fragments for a frame of %d bytes", len(fragments), len(frame))
+	}
+	r := NewReassembler(time.Second)
+	now := time.Now()
+	// Fragments may arrive out of order
+	for i := len(fragments) - 1; i > 0; i-- {
+		if len(fragments[i]) > 100 {
+			t.Errorf("Fragment %d has %d bytes", i, len(fragments[i]))
+		}
+		if _, complete, err := r.addAt("a", fragments[i], now); complete || err != nil {
+			t.Fatalf("Fragment %d completed the packet or failed: %v", i, err)
+		}
+	}
+	if _, _, err := r.addAt("a", fragments[1], now); err == nil {
+		t.Errorf("Repeated fragment was accepted")
+	}
+	if _, complete, _ := r.addAt("b", fragments[0], now); complete {
+		t.Errorf("Fragments from other sources were mixed")
+	}
+	reassembled, complete, err := r.addAt("a", fragments[0], now)
+	if !complete || err != nil || reassembled != frame {
+		t.Fatalf("Packet wasn't reassembled: %v", err)
+	}
+	p1 := &LSNMPvS_Packet{}
+	if _, err := p1.Decode(reassembled); err != nil || p1.GetMessageID() != p.GetMessageID() || len(p1.GetIidValuePairList()) != 20 {
+		t.Fatalf("Reassembled packet doesn't match: %v", err)
+	}
+	if stats := r.Stats(); stats.Completed != 1 || stats.Pending != 1 || stats.Dropped != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	r.addAt("a", fragments[0], now.Add(2*time.Second))
+	if stats := r.Stats(); stats.TimedOut != 1 || stats.Pending != 1 {
+		t.Errorf("Incomplete packet didn't time out: %+v", stats)
+	}
+	if datagram, complete, err := r.Add("a", []byte(frame)); !complete || err != nil || datagram != frame {
+		t.Errorf("Unfragmented frame wasn't passed through")
+	}
+	tooMany := []byte(fragmentHeader(p.GetMessageID(), 0, maxFragments+1) + "x")
+	if _, _, err := r.Add("c", tooMany); DecodeErrorCode(err) != ErrorTooBig {
+		t.Errorf("Too many fragments gave %v", err)
+	}
+}
+
+func TestReassemblyLimitPerSource(t *testing.T) {
+	r := NewReassembler(time.Second)
+	now := time.Now()
+	first := func(i int) []byte {
+		return []byte(fragmentHeader(fmt.Sprintf("message%d", i), 0, 2) + "x")
+	}
+	if _, _, err := r.addAt("b", first(0), now); err != nil {
+		t.Fatal(err)
+	}
+	// A flood from a keeps only its newest packets, without pushing b out
+	for i := 0; i < maxPendingReassemblies; i++ {
+		if _, _, err := r.addAt("a", first(i), now); err != nil {
+			t.Fatalf("Packet %d from a was rejected: %v", i, err)
+		}
+	}
+	if stats := r.Stats(); stats.Pending != maxPendingPerSource+1 {
+		t.Errorf("%d packets pending, expected %d", stats.Pending, maxPendingPerSource+1)
+	}
+	if _, complete, err := r.addAt("b", []byte(fragmentHeader("message0", 1, 2)+"y"), now); !complete || err != nil {
+		t.Errorf("Packet from b wasn't reassembled: %v", err)
+	}
+	if _, complete, _ := r.addAt("a", []byte(fragmentHeader("message0", 1, 2)+"y"), now); complete {
+		t.Errorf("Oldest packet from a wasn't given up on")
+	}
+}
+
+func TestPacketJSON(t *testing.T) {
+	p := newExampleResponsePacket()
+	p.AppendError(3, ErrorIndexOutOfRange)
+	p.SetCredentials(Credentials{User: "admin", Secret: "secret"})
+	encoded, err := p.MarshalJSONWithSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p1 := &LSNMPvS_Packet{}
+	if err := json.Unmarshal(encoded, p1); err != nil {
+		t.Fatal(err)
+	}
+	if !p1.Equal(p) {
+		t.Errorf("Packet changed going through JSON: %s", encoded)
+	}
+	p2 := &LSNMPvS_Packet{}
+	if _, err := p2.Decode(p1.Encode()); err != nil || !p2.Equal(p) {
+		t.Errorf("Packet read from JSON can't be encoded: %v", err)
+	}
+	var doc map[string]any
+	json.Unmarshal(encoded, &doc)
+	for _, field := range []string{"tag", "version", "type", "timestamp", "messageId", "iids", "values", "errors", "credentials"} {
+		if _, ok := doc[field]; !ok {
+			t.Errorf("Field %s is missing", field)
+		}
+	}
+	redacted, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(redacted), "secret") || !strings.Contains(string(redacted), `"user":"admin"`) {
+		t.Errorf("Secret isn't redacted: %s", redacted)
+	}
+	minimal := `{"type":"G","timestamp":{"type":"timestamp","value":"2024-07-08T23:00:15Z"},"messageId":"NEE6QSYZ28R520a3","iids":[{"type":"iid","value":"1.1"}]}`
+	if err := json.Unmarshal([]byte(minimal), p1); err != nil {
+		t.Fatal(err)
+	}
+	if pType, pErr := p1.VerifyAndGetType(); pErr != 0 || pType != 'G' || p1.GetVersion() != GetDefaultVersion() {
+		t.Errorf("Minimal packet isn't a valid Get: %d", pErr)
+	}
+	if err := json.Unmarshal([]byte(`{"type":"GG","timestamp":{"type":"null"}}`), p1); err == nil {
+		t.Errorf("Decoded packet with invalid type")
+	}
+	var decodeErr *DecodeError
+	notIID := `{"type":"G","timestamp":{"type":"timestamp","value":"2024-07-08T23:00:15Z"},"iids":[{"type":"int","value":1}]}`
+	if err := json.Unmarshal([]byte(notIID), p1); !errors.As(err, &decodeErr) {
+		t.Errorf("Decoded packet with an int in its iids: %v", err)
+	}
+	badIndex := `{"type":"R","timestamp":{"type":"timestamp","value":"2024-07-08T23:00:15Z"},"iids":[{"type":"iid","value":"1.1"}],"errors":[{"index":2,"code":1}]}`
+	if err := json.Unmarshal([]byte(badIndex), p1); !errors.As(err, &decodeErr) {
+		t.Errorf("Decoded packet with an error pointing past its iids: %v", err)
+	}
+}
+
+func TestReissue(t *testing.T) {
+	p := newExampleGetPacket()
+	id := p.GetMessageID()
+	p.Reissue()
+	if p.GetMessageID() == id || !p.InReplayWindow(time.Now(), time.Second) {
+		t.Errorf("Reissued packet kept its message id or timestamp")
+	}
+}
+
+func TestGetBulkParameters(t *testing.T) {
+	iidList := types.CodableList{}
+	iidList.Append(types.NewCodableIID(1, 1, []int{0}))
+	iidList.Append(types.NewCodableIID(2, 1, []int{0}))
+	p := NewGetBulkRequestPacket(iidList, 3, 10, 0)
+	p1 := &LSNMPvS_Packet{}
+	if _, err := p1.Decode(p.Encode()); err != nil {
+		t.Fatal(err)
+	}
+	nonRepeaters, maxRepetitions, maxSize, pErr := p1.GetBulkParameters()
+	if pErr != 0 || nonRepeaters != 2 || maxRepetitions != 10 || maxSize != MaxPacketSize {
+		t.Errorf("Error in GetBulk parameters: %d %d %d %v", nonRepeaters, maxRepetitions, maxSize, pErr)
+	}
+	p1.valueList[2] = types.NewCodableString("10")
+	if _, _, _, pErr := p1.GetBulkParameters(); pErr != ErrorInvalidDataType {
+		t.Errorf("Non integer GetBulk parameters should be rejected")
+	}
+}
+
+func TestEntrySize(t *testing.T) {
+	for _, version := range []byte{ProtocolV1, ProtocolV2} {
+		p := newExampleResponsePacket()
+		p.SetVersion(version)
+		entry := types.IdValuePair{IID: types.NewCodableIID(2, 1, []int{1}), Value: types.NewCodableString("KitchenLuminositySensor")}
+		before := len(p.Encode())
+		p.AppendEntry(entry)
+		if len(p.Encode())-before != p.EntrySize(entry) {
+			t.Errorf("Version %d: wrong entry size", version)
+		}
+	}
+}
+
+func TestInformAcknowledgement(t *testing.T) {
+	inform := NewInformPacket([]types.IdValuePair{
+		{IID: types.NewCodableIID(1, 1, nil), Value: types.NewCodableString("KitchenAgent")},
+	}, types.NewCodableDuration(time.Minute))
+	p := &LSNMPvS_Packet{}
+	if _, err := p.Decode(inform.Encode()); err != nil {
+		t.Fatal(err)
+	}
+	if pType, pErr := p.VerifyAndGetType(); pErr != 0 || pType != 'I' || !p.IsRequest() {
+		t.Errorf("Informs should be valid requests")
+	}
+	ack := p.NewResponsePacket(nil, types.NewCodableDuration(0))
+	if ack.GetType() != 'R' || ack.GetMessageID() != inform.GetMessageID() {
+		t.Errorf("Acknowledgements should be responses with the message id of the inform")
+	}
+}
+
+func TestVersionNegotiation(t *testing.T) {
+	if NegotiateVersion(ProtocolV2, ProtocolV1) != ProtocolV1 {
+		t.Errorf("Should downgrade to the peer version")
+	}
+	if NegotiateVersion(ProtocolV1, ProtocolV2) != ProtocolV1 {
+		t.Errorf("Should never go above the preferred version")
+	}
+	if NegotiateVersion(ProtocolV2, 9) != ProtocolV2 {
+		t.Errorf("Unknown peer versions should be ignored")
+	}
+	request := NewGetRequestPacket(types.CodableList{})
+	request.SetVersion(ProtocolV1)
+	if request.NewResponsePacket(nil, types.NewCodableDuration(0)).GetVersion() != ProtocolV1 {
+		t.Errorf("Responses should use the version of the request")
+	}
+}
+
+func newExampleGetPacket() *LSNMPvS_Packet {
+	iidList := types.CodableList{}
+	iidList.Add(1, types.NewCodableIID(1, 1, []int{}))
+	iidList.Add(2, types.NewCodableIID(1, 6, []int{1}))
+	iidList.Add(3, types.NewCodableIID(2, 3, []int{0, 0}))
+	iidList.Add(4, types.NewCodableIID(3, 3, []int{1, 2}))
+	return NewGetRequestPacket(iidList)
+}
+
+func newExampleResponsePacket() *LSNMPvS_Packet {
+	now := time.Date(2024, 7, 8, 23, 0, 15, 152000000, time.UTC)
+	pairs := []types.IdValuePair{
+		{IID: types.NewCodableIID(1, 1, []int{1}), Value: types.NewCodableString("KitchenAgent")},
+		{IID: types.NewCodableIID(1, 2, []int{1}), Value: types.NewCodableString("Lights and AC")},
+		{IID: types.NewCodableIID(1, 3, []int{1}), Value: types.NewCodableInt(20)},
+		{IID: types.NewCodableIID(1, 6, []int{1}), Value: types.NewCodableTimestamp(now)},
+		{IID: types.NewCodableIID(1, 7, []int{1}), Value: types.NewCodableDuration(3*time.Hour + 15*time.Second)},
+		{IID: types.NewCodableIID(2, 3, []int{1}), Value: types.NewCodableInt(80)},
+		{IID: types.NewCodableIID(2, 3, []int{2}), Value: types.NewCodableInt(-5)},
+		{IID: types.NewCodableIID(3, 6, []int{1}), Value: types.NewCodableTimestamp(now)},
+	}
+	request := newExampleGetPacket()
+	return request.NewResponsePacket(pairs, types.NewCodableDuration(time.Minute))
+}
+
+func benchmarkEncode(b *testing.B, p *LSNMPvS_Packet, version byte) {
+	p.SetVersion(version)
+	b.SetBytes(int64(len(p.encodePayload())))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.encodePayload()
+	}
+}
+
+func benchmarkDecode(b *testing.B, p *LSNMPvS_Packet, version byte) {
+	p.SetVersion(version)
+	encoded := p.encodePayload()
+	b.SetBytes(int64(len(encoded)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p1 := &LSNMPvS_Packet{}
+		var err error
+		if version == ProtocolV2 {
+			_, err = p1.decodeBinary(encoded)
+		} else {
+			_, err = p1.decodePlainText(encoded)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeGetV1(b *testing.B)      { benchmarkEncode(b, newExampleGetPacket(), ProtocolV1) }
+func BenchmarkEncodeGetV2(b *testing.B)      { benchmarkEncode(b, newExampleGetPacket(), ProtocolV2) }
+func BenchmarkDecodeGetV1(b *testing.B)      { benchmarkDecode(b, newExampleGetPacket(), ProtocolV1) }
+func BenchmarkDecodeGetV2(b *testing.B)      { benchmarkDecode(b, newExampleGetPacket(), ProtocolV2) }
+func BenchmarkEncodeResponseV1(b *testing.B) { benchmarkEncode(b, newExampleResponsePacket(), ProtocolV1) }
+func BenchmarkEncodeResponseV2(b *testing.B) { benchmarkEncode(b, newExampleResponsePacket(), ProtocolV2) }
+func BenchmarkDecodeResponseV1(b *testing.B) { benchmarkDecode(b, newExampleResponsePacket(), ProtocolV1) }
+func BenchmarkDecodeResponseV2(b *testing.B) { benchmarkDecode(b, newExampleResponsePacket(), ProtocolV2) }
+
 
 func TestEncriprion(t *testing.T) {
 	text := "Hello, World!"
 	encrypted := Encrypt(text)
-	decrypted := Decrypt(encrypted)
+	decrypted, err := Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Error in Decryption: %v", err)
+	}
 	if text != decrypted {
 		t.Errorf("Error in Encryption")
 	}
-}
\ No newline at end of file
+	if Encrypt(text) == encrypted {
+		t.Errorf("Nonce was reused between packets")
+	}
+}
+
+func TestAuthenticatedDecodeErrors(t *testing.T) {
+	p := &LSNMPvS_Packet{}
+	if _, err := p.Decode("not a packet"); err == nil || Authenticated(err) {
+		t.Errorf("Frames that fail to decrypt shouldn't be answered: %v", err)
+	}
+	if _, err := p.Decode(Encrypt("not a packet")); err == nil || !Authenticated(err) {
+		t.Errorf("Frames that decrypt but fail to parse should be answered: %v", err)
+	}
+	if _, _, err := NewReassembler(time.Second).Add("peer", []byte{fragmentMarker, 0, 0}); err == nil || Authenticated(err) {
+		t.Errorf("Fragments that fail to reassemble shouldn't be answered: %v", err)
+	}
+	if NewErrorDecodingPacket(ErrorDecodingPacket).messageId == NewErrorDecodingPacket(ErrorDecodingPacket).messageId {
+		t.Errorf("Error packets should have their own message ids")
+	}
+}
+
+func TestEncryptedHeader(t *testing.T) {
+	sealed := encryptFrame(ProtocolV2, "header")
+	keyID, cipherText, err := CodableValues.DecodeBinaryString(sealed[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(CodableValues.EncodeString(keyID) + cipherText); err == nil {
+		t.Errorf("Version 2 frame opened as version 1")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	defer SetKeyring(NewLegacyKeyring())
+	k := NewKeyring()
+	if err := k.AddKey("old", []byte("0123456789abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	SetKeyring(k)
+	sealedWithOld := Encrypt("rotate me")
+	if err := k.AddKey("new", []byte("fedcba9876543210fedcba9876543210")); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.SetActive("new"); err != nil {
+		t.Fatal(err)
+	}
+	SetKeyring(k)
+	if GetKeyring().ActiveKeyID() != "new" {
+		t.Errorf("Active key wasn't rotated")
+	}
+	if decrypted, err := Decrypt(sealedWithOld); err != nil || decrypted != "rotate me" {
+		t.Errorf("Packet sealed with the previous key should still be accepted: %v", err)
+	}
+	sealedWithNew := Encrypt("rotate me")
+	if err := k.RemoveKey("new"); err == nil {
+		t.Errorf("Active key was removed")
+	}
+	if err := k.SetActive("old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.RemoveKey("new"); err != nil {
+		t.Fatal(err)
+	}
+	SetKeyring(k)
+	if _, err := Decrypt(sealedWithNew); err == nil {
+		t.Errorf("Packet sealed with a removed key should be rejected")
+	}
+}
+
+func FuzzPacketDecode(f *testing.F) {
+	exampleIID := types.CodableList{}
+	exampleIID.Add(1, types.NewCodableIID(1, 1, []int{}))
+	exampleIID.Add(2, types.NewCodableIID(2, 3, []int{0, 0}))
+	values := types.CodableList{}
+	values.Add(1, types.NewCodableString("KitchenAgent"))
+	values.Add(2, types.NewCodableInt(-10))
+	f.Add([]byte(NewGetRequestPacket(exampleIID).Encode()))
+	f.Add([]byte(NewSetResponsePacket(exampleIID, values).Encode()))
+	f.Add([]byte(NewErrorDecodingPacket(ErrorDecodingPacket).Encode()))
+	f.Add([]byte(newExampleResponsePacket().Encode()))
+	f.Add([]byte(newExampleResponsePacket().encodeBinary()))
+	f.Add([]byte("kdk847ufh84jg87g\x00GT\x007\x008\x007\x002024\x0023\x000\x0015\x00152\x00NEE6QSYZ28R520a3\x001\x00D\x002\x001\x001\x000\x000\x00"))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p := &LSNMPvS_Packet{}
+		p.Decode(string(data))
+		// Encrypting the input lets the fuzzer reach the header decoding stages.
+		p.Decode(encryptFrame(ProtocolV2, string(data)))
+		if _, err := p.Decode(Encrypt(string(data))); err != nil {
+			return
+		}
+		p1 := &LSNMPvS_Packet{}
+		if _, err := p1.Decode(p.Encode()); err != nil {
+			t.Errorf("Re-encoded packet failed to decode: %v", err)
+		}
+	})
+}
@@ -1,15 +1,43 @@
 package types
 
 import (
+	"encoding/json"
+	"fmt"
 	"sort"
+	"sync/atomic"
 
 	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
 )
 
 type CodableList map[int]*CompleteCodableValue
 
+// DefaultMaxListLength is how many entries a decoded list can have unless
+// SetMaxListLength says otherwise.
+const DefaultMaxListLength = 1024
+
+var maxListLength atomic.Int64
+
+func init() {
+	maxListLength.Store(DefaultMaxListLength)
+}
+
+func SetMaxListLength(length int) {
+	maxListLength.Store(int64(length))
+}
+
+func checkListLength(length int) error {
+	if int64(length) > maxListLength.Load() {
+		return fmt.Errorf("list of %d items: %w", length, CodableValues.ErrTooBig)
+	}
+	return nil
+}
+
+// Append adds c after the last entry. Keys start at 1 like the ones produced
+// by Decode, so lists built here and received ones are indexed alike, the
+// positions of error entries included. They used to start at 0, which only
+// went unnoticed because encoding and GetIidValuePairList go by key order.
 func (l CodableList) Append(c *CompleteCodableValue) {
-	l[len(l)] = c
+	l[len(l)+1] = c
 }
 
 func (l CodableList) Add(i int, c *CompleteCodableValue) {
@@ -34,19 +62,87 @@ for k := range l {
 func (l CodableList) Decode(data string) (string, error) {
 	length, rest, err := CodableValues.DecodeInt(data)
 	if err != nil {
+		return "", fmt.Errorf("list length: %w", err)
+	}
+	if length < 0 {
+		return "", fmt.Errorf("list length %d: %w", length, CodableValues.ErrInvalidLength)
+	}
+	if err := checkListLength(length); err != nil {
 		return "", err
 	}
 	for i := 1; i <= length; i++ {
 		c := &CompleteCodableValue{}
 		rest, err = c.Decode(rest)
 		if err != nil {
-			return "", err
+			return "", fmt.Errorf("list item %d: %w", i, err)
+		}
+		l.Add(i, c)
+	}
+	return rest, nil
+}
+
+func (l CodableList) EncodeBinary() string {
+	keys := make([]int, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	encoded := CodableValues.EncodeUvarint(uint64(len(l)))
+	for _, k := range keys {
+		encoded += l[k].EncodeBinary()
+	}
+	return encoded
+}
+
+func (l CodableList) DecodeBinary(data string) (string, error) {
+	length, rest, err := CodableValues.DecodeBinaryLength(data)
+	if err != nil {
+		return "", fmt.Errorf("list length: %w", err)
+	}
+	if err := checkListLength(length); err != nil {
+		return "", err
+	}
+	for i := 1; i <= length; i++ {
+		c := &CompleteCodableValue{}
+		rest, err = c.DecodeBinary(rest)
+		if err != nil {
+			return "", fmt.Errorf("list item %d: %w", i, err)
 		}
 		l.Add(i, c)
 	}
 	return rest, nil
 }
 
+// MarshalJSON writes the list as an array in key order, which is how it's
+// encoded on the wire.
+func (l CodableList) MarshalJSON() ([]byte, error) {
+	keys := make([]int, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	values := make([]*CompleteCodableValue, 0, len(l))
+	for _, k := range keys {
+		values = append(values, l[k])
+	}
+	return json.Marshal(values)
+}
+
+func (l *CodableList) UnmarshalJSON(data []byte) error {
+	var values []*CompleteCodableValue
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*l = CodableList{}
+	for i, v := range values {
+		if v == nil {
+			return fmt.Errorf("list item %d is missing", i+1)
+		}
+		l.Append(v)
+	}
+	return nil
+}
+
 func (l CodableList) Equals(other interface{}) bool {
 	ActualValue := other.(CodableList)
 	if len(l) != len(ActualValue) {
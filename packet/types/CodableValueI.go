@@ -5,6 +5,8 @@ import "github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
 type CodableValueI interface {
 	Encode() string
 	Decode(string, *int) (string, error)
+	EncodeBinary() string
+	DecodeBinary(string, *int) (string, error)
 	Equals(interface{}) bool
 	String() string
 }
@@ -22,6 +24,16 @@ func CopyCodableValueI(ci CodableValueI) CodableValueI {
 		valueCopy = ciTrue.Copy()
 	case *CodableValues.Duration:
 		valueCopy = ciTrue.Copy()
+	case *CodableValues.CodableBool:
+		valueCopy = ciTrue.Copy()
+	case *CodableValues.CodableDecimal:
+		valueCopy = ciTrue.Copy()
+	case *CodableValues.CodableOctetString:
+		valueCopy = ciTrue.Copy()
+	case *CodableValues.CodableCounter:
+		valueCopy = ciTrue.Copy()
+	case *CodableValues.CodableNull:
+		valueCopy = ciTrue.Copy()
 	}
 	return valueCopy
 }
\ No newline at end of file
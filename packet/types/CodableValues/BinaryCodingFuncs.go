@@ -0,0 +1,93 @@
+package CodableValues
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Binary (protocol v2) counterparts of the text coding functions. Integers are
+// varints, fixed width values are big endian and strings are length prefixed.
+
+func EncodeVarint(value int64) string {
+	return string(binary.AppendVarint(nil, value))
+}
+
+func DecodeVarint(data string) (int64, string, error) {
+	value, n := binary.Varint([]byte(data[:min(len(data), binary.MaxVarintLen64)]))
+	if n == 0 {
+		return 0, "", ErrUnexpectedEnd
+	}
+	if n < 0 {
+		return 0, "", fmt.Errorf("varint overflows 64 bits")
+	}
+	return value, data[n:], nil
+}
+
+func EncodeUvarint(value uint64) string {
+	return string(binary.AppendUvarint(nil, value))
+}
+
+func DecodeUvarint(data string) (uint64, string, error) {
+	value, n := binary.Uvarint([]byte(data[:min(len(data), binary.MaxVarintLen64)]))
+	if n == 0 {
+		return 0, "", ErrUnexpectedEnd
+	}
+	if n < 0 {
+		return 0, "", fmt.Errorf("uvarint overflows 64 bits")
+	}
+	return value, data[n:], nil
+}
+
+func EncodeBinaryInt(value int) string {
+	return EncodeVarint(int64(value))
+}
+
+func DecodeBinaryInt(data string) (int, string, error) {
+	value, rest, err := DecodeVarint(data)
+	if err != nil {
+		return 0, "", err
+	}
+	if int64(int(value)) != value {
+		return 0, "", fmt.Errorf("int %d out of range", value)
+	}
+	return int(value), rest, nil
+}
+
+// DecodeBinaryLength reads an uvarint used as the length of what follows,
+// rejecting values that can't fit in the remaining data.
+func DecodeBinaryLength(data string) (int, string, error) {
+	value, rest, err := DecodeUvarint(data)
+	if err != nil {
+		return 0, "", err
+	}
+	if value > uint64(len(rest)) {
+		return 0, "", fmt.Errorf("length %d: %w", value, ErrInvalidLength)
+	}
+	return int(value), rest, nil
+}
+
+func EncodeFixed64(value int64) string {
+	return string(binary.BigEndian.AppendUint64(nil, uint64(value)))
+}
+
+func DecodeFixed64(data string) (int64, string, error) {
+	if len(data) < 8 {
+		return 0, "", ErrUnexpectedEnd
+	}
+	return int64(binary.BigEndian.Uint64([]byte(data[:8]))), data[8:], nil
+}
+
+func EncodeBinaryString(value string) string {
+	return EncodeUvarint(uint64(len(value))) + value
+}
+
+func DecodeBinaryString(data string) (string, string, error) {
+	length, rest, err := DecodeBinaryLength(data)
+	if err != nil {
+		return "", "", err
+	}
+	if err := checkStringLength(length); err != nil {
+		return "", "", err
+	}
+	return rest[:length], rest[length:], nil
+}
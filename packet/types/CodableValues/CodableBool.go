@@ -0,0 +1,69 @@
+package CodableValues
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+type CodableBool struct {
+	Value bool
+}
+
+func (cvb *CodableBool) Encode() string {
+	if cvb.Value {
+		return EncodeInt(1)
+	}
+	return EncodeInt(0)
+}
+
+func (cvb *CodableBool) Decode(data string, length *int) (string, error) {
+	value, rest, err := DecodeInt(data)
+	if err != nil {
+		return "", fmt.Errorf("bool: %w", err)
+	}
+	if value != 0 && value != 1 {
+		return "", fmt.Errorf("bool: invalid value %d", value)
+	}
+	cvb.Value = value == 1
+	return rest, nil
+}
+
+func (cvb *CodableBool) EncodeBinary() string {
+	if cvb.Value {
+		return "\x01"
+	}
+	return "\x00"
+}
+
+func (cvb *CodableBool) DecodeBinary(data string, length *int) (string, error) {
+	if len(data) == 0 {
+		return "", fmt.Errorf("bool: %w", ErrUnexpectedEnd)
+	}
+	if data[0] > 1 {
+		return "", fmt.Errorf("bool: invalid value %d", data[0])
+	}
+	cvb.Value = data[0] == 1
+	return data[1:], nil
+}
+
+func (cvb *CodableBool) Equals(other interface{}) bool {
+	ActualValue := other.(*CodableBool)
+	return cvb.Value == ActualValue.Value
+}
+
+func (cvb *CodableBool) String() string {
+	return strconv.FormatBool(cvb.Value)
+}
+
+func (cvb *CodableBool) Copy() *CodableBool {
+	return &CodableBool{Value: cvb.Value}
+}
+
+func (cvb *CodableBool) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cvb.Value)
+}
+
+func (cvb *CodableBool) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &cvb.Value)
+}
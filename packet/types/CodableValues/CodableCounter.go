@@ -0,0 +1,69 @@
+package CodableValues
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CodableCounter is a monotonically increasing 64 bit counter that wraps
+// around to zero when it overflows.
+type CodableCounter struct {
+	Value uint64
+}
+
+func (cvc *CodableCounter) Increment(delta uint64) {
+	cvc.Value += delta
+}
+
+func (cvc *CodableCounter) Encode() string {
+	return strconv.FormatUint(cvc.Value, 10) + NullCharStr
+}
+
+func (cvc *CodableCounter) Decode(data string, length *int) (string, error) {
+	splitted := strings.SplitN(data, NullCharStr, 2)
+	if len(splitted) != 2 {
+		return "", fmt.Errorf("counter: %w", ErrUnexpectedEnd)
+	}
+	value, err := strconv.ParseUint(splitted[0], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("counter: invalid value %q", splitted[0])
+	}
+	cvc.Value = value
+	return splitted[1], nil
+}
+
+func (cvc *CodableCounter) EncodeBinary() string {
+	return EncodeUvarint(cvc.Value)
+}
+
+func (cvc *CodableCounter) DecodeBinary(data string, length *int) (string, error) {
+	value, rest, err := DecodeUvarint(data)
+	if err != nil {
+		return "", fmt.Errorf("counter: %w", err)
+	}
+	cvc.Value = value
+	return rest, nil
+}
+
+func (cvc *CodableCounter) Equals(other interface{}) bool {
+	ActualValue := other.(*CodableCounter)
+	return cvc.Value == ActualValue.Value
+}
+
+func (cvc *CodableCounter) String() string {
+	return strconv.FormatUint(cvc.Value, 10)
+}
+
+func (cvc *CodableCounter) Copy() *CodableCounter {
+	return &CodableCounter{Value: cvc.Value}
+}
+
+func (cvc *CodableCounter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cvc.Value)
+}
+
+func (cvc *CodableCounter) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &cvc.Value)
+}
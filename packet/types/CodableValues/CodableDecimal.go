@@ -0,0 +1,163 @@
+package CodableValues
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const MaxDecimalScale = 18
+
+// CodableDecimal is a fixed-point number worth Value * 10^-Scale, so 21.5 is
+// sent as Value 215 with Scale 1.
+type CodableDecimal struct {
+	Value int64
+	Scale int
+}
+
+func NewDecimal(value int64, scale int) *CodableDecimal {
+	return &CodableDecimal{Value: value, Scale: scale}
+}
+
+func NewDecimalFromFloat(value float64, scale int) *CodableDecimal {
+	return &CodableDecimal{Value: int64(math.Round(value * math.Pow10(scale))), Scale: scale}
+}
+
+// ParseDecimal reads a number such as "-21.50", keeping as many decimal
+// places as were written.
+func ParseDecimal(text string) (*CodableDecimal, error) {
+	intPart, fracPart, _ := strings.Cut(strings.TrimSpace(text), ".")
+	if len(fracPart) > MaxDecimalScale {
+		return nil, fmt.Errorf("decimal %q has more than %d decimal places", text, MaxDecimalScale)
+	}
+	value, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid decimal %q", text)
+	}
+	return NewDecimal(value, len(fracPart)), nil
+}
+
+func (cvd *CodableDecimal) Float64() float64 {
+	return float64(cvd.Value) / math.Pow10(cvd.Scale)
+}
+
+func (cvd *CodableDecimal) Encode() string {
+	return EncodeInt64(cvd.Value) + EncodeInt(cvd.Scale)
+}
+
+func (cvd *CodableDecimal) Decode(data string, length *int) (string, error) {
+	value, rest, err := DecodeInt64(data)
+	if err != nil {
+		return "", fmt.Errorf("decimal value: %w", err)
+	}
+	scale, rest, err := DecodeInt(rest)
+	if err != nil {
+		return "", fmt.Errorf("decimal scale: %w", err)
+	}
+	if scale < 0 || scale > MaxDecimalScale {
+		return "", fmt.Errorf("decimal scale %d out of range", scale)
+	}
+	cvd.Value = value
+	cvd.Scale = scale
+	return rest, nil
+}
+
+func (cvd *CodableDecimal) EncodeBinary() string {
+	return EncodeVarint(cvd.Value) + EncodeUvarint(uint64(cvd.Scale))
+}
+
+func (cvd *CodableDecimal) DecodeBinary(data string, length *int) (string, error) {
+	value, rest, err := DecodeVarint(data)
+	if err != nil {
+		return "", fmt.Errorf("decimal value: %w", err)
+	}
+	scale, rest, err := DecodeUvarint(rest)
+	if err != nil {
+		return "", fmt.Errorf("decimal scale: %w", err)
+	}
+	if scale > MaxDecimalScale {
+		return "", fmt.Errorf("decimal scale %d out of range", scale)
+	}
+	cvd.Value = value
+	cvd.Scale = int(scale)
+	return rest, nil
+}
+
+// Compare returns -1, 0 or 1 depending on whether cvd is smaller, equal or
+// bigger than other, regardless of the scale each one was written with.
+func (cvd *CodableDecimal) Compare(other *CodableDecimal) int {
+	a, b := cvd.Value, other.Value
+	for scale := cvd.Scale; scale < other.Scale; scale++ {
+		if a > math.MaxInt64/10 || a < math.MinInt64/10 {
+			return compareFloats(cvd.Float64(), other.Float64())
+		}
+		a *= 10
+	}
+	for scale := other.Scale; scale < cvd.Scale; scale++ {
+		if b > math.MaxInt64/10 || b < math.MinInt64/10 {
+			return compareFloats(cvd.Float64(), other.Float64())
+		}
+		b *= 10
+	}
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func (cvd *CodableDecimal) Equals(other interface{}) bool {
+	ActualValue := other.(*CodableDecimal)
+	return cvd.Compare(ActualValue) == 0
+}
+
+func (cvd *CodableDecimal) String() string {
+	if cvd.Scale == 0 {
+		return strconv.FormatInt(cvd.Value, 10)
+	}
+	sign := ""
+	digits := strconv.FormatInt(cvd.Value, 10)
+	if cvd.Value < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	if len(digits) <= cvd.Scale {
+		digits = strings.Repeat("0", cvd.Scale-len(digits)+1) + digits
+	}
+	point := len(digits) - cvd.Scale
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+func (cvd *CodableDecimal) Copy() *CodableDecimal {
+	return NewDecimal(cvd.Value, cvd.Scale)
+}
+
+// MarshalJSON writes the decimal as a string like "21.50", which keeps its
+// scale and doesn't lose precision to floats.
+func (cvd *CodableDecimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cvd.String())
+}
+
+func (cvd *CodableDecimal) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	value, err := ParseDecimal(text)
+	if err != nil {
+		return err
+	}
+	*cvd = *value
+	return nil
+}
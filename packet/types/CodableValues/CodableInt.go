@@ -1,6 +1,10 @@
 package CodableValues
 
-import "strconv"
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
 
 
 type CodableInt struct {
@@ -14,7 +18,20 @@ func (cvi *CodableInt) Encode() string {
 func (cvi *CodableInt) Decode(data string, length *int) (string, error) {
 	value, rest, err := DecodeInt(data)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("int: %w", err)
+	}
+	cvi.Value = value
+	return rest, nil
+}
+
+func (cvi *CodableInt) EncodeBinary() string {
+	return EncodeBinaryInt(cvi.Value)
+}
+
+func (cvi *CodableInt) DecodeBinary(data string, length *int) (string, error) {
+	value, rest, err := DecodeBinaryInt(data)
+	if err != nil {
+		return "", fmt.Errorf("int: %w", err)
 	}
 	cvi.Value = value
 	return rest, nil
@@ -32,3 +49,11 @@ func (cvi *CodableInt) String() string {
 func (cvi *CodableInt) Copy() *CodableInt {
 	return &CodableInt{Value: cvi.Value}
 }
+
+func (cvi *CodableInt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cvi.Value)
+}
+
+func (cvi *CodableInt) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &cvi.Value)
+}
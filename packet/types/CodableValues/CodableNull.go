@@ -0,0 +1,42 @@
+package CodableValues
+
+// CodableNull stands in for the value of an IID that couldn't be read, so the
+// value list of a response stays aligned with its IID list.
+type CodableNull struct{}
+
+func (cvn *CodableNull) Encode() string {
+	return ""
+}
+
+func (cvn *CodableNull) Decode(data string, length *int) (string, error) {
+	return data, nil
+}
+
+func (cvn *CodableNull) EncodeBinary() string {
+	return ""
+}
+
+func (cvn *CodableNull) DecodeBinary(data string, length *int) (string, error) {
+	return data, nil
+}
+
+func (cvn *CodableNull) Equals(other interface{}) bool {
+	_, ok := other.(*CodableNull)
+	return ok
+}
+
+func (cvn *CodableNull) String() string {
+	return "null"
+}
+
+func (cvn *CodableNull) Copy() *CodableNull {
+	return &CodableNull{}
+}
+
+func (cvn *CodableNull) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+func (cvn *CodableNull) UnmarshalJSON(data []byte) error {
+	return nil
+}
@@ -0,0 +1,74 @@
+package CodableValues
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// CodableOctetString carries raw bytes. The text encoding writes them in hex
+// so they can never clash with the null terminator.
+type CodableOctetString struct {
+	Value []byte
+}
+
+func (cvo *CodableOctetString) Encode() string {
+	return EncodeString(hex.EncodeToString(cvo.Value))
+}
+
+func (cvo *CodableOctetString) Decode(data string, length *int) (string, error) {
+	hexValue, rest, err := DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("octet string: %w", err)
+	}
+	value, err := hex.DecodeString(hexValue)
+	if err != nil {
+		return "", fmt.Errorf("octet string: %w", err)
+	}
+	cvo.Value = value
+	return rest, nil
+}
+
+func (cvo *CodableOctetString) EncodeBinary() string {
+	return EncodeBinaryString(string(cvo.Value))
+}
+
+func (cvo *CodableOctetString) DecodeBinary(data string, length *int) (string, error) {
+	value, rest, err := DecodeBinaryString(data)
+	if err != nil {
+		return "", fmt.Errorf("octet string: %w", err)
+	}
+	cvo.Value = []byte(value)
+	return rest, nil
+}
+
+func (cvo *CodableOctetString) Equals(other interface{}) bool {
+	ActualValue := other.(*CodableOctetString)
+	return string(cvo.Value) == string(ActualValue.Value)
+}
+
+func (cvo *CodableOctetString) String() string {
+	return "0x" + hex.EncodeToString(cvo.Value)
+}
+
+func (cvo *CodableOctetString) Copy() *CodableOctetString {
+	return &CodableOctetString{Value: append([]byte{}, cvo.Value...)}
+}
+
+// MarshalJSON writes the bytes in hex, like the text encoding does.
+func (cvo *CodableOctetString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(cvo.Value))
+}
+
+func (cvo *CodableOctetString) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	value, err := hex.DecodeString(text)
+	if err != nil {
+		return fmt.Errorf("octet string: %w", err)
+	}
+	cvo.Value = value
+	return nil
+}
@@ -1,5 +1,10 @@
 package CodableValues
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 type CodableString struct {
 	Value string
 }
@@ -11,7 +16,20 @@ func (cvs *CodableString) Encode() string {
 func (cvs *CodableString) Decode(data string, length *int) (string, error) {
 	value, rest, err := DecodeString(data)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("string: %w", err)
+	}
+	cvs.Value = value
+	return rest, nil
+}
+
+func (cvs *CodableString) EncodeBinary() string {
+	return EncodeBinaryString(cvs.Value)
+}
+
+func (cvs *CodableString) DecodeBinary(data string, length *int) (string, error) {
+	value, rest, err := DecodeBinaryString(data)
+	if err != nil {
+		return "", fmt.Errorf("string: %w", err)
 	}
 	cvs.Value = value
 	return rest, nil
@@ -28,4 +46,12 @@ func (cvs *CodableString) String() string {
 
 func (cvs *CodableString) Copy() *CodableString {
 	return &CodableString{Value: cvs.Value}
-}
\ No newline at end of file
+}
+
+func (cvs *CodableString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cvs.Value)
+}
+
+func (cvs *CodableString) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &cvs.Value)
+}
@@ -1,17 +1,44 @@
 package CodableValues
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 const (
 	NullCharStr = string('\x00')
-	intPtrn	 = `^(\d+)\x00(.*)$`
-	
 )
 
+var (
+	ErrUnexpectedEnd = errors.New("unexpected end of data")
+	ErrInvalidLength = errors.New("invalid length")
+	ErrTooBig        = errors.New("bigger than allowed")
+)
+
+var maxStringLength atomic.Int64
+
+// DefaultMaxStringLength is how many bytes a decoded string can have unless
+// SetMaxStringLength says otherwise.
+const DefaultMaxStringLength = 4096
+
+func init() {
+	maxStringLength.Store(DefaultMaxStringLength)
+}
+
+func SetMaxStringLength(length int) {
+	maxStringLength.Store(int64(length))
+}
+
+func checkStringLength(length int) error {
+	if int64(length) > maxStringLength.Load() {
+		return fmt.Errorf("string of %d bytes: %w", length, ErrTooBig)
+	}
+	return nil
+}
+
 func EncodeInt(value int) string {
 	return strconv.Itoa(value) + NullCharStr
 }
@@ -21,11 +48,11 @@ func DecodeInt(data string) (int, string, error) {
 	if len(splitted) == 2 {
 		res, err := strconv.Atoi(splitted[0])
 		if err != nil {
-			return 0, "", err
+			return 0, "", fmt.Errorf("invalid int %q: %w", splitted[0], errors.Unwrap(err))
 		}
 		return res, splitted[1], nil
 	}
-	return 0, "", nil
+	return 0, "", ErrUnexpectedEnd
 }
 
 func EncodeInt64(value int64) string {
@@ -37,11 +64,11 @@ func DecodeInt64(data string) (int64, string, error) {
 	if len(splitted) == 2 {
 		res, err := strconv.ParseInt(splitted[0], 10, 64)
 		if err != nil {
-			return 0, "", err
+			return 0, "", fmt.Errorf("invalid int64 %q: %w", splitted[0], errors.Unwrap(err))
 		}
 		return res, splitted[1], nil
 	}
-	return 0, "", nil
+	return 0, "", ErrUnexpectedEnd
 }
 
 func EncodeByte(value byte) string {
@@ -49,27 +76,73 @@ func EncodeByte(value byte) string {
 }
 
 func DecodeByte(data string) (byte, string, error) {
-	res := byte(0)
-	rest := ""
-	if len(data) > 0  && data[1] == NullCharStr[0] {
-		res = data[0]
-		rest = data[1:]
-		return res, rest, nil
+	if len(data) < 2 {
+		return 0, "", ErrUnexpectedEnd
+	}
+	if data[1] != NullCharStr[0] {
+		return 0, "", fmt.Errorf("byte %q isn't null terminated", data[0])
 	}
-	return res, rest, fmt.Errorf("invalid data")
+	return data[0], data[2:], nil
 }
 
+// Strings are null terminated in the text encoding, so null bytes inside them
+// are escaped as escapeChar+'0' and the escape char itself as escapeChar+'1'.
+// Strings without either byte are encoded exactly like older peers did.
+const escapeChar = '\x01'
+
 func EncodeString(value string) string {
-	return value + NullCharStr
+	if !strings.ContainsAny(value, NullCharStr+string(escapeChar)) {
+		return value + NullCharStr
+	}
+	var b strings.Builder
+	b.Grow(len(value) + 8)
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case 0:
+			b.WriteString(string(escapeChar) + "0")
+		case escapeChar:
+			b.WriteString(string(escapeChar) + "1")
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	b.WriteString(NullCharStr)
+	return b.String()
 }
 
 func DecodeString(data string) (string, string, error) {
-	res := ""
-	rest := ""
 	splitted := strings.SplitN(data, NullCharStr, 2)
-	if len(splitted) == 2 {
-		res = splitted[0]
-		rest = splitted[1]
+	if len(splitted) != 2 {
+		return "", "", ErrUnexpectedEnd
+	}
+	if err := checkStringLength(len(splitted[0])); err != nil {
+		return "", "", err
+	}
+	return unescapeString(splitted[0]), splitted[1], nil
+}
+
+// unescapeString reverts EncodeString. Escape chars that don't start a known
+// sequence are kept as they are, which is how older peers sent them.
+func unescapeString(value string) string {
+	if strings.IndexByte(value, escapeChar) < 0 {
+		return value
+	}
+	var b strings.Builder
+	b.Grow(len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] == escapeChar && i+1 < len(value) {
+			switch value[i+1] {
+			case '0':
+				b.WriteByte(0)
+				i++
+				continue
+			case '1':
+				b.WriteByte(escapeChar)
+				i++
+				continue
+			}
+		}
+		b.WriteByte(value[i])
 	}
-	return res, rest, nil
+	return b.String()
 }
@@ -1,6 +1,8 @@
 package CodableValues
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -31,36 +33,39 @@ func (cvd *Duration) Encode() string {
 }
 
 func (cvd *Duration) Decode(data string, length *int) (string, error) {
-	days, rest, err := DecodeInt64(data)
-	if err != nil {
-		return "", err
-	}
-	hours, rest, err := DecodeInt64(rest)
-	if err != nil {
-		return "", err
-	}
-	minutes, rest, err := DecodeInt64(rest)
-	if err != nil {
-		return "", err
-	}
-	seconds, rest, err := DecodeInt64(rest)
-	if err != nil {
-		return "", err
-	}
-	miliseconds, rest, err := DecodeInt64(rest)
-	if err != nil {
-		return "", err
+	fields := []string{"days", "hours", "minutes", "seconds", "miliseconds"}
+	values := make([]int64, len(fields))
+	rest := data
+	var err error
+	for i, field := range fields {
+		values[i], rest, err = DecodeInt64(rest)
+		if err != nil {
+			return "", fmt.Errorf("duration %s: %w", field, err)
+		}
 	}
 	total := time.Duration(0)
-	total += time.Duration(days) * 24 * time.Hour
-	total += time.Duration(hours) * time.Hour
-	total += time.Duration(minutes) * time.Minute
-	total += time.Duration(seconds) * time.Second
-	total += time.Duration(miliseconds) * time.Millisecond
+	total += time.Duration(values[0]) * 24 * time.Hour
+	total += time.Duration(values[1]) * time.Hour
+	total += time.Duration(values[2]) * time.Minute
+	total += time.Duration(values[3]) * time.Second
+	total += time.Duration(values[4]) * time.Millisecond
 	cvd.Value = total
 	return rest, nil
 }
 
+func (cvd *Duration) EncodeBinary() string {
+	return EncodeFixed64(cvd.Value.Milliseconds())
+}
+
+func (cvd *Duration) DecodeBinary(data string, length *int) (string, error) {
+	miliseconds, rest, err := DecodeFixed64(data)
+	if err != nil {
+		return "", fmt.Errorf("duration: %w", err)
+	}
+	cvd.Value = time.Duration(miliseconds) * time.Millisecond
+	return rest, nil
+}
+
 func (cvd *Duration) Equals(other interface{}) bool {
 	ActualValue := other.(*Duration)
 	return cvd.Value == ActualValue.Value
@@ -73,3 +78,21 @@ func (cvd *Duration) String() string {
 func (cvd *Duration) Copy() *Duration {
 	return NewDuration(cvd.Value)
 }
+
+// MarshalJSON writes the duration like "1h2m3.5s".
+func (cvd *Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cvd.Value.String())
+}
+
+func (cvd *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	value, err := time.ParseDuration(text)
+	if err != nil {
+		return fmt.Errorf("duration: %w", err)
+	}
+	cvd.Value = value
+	return nil
+}
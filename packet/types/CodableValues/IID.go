@@ -1,6 +1,12 @@
 package CodableValues
 
-import "fmt"
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 // Object == 0: represents number of objects in Structure
 // Else:
@@ -72,34 +78,74 @@ func (iid *IID) Encode() string {
 }
 
 func (iid *IID) Decode(data string, length *int) (string, error) {
+	if length == nil || *length < 2 || *length > 4 {
+		return "", fmt.Errorf("iid: %w", ErrInvalidLength)
+	}
 	iid.Length = *length
 	rest := ""
 	var err error
 	iid.Structure, rest, err = DecodeInt(data)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("iid structure: %w", err)
 	}
 	iid.Object, rest, err = DecodeInt(rest)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("iid object: %w", err)
 	}
 	if iid.Length > 2 {
 		iid.FirstIndex = new(int)
 		*iid.FirstIndex, rest, err = DecodeInt(rest)
 		if err != nil {
-			return "", err
+			return "", fmt.Errorf("iid first index: %w", err)
 		}
 	}
 	if iid.Length > 3 {
 		iid.SecondIndex = new(int)
 		*iid.SecondIndex, rest, err = DecodeInt(rest)
 		if err != nil {
-			return "", err
+			return "", fmt.Errorf("iid second index: %w", err)
 		}
 	}
 	return rest, nil
 }
 
+func (iid *IID) EncodeBinary() string {
+	encoded := EncodeBinaryInt(iid.Structure) + EncodeBinaryInt(iid.Object)
+	if iid.FirstIndex != nil {
+		encoded += EncodeBinaryInt(*iid.FirstIndex)
+		if iid.SecondIndex != nil {
+			encoded += EncodeBinaryInt(*iid.SecondIndex)
+		}
+	}
+	return encoded
+}
+
+func (iid *IID) DecodeBinary(data string, length *int) (string, error) {
+	if length == nil || *length < 2 || *length > 4 {
+		return "", fmt.Errorf("iid: %w", ErrInvalidLength)
+	}
+	iid.Length = *length
+	fields := []string{"structure", "object", "first index", "second index"}
+	values := make([]int, iid.Length)
+	rest := data
+	var err error
+	for i := range values {
+		values[i], rest, err = DecodeBinaryInt(rest)
+		if err != nil {
+			return "", fmt.Errorf("iid %s: %w", fields[i], err)
+		}
+	}
+	iid.Structure, iid.Object = values[0], values[1]
+	iid.FirstIndex, iid.SecondIndex = nil, nil
+	if iid.Length > 2 {
+		iid.FirstIndex = &values[2]
+	}
+	if iid.Length > 3 {
+		iid.SecondIndex = &values[3]
+	}
+	return rest, nil
+}
+
 func (iid *IID) Equals(other interface{}) bool {
 	ActualValue := other.(*IID)
 	structureEqual := iid.Structure == ActualValue.Structure
@@ -121,6 +167,28 @@ func (iid *IID) String() string {
 	return fmt.Sprintf("IID{%d.%d.%v.%v}", iid.Structure, iid.Object, firstIndexValue, secondIndexValue)
 }
 
+// Compare orders IIDs by structure, object and then indexes, a missing index
+// coming before any other. It returns -1, 0 or 1 like cmp.Compare.
+func (iid *IID) Compare(other *IID) int {
+	if c := cmp.Compare(iid.Structure, other.Structure); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(iid.Object, other.Object); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(indexOrZero(iid.FirstIndex), indexOrZero(other.FirstIndex)); c != 0 {
+		return c
+	}
+	return cmp.Compare(indexOrZero(iid.SecondIndex), indexOrZero(other.SecondIndex))
+}
+
+func indexOrZero(index *int) int {
+	if index == nil {
+		return 0
+	}
+	return *index
+}
+
 func (iid *IID) Copy() *IID{
 	return &IID{
 		Structure: iid.Structure,
@@ -208,3 +276,43 @@ func (iid *IID) GenListOfIIDs(MaxIndex int) ([]*IID, bool) {
 // 		SecondIndex: &CodableInt{Value: secondIndex},
 // 	}
 // }
+
+// MarshalJSON writes the IID dotted like "2.3.1", with as many parts as it
+// has.
+func (iid *IID) MarshalJSON() ([]byte, error) {
+	parts := []string{strconv.Itoa(iid.Structure), strconv.Itoa(iid.Object)}
+	if iid.FirstIndex != nil {
+		parts = append(parts, strconv.Itoa(*iid.FirstIndex))
+		if iid.SecondIndex != nil {
+			parts = append(parts, strconv.Itoa(*iid.SecondIndex))
+		}
+	}
+	return json.Marshal(strings.Join(parts, "."))
+}
+
+func (iid *IID) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	parts := strings.Split(text, ".")
+	if len(parts) < 2 || len(parts) > 4 {
+		return fmt.Errorf("iid %q: %w", text, ErrInvalidLength)
+	}
+	values := make([]int, len(parts))
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return fmt.Errorf("iid %q: invalid number %q", text, part)
+		}
+		values[i] = value
+	}
+	*iid = IID{Structure: values[0], Object: values[1], Length: len(values)}
+	if iid.Length > 2 {
+		iid.FirstIndex = &values[2]
+	}
+	if iid.Length > 3 {
+		iid.SecondIndex = &values[3]
+	}
+	return nil
+}
@@ -1,12 +1,21 @@
 package CodableValues
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 )
 
 const MiliToNano = 1000000
 
+// Timestamps are encoded with their UTC offset in seconds after the wall clock
+// fields. Timestamps without it come from older devices and are read as UTC.
+const (
+	TimestampLength       = 8
+	LegacyTimestampLength = 7
+	maxUTCOffset          = 24 * 60 * 60
+)
+
 type Timestamp struct {
 	Ts time.Time
 }
@@ -22,46 +31,90 @@ func NewTimestampNow() *Timestamp {
 func (cvts *Timestamp) Encode() string {
 	res := ""
 	res += fmt.Sprintf("%d\x00%d\x00%d\x00%d\x00%d\x00%d\x00%d\x00", cvts.Ts.Day(), cvts.Ts.Month(), cvts.Ts.Year(), cvts.Ts.Hour(), cvts.Ts.Minute(), cvts.Ts.Second(), cvts.Ts.Nanosecond()/MiliToNano)
+	_, offset := cvts.Ts.Zone()
+	res += EncodeInt(offset)
 	return res
 }
 
 func (cvts *Timestamp) Decode(data string, length *int) (string, error) {
-	rest := ""
-	day, rest, err := DecodeInt(data)
-	if err != nil {
-		return "", err
+	fields := []string{"day", "month", "year", "hour", "minute", "second", "milisecond"}
+	values := make([]int, len(fields))
+	rest := data
+	var err error
+	for i, field := range fields {
+		values[i], rest, err = DecodeInt(rest)
+		if err != nil {
+			return "", fmt.Errorf("timestamp %s: %w", field, err)
+		}
 	}
-	month, rest, err := DecodeInt(rest)
-	if err != nil {
-		return "", err
+	location := time.UTC
+	if !isLegacyTimestamp(length) {
+		var offset int
+		offset, rest, err = DecodeInt(rest)
+		if err != nil {
+			return "", fmt.Errorf("timestamp offset: %w", err)
+		}
+		if location, err = offsetLocation(offset); err != nil {
+			return "", err
+		}
 	}
-	year, rest, err := DecodeInt(rest)
+	day, month, year, hour, minute, second, milisecond := values[0], values[1], values[2], values[3], values[4], values[5], values[6]
+	value := time.Date(year, time.Month(month), day, hour, minute, second, milisecond*MiliToNano, location)
+	cvts.Ts = value
+	upgradeLength(length)
+	return rest, nil
+}
+
+func (cvts *Timestamp) EncodeBinary() string {
+	_, offset := cvts.Ts.Zone()
+	return EncodeFixed64(cvts.Ts.UnixMilli()) + EncodeBinaryInt(offset)
+}
+
+func (cvts *Timestamp) DecodeBinary(data string, length *int) (string, error) {
+	miliseconds, rest, err := DecodeFixed64(data)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("timestamp: %w", err)
 	}
-	hour, rest, err := DecodeInt(rest)
-	if err != nil {
-		return "", err
+	location := time.UTC
+	if !isLegacyTimestamp(length) {
+		var offset int
+		offset, rest, err = DecodeBinaryInt(rest)
+		if err != nil {
+			return "", fmt.Errorf("timestamp offset: %w", err)
+		}
+		if location, err = offsetLocation(offset); err != nil {
+			return "", err
+		}
 	}
-	minute, rest, err := DecodeInt(rest)
-	if err != nil {
-		return "", err
+	cvts.Ts = time.UnixMilli(miliseconds).In(location)
+	upgradeLength(length)
+	return rest, nil
+}
+
+func isLegacyTimestamp(length *int) bool {
+	return length == nil || *length == LegacyTimestampLength
+}
+
+// upgradeLength marks a decoded legacy timestamp as carrying an offset, since
+// it is encoded again with one.
+func upgradeLength(length *int) {
+	if length != nil {
+		*length = TimestampLength
 	}
-	second, rest, err := DecodeInt(rest)
-	if err != nil {
-		return "", err
+}
+
+func offsetLocation(offset int) (*time.Location, error) {
+	if offset < -maxUTCOffset || offset > maxUTCOffset {
+		return nil, fmt.Errorf("timestamp offset %ds out of range", offset)
 	}
-	milisecond, rest, err := DecodeInt(rest)
-	if err != nil {
-		return "", err
+	if offset == 0 {
+		return time.UTC, nil
 	}
-	value := time.Date(year, time.Month(month), day, hour, minute, second, milisecond*MiliToNano, time.UTC)
-	cvts.Ts = value
-	return rest, nil
+	return time.FixedZone("", offset), nil
 }
 
 func (cvts *Timestamp) String() string {
-	return "Ts{" + cvts.Ts.Format("02/01/2006 15:04:05.9999999.") + "}"
+	return "Ts{" + cvts.Ts.Format("02/01/2006 15:04:05.9999999 Z07:00") + "}"
 }
 
 
@@ -72,4 +125,22 @@ func (cvts *Timestamp) Equals(other interface{}) bool {
 
 func (cvts *Timestamp) Copy() *Timestamp {
 	return NewTimestamp(cvts.Ts)
-}
\ No newline at end of file
+}
+
+// MarshalJSON writes the timestamp in RFC 3339 with its UTC offset.
+func (cvts *Timestamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cvts.Ts.Format(time.RFC3339Nano))
+}
+
+func (cvts *Timestamp) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	value, err := time.Parse(time.RFC3339Nano, text)
+	if err != nil {
+		return fmt.Errorf("timestamp: %w", err)
+	}
+	cvts.Ts = value
+	return nil
+}
@@ -0,0 +1,74 @@
+package CodableValues_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+)
+
+func TestVarintCoding(t *testing.T) {
+	for _, v := range []int64{0, 1, -1, 63, -64, 300, math.MaxInt64, math.MinInt64} {
+		value, rest, err := CodableValues.DecodeVarint(CodableValues.EncodeVarint(v) + "x")
+		if err != nil || value != v || rest != "x" {
+			t.Errorf("Error in Varint coding of %d", v)
+		}
+	}
+	if _, _, err := CodableValues.DecodeVarint("\x80"); err == nil {
+		t.Errorf("Truncated varint should fail to decode")
+	}
+}
+
+func TestBinaryStringCoding(t *testing.T) {
+	encoded := CodableValues.EncodeBinaryString("test")
+	if encoded != "\x04test" {
+		t.Errorf("Error in Encoding binary string")
+	}
+	value, rest, err := CodableValues.DecodeBinaryString(encoded + "rest")
+	if err != nil || value != "test" || rest != "rest" {
+		t.Errorf("Error in Decoding binary string")
+	}
+	if _, _, err := CodableValues.DecodeBinaryString("\x05test"); err == nil {
+		t.Errorf("String longer than the data should fail to decode")
+	}
+}
+
+func TestBinaryTimestampCoding(t *testing.T) {
+	toCheck := time.Date(2024, 7, 8, 23, 0, 15, 152000000, time.UTC)
+	encoded := CodableValues.NewTimestamp(toCheck).EncodeBinary()
+	if len(encoded) != 9 {
+		t.Errorf("Binary timestamps should be fixed width followed by the offset")
+	}
+	length := CodableValues.TimestampLength
+	ts := new(CodableValues.Timestamp)
+	if _, err := ts.DecodeBinary(encoded, &length); err != nil || !ts.Ts.Equal(toCheck) {
+		t.Errorf("Error in Decoding binary Timestamp")
+	}
+	length = CodableValues.LegacyTimestampLength
+	ts = new(CodableValues.Timestamp)
+	if _, err := ts.DecodeBinary(encoded[:8], &length); err != nil || !ts.Ts.Equal(toCheck) {
+		t.Errorf("Error in Decoding legacy binary Timestamp")
+	}
+}
+
+func TestBinaryDurationCoding(t *testing.T) {
+	delta := 3*time.Hour + 15*time.Second + 5*time.Millisecond
+	d := new(CodableValues.Duration)
+	if _, err := d.DecodeBinary(CodableValues.NewDuration(delta).EncodeBinary(), nil); err != nil || d.Value != delta {
+		t.Errorf("Error in Decoding binary Duration")
+	}
+}
+
+func TestBinaryIIDCoding(t *testing.T) {
+	iid := CodableValues.NewIIDDoubleIndex(6, 1, 2, 500)
+	decoded := new(CodableValues.IID)
+	l := 4
+	if _, err := decoded.DecodeBinary(iid.EncodeBinary(), &l); err != nil || !decoded.Equals(iid) {
+		t.Errorf("Error in Decoding binary IID")
+	}
+	l = 5
+	if _, err := decoded.DecodeBinary(iid.EncodeBinary(), &l); err == nil {
+		t.Errorf("IID with invalid length should fail to decode")
+	}
+}
@@ -0,0 +1,24 @@
+package CodableValues_test
+
+import (
+	"testing"
+
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+)
+
+func TestCodableBoolCoding(t *testing.T) {
+	cvb := &CodableValues.CodableBool{Value: true}
+	if cvb.Encode() != "1\x00" || cvb.EncodeBinary() != "\x01" {
+		t.Errorf("Error in CodableBool.Encode()")
+	}
+	decoded := &CodableValues.CodableBool{}
+	if _, err := decoded.Decode("1\x00", nil); err != nil || !decoded.Value {
+		t.Errorf("Error in CodableBool.Decode()")
+	}
+	if _, err := decoded.DecodeBinary("\x00", nil); err != nil || decoded.Value {
+		t.Errorf("Error in CodableBool.DecodeBinary()")
+	}
+	if _, err := decoded.Decode("2\x00", nil); err == nil {
+		t.Errorf("Booleans other than 0 and 1 should be rejected")
+	}
+}
@@ -0,0 +1,27 @@
+package CodableValues_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+)
+
+func TestCodableCounterCoding(t *testing.T) {
+	cvc := &CodableValues.CodableCounter{Value: math.MaxUint64}
+	if cvc.Encode() != "18446744073709551615\x00" {
+		t.Errorf("Error in CodableCounter.Encode()")
+	}
+	decoded := &CodableValues.CodableCounter{}
+	if _, err := decoded.Decode(cvc.Encode(), nil); err != nil || decoded.Value != math.MaxUint64 {
+		t.Errorf("Error in CodableCounter.Decode()")
+	}
+	decoded = &CodableValues.CodableCounter{}
+	if _, err := decoded.DecodeBinary(cvc.EncodeBinary(), nil); err != nil || decoded.Value != math.MaxUint64 {
+		t.Errorf("Error in CodableCounter.DecodeBinary()")
+	}
+	cvc.Increment(1)
+	if cvc.Value != 0 {
+		t.Errorf("Counter should wrap around to zero")
+	}
+}
@@ -0,0 +1,50 @@
+package CodableValues_test
+
+import (
+	"testing"
+
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+)
+
+func TestCodableDecimalCoding(t *testing.T) {
+	cvd := CodableValues.NewDecimal(215, 1)
+	if cvd.Encode() != "215\x001\x00" {
+		t.Errorf("Error in CodableDecimal.Encode()")
+	}
+	decoded := &CodableValues.CodableDecimal{}
+	if _, err := decoded.Decode(cvd.Encode(), nil); err != nil || decoded.Value != 215 || decoded.Scale != 1 {
+		t.Errorf("Error in CodableDecimal.Decode()")
+	}
+	decoded = &CodableValues.CodableDecimal{}
+	if _, err := decoded.DecodeBinary(cvd.EncodeBinary(), nil); err != nil || decoded.Value != 215 || decoded.Scale != 1 {
+		t.Errorf("Error in CodableDecimal.DecodeBinary()")
+	}
+}
+
+func TestCodableDecimalString(t *testing.T) {
+	cases := map[string]*CodableValues.CodableDecimal{
+		"21.5":   CodableValues.NewDecimal(215, 1),
+		"-0.05":  CodableValues.NewDecimal(-5, 2),
+		"0.005":  CodableValues.NewDecimal(5, 3),
+		"42":     CodableValues.NewDecimal(42, 0),
+		"-21.50": CodableValues.NewDecimalFromFloat(-21.5, 2),
+	}
+	for expected, cvd := range cases {
+		if cvd.String() != expected {
+			t.Errorf("Expected %s, got %s", expected, cvd.String())
+		}
+		parsed, err := CodableValues.ParseDecimal(expected)
+		if err != nil || !parsed.Equals(cvd) {
+			t.Errorf("Error parsing %s", expected)
+		}
+	}
+}
+
+func TestCodableDecimalEquality(t *testing.T) {
+	if !CodableValues.NewDecimal(215, 1).Equals(CodableValues.NewDecimal(2150, 2)) {
+		t.Errorf("21.5 and 21.50 should be equal")
+	}
+	if CodableValues.NewDecimal(215, 1).Compare(CodableValues.NewDecimal(2149, 2)) != 1 {
+		t.Errorf("21.5 should be bigger than 21.49")
+	}
+}
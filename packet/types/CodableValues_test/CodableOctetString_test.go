@@ -0,0 +1,25 @@
+package CodableValues_test
+
+import (
+	"testing"
+
+	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
+)
+
+func TestCodableOctetStringCoding(t *testing.T) {
+	cvo := &CodableValues.CodableOctetString{Value: []byte{0x00, 0xde, 0xad, 0x01}}
+	if cvo.Encode() != "00dead01\x00" {
+		t.Errorf("Error in CodableOctetString.Encode()")
+	}
+	decoded := &CodableValues.CodableOctetString{}
+	if _, err := decoded.Decode(cvo.Encode(), nil); err != nil || !decoded.Equals(cvo) {
+		t.Errorf("Error in CodableOctetString.Decode()")
+	}
+	decoded = &CodableValues.CodableOctetString{}
+	if _, err := decoded.DecodeBinary(cvo.EncodeBinary(), nil); err != nil || !decoded.Equals(cvo) {
+		t.Errorf("Error in CodableOctetString.DecodeBinary()")
+	}
+	if cvo.String() != "0x00dead01" {
+		t.Errorf("Error in CodableOctetString.String()")
+	}
+}
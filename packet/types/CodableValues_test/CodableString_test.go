@@ -21,3 +21,42 @@ func TestCodableStringDecoding(t *testing.T) {
 		t.Errorf("Error in CodableString.Decode()")
 	}
 }
+
+var unsafeStrings = []string{
+	"",
+	"null\x00inside",
+	"\x00\x00",
+	"escape\x01char\x01",
+	"\x010 looks escaped",
+	"multi\nline\r\n",
+	"ação 温度 🌡",
+	"\xff\xfe not utf-8",
+}
+
+func TestCodableStringRoundTrip(t *testing.T) {
+	for _, value := range unsafeStrings {
+		encoded := (&CodableValues.CodableString{Value: value}).Encode() + "rest"
+		cvs := &CodableValues.CodableString{}
+		rest, err := cvs.Decode(encoded, nil)
+		if err != nil || cvs.Value != value || rest != "rest" {
+			t.Errorf("Error in CodableString text round trip of %q: got %q", value, cvs.Value)
+		}
+		encoded = (&CodableValues.CodableString{Value: value}).EncodeBinary() + "rest"
+		cvs = &CodableValues.CodableString{}
+		rest, err = cvs.DecodeBinary(encoded, nil)
+		if err != nil || cvs.Value != value || rest != "rest" {
+			t.Errorf("Error in CodableString binary round trip of %q: got %q", value, cvs.Value)
+		}
+	}
+}
+
+func TestCodableStringLegacyDecoding(t *testing.T) {
+	cvs := &CodableValues.CodableString{}
+	cvs.Decode("old\x01peer\x00", nil)
+	if cvs.Value != "old\x01peer" {
+		t.Errorf("Unknown escape sequences from older peers should be kept")
+	}
+	if (&CodableValues.CodableString{Value: "ação"}).Encode() != "ação\x00" {
+		t.Errorf("Strings without null bytes should be encoded like older peers do")
+	}
+}
@@ -1,6 +1,7 @@
 package CodableValues_test
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
@@ -52,4 +53,39 @@ func TestIIDDoubleIndexDecoding(t *testing.T) {
 	if iid.Structure != 6 || iid.Object != 1 || *iid.FirstIndex != 2 || *iid.SecondIndex != 5 || iid.Length != 4 {
 		t.Errorf("Error in Decoding double index IID")
 	}
-}
\ No newline at end of file
+}
+func TestIIDOrdering(t *testing.T) {
+	ordered := []*CodableValues.IID{
+		CodableValues.NewIID(1, 0),
+		CodableValues.NewIIDSingleIndex(1, 1, 1),
+		CodableValues.NewIIDSingleIndex(1, 1, 2),
+		CodableValues.NewIIDSingleIndex(1, 2, 1),
+		CodableValues.NewIIDDoubleIndex(1, 2, 1, 3),
+		CodableValues.NewIIDSingleIndex(2, 1, 1),
+	}
+	for i := 1; i < len(ordered); i++ {
+		if ordered[i-1].Compare(ordered[i]) != -1 || ordered[i].Compare(ordered[i-1]) != 1 {
+			t.Errorf("%v should come before %v", ordered[i-1], ordered[i])
+		}
+		if ordered[i].Compare(ordered[i].Copy()) != 0 {
+			t.Errorf("%v should be equal to its copy", ordered[i])
+		}
+	}
+}
+
+func TestIIDJSON(t *testing.T) {
+	iid := CodableValues.NewIIDDoubleIndex(2, 3, 0, 0)
+	encoded, err := json.Marshal(iid)
+	if err != nil || string(encoded) != `"2.3.0.0"` {
+		t.Errorf("Error in Encoding IID as JSON: %s", encoded)
+	}
+	decoded := &CodableValues.IID{}
+	if err := json.Unmarshal(encoded, decoded); err != nil || !decoded.Equals(iid) || decoded.Length != 4 {
+		t.Errorf("Error in Decoding IID from JSON: %v", err)
+	}
+	for _, invalid := range []string{`"2"`, `"1.2.3.4.5"`, `"1.a"`, `12`} {
+		if err := json.Unmarshal([]byte(invalid), decoded); err == nil {
+			t.Errorf("Decoded invalid IID %s", invalid)
+		}
+	}
+}
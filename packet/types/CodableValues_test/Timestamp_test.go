@@ -11,12 +11,73 @@ func TestTimeStampCoding(t *testing.T) {
 	toCheck := time.Date(2024, 7, 8, 23, 0, 15, 152000000, time.UTC)
 	ts := CodableValues.NewTimestamp(toCheck)
 	encoded := ts.Encode()
-	if encoded != "8\x007\x002024\x0023\x000\x0015\x00152\x00" {
+	if encoded != "8\x007\x002024\x0023\x000\x0015\x00152\x000\x00" {
 		t.Errorf("Error in Encoding Timestamp")
 	}
+	length := CodableValues.TimestampLength
 	ts1 := new(CodableValues.Timestamp)
-	ts1.Decode("8\x007\x002024\x0023\x000\x0015\x00152\x00", nil)
+	ts1.Decode("8\x007\x002024\x0023\x000\x0015\x00152\x000\x00", &length)
 	if !ts1.Ts.Equal(toCheck) {
 		t.Errorf("Error in Decoding Timestamp")
 	}
-}
\ No newline at end of file
+}
+
+func TestLegacyTimeStampDecoding(t *testing.T) {
+	toCheck := time.Date(2024, 7, 8, 23, 0, 15, 152000000, time.UTC)
+	length := CodableValues.LegacyTimestampLength
+	ts := new(CodableValues.Timestamp)
+	rest, err := ts.Decode("8\x007\x002024\x0023\x000\x0015\x00152\x00", &length)
+	if err != nil || rest != "" || !ts.Ts.Equal(toCheck) {
+		t.Errorf("Error in Decoding legacy Timestamp")
+	}
+	if length != CodableValues.TimestampLength {
+		t.Errorf("Decoded legacy Timestamp should be encoded with its offset")
+	}
+}
+
+func TestTimeStampZones(t *testing.T) {
+	zones := []string{"UTC", "Europe/Lisbon", "America/New_York", "Asia/Kolkata", "Australia/Lord_Howe", "Pacific/Chatham"}
+	instants := []time.Time{
+		time.Date(2024, 7, 8, 23, 0, 15, 152000000, time.UTC),
+		// Around the DST transitions of 2024 in Europe and the US
+		time.Date(2024, 3, 31, 0, 59, 59, 999000000, time.UTC),
+		time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC),
+		time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC),
+		time.Date(2024, 10, 27, 1, 30, 0, 0, time.UTC),
+		time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC),
+		time.Date(2024, 11, 3, 6, 30, 0, 0, time.UTC),
+	}
+	for _, zone := range zones {
+		location, err := time.LoadLocation(zone)
+		if err != nil {
+			t.Skipf("Time zone database not available: %v", err)
+		}
+		for _, instant := range instants {
+			local := instant.In(location)
+			_, offset := local.Zone()
+			length := CodableValues.TimestampLength
+			ts := new(CodableValues.Timestamp)
+			if _, err := ts.Decode(CodableValues.NewTimestamp(local).Encode(), &length); err != nil || !ts.Ts.Equal(local) {
+				t.Errorf("Error in text coding of %v in %s: got %v", local, zone, ts.Ts)
+			}
+			if _, decodedOffset := ts.Ts.Zone(); decodedOffset != offset || ts.Ts.Hour() != local.Hour() {
+				t.Errorf("Offset of %v in %s was not preserved: got %v", local, zone, ts.Ts)
+			}
+			ts = new(CodableValues.Timestamp)
+			if _, err := ts.DecodeBinary(CodableValues.NewTimestamp(local).EncodeBinary(), &length); err != nil || !ts.Ts.Equal(local) {
+				t.Errorf("Error in binary coding of %v in %s: got %v", local, zone, ts.Ts)
+			}
+			if _, decodedOffset := ts.Ts.Zone(); decodedOffset != offset {
+				t.Errorf("Offset of %v in %s was not preserved in binary: got %v", local, zone, ts.Ts)
+			}
+		}
+	}
+}
+
+func TestTimeStampInvalidOffset(t *testing.T) {
+	length := CodableValues.TimestampLength
+	ts := new(CodableValues.Timestamp)
+	if _, err := ts.Decode("8\x007\x002024\x0023\x000\x0015\x00152\x00100000\x00", &length); err == nil {
+		t.Errorf("Offsets bigger than a day should fail to decode")
+	}
+}
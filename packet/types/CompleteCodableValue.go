@@ -1,9 +1,12 @@
 package types
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"regexp"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
@@ -34,7 +37,7 @@ func NewCodableString(value string) *CompleteCodableValue {
 func NewCodableTimestamp(ts time.Time) *CompleteCodableValue {
 	return &CompleteCodableValue{
 		DataType: 'T',
-		Length:   7,
+		Length:   CodableValues.TimestampLength,
 		Value:    CodableValues.NewTimestamp(ts),
 	}
 }
@@ -42,7 +45,7 @@ func NewCodableTimestamp(ts time.Time) *CompleteCodableValue {
 func NewCodableTimestampNow() *CompleteCodableValue {
 	return &CompleteCodableValue{
 		DataType: 'T',
-		Length:   7,
+		Length:   CodableValues.TimestampLength,
 		Value:    CodableValues.NewTimestampNow(),
 	}
 }
@@ -55,6 +58,46 @@ func NewCodableDuration(d time.Duration) *CompleteCodableValue {
 	}
 }
 
+func NewCodableBool(value bool) *CompleteCodableValue {
+	return &CompleteCodableValue{
+		DataType: 'B',
+		Length:   1,
+		Value:    &CodableValues.CodableBool{Value: value},
+	}
+}
+
+func NewCodableDecimal(value int64, scale int) *CompleteCodableValue {
+	return &CompleteCodableValue{
+		DataType: 'F',
+		Length:   2,
+		Value:    CodableValues.NewDecimal(value, scale),
+	}
+}
+
+func NewCodableOctetString(value []byte) *CompleteCodableValue {
+	return &CompleteCodableValue{
+		DataType: 'O',
+		Length:   1,
+		Value:    &CodableValues.CodableOctetString{Value: value},
+	}
+}
+
+func NewCodableCounter(value uint64) *CompleteCodableValue {
+	return &CompleteCodableValue{
+		DataType: 'C',
+		Length:   1,
+		Value:    &CodableValues.CodableCounter{Value: value},
+	}
+}
+
+func NewCodableNull() *CompleteCodableValue {
+	return &CompleteCodableValue{
+		DataType: 'N',
+		Length:   0,
+		Value:    &CodableValues.CodableNull{},
+	}
+}
+
 func NewCodableIID(Structure, Object int, Indexes []int) *CompleteCodableValue {
 	l := 2 + len(Indexes)
 	var iid *CodableValues.IID
@@ -80,35 +123,156 @@ func (cvd *CompleteCodableValue) Encode() string {
 }
 
 func (cvd *CompleteCodableValue) Decode(data string) (string, error) {
-	var unparsedValue string
-	ptrn, _ := regexp.Compile(`^([ISTD])\x00(\d+)\x00(.+)$`)
-	matches := ptrn.FindStringSubmatch(data)
-	cvd.DataType = matches[1][0]
-	cvd.Length, _ = strconv.Atoi(matches[2])
-	unparsedValue = matches[3]
-	switch cvd.DataType {
+	dataType, rest, err := CodableValues.DecodeByte(data)
+	if err != nil {
+		return "", fmt.Errorf("value data type: %w", err)
+	}
+	length, rest, err := CodableValues.DecodeInt(rest)
+	if err != nil {
+		return "", fmt.Errorf("value length: %w", err)
+	}
+	if length < 0 {
+		return "", fmt.Errorf("value length %d: %w", length, CodableValues.ErrInvalidLength)
+	}
+	cvd.DataType = dataType
+	cvd.Length = length
+	cvd.Value, err = newCodableValueI(cvd.DataType, cvd.Length)
+	if err != nil {
+		return "", err
+	}
+	return cvd.Value.Decode(rest, &cvd.Length)
+}
+
+func (cvd *CompleteCodableValue) EncodeBinary() string {
+	return string(cvd.DataType) + CodableValues.EncodeUvarint(uint64(cvd.Length)) + cvd.Value.EncodeBinary()
+}
+
+func (cvd *CompleteCodableValue) DecodeBinary(data string) (string, error) {
+	if len(data) == 0 {
+		return "", fmt.Errorf("value data type: %w", CodableValues.ErrUnexpectedEnd)
+	}
+	cvd.DataType = data[0]
+	length, rest, err := CodableValues.DecodeUvarint(data[1:])
+	if err != nil {
+		return "", fmt.Errorf("value length: %w", err)
+	}
+	if length > math.MaxInt32 {
+		return "", fmt.Errorf("value length %d: %w", length, CodableValues.ErrInvalidLength)
+	}
+	cvd.Length = int(length)
+	cvd.Value, err = newCodableValueI(cvd.DataType, cvd.Length)
+	if err != nil {
+		return "", err
+	}
+	return cvd.Value.DecodeBinary(rest, &cvd.Length)
+}
+
+func newCodableValueI(dataType byte, length int) (CodableValueI, error) {
+	switch dataType {
 	case 'I':
-		cvd.Value = &CodableValues.CodableInt{}
+		return &CodableValues.CodableInt{}, nil
 	case 'S':
-		cvd.Value = &CodableValues.CodableString{}
+		return &CodableValues.CodableString{}, nil
 	case 'T':
-		if cvd.Length == 7 {
-			cvd.Value = &CodableValues.Timestamp{}
-		} else if cvd.Length == 5 {
-			cvd.Value = &CodableValues.Duration{}
-		} else {
-			return "", fmt.Errorf("invalid length for Timestamp or Duration")
+		if length == CodableValues.TimestampLength || length == CodableValues.LegacyTimestampLength {
+			return &CodableValues.Timestamp{}, nil
+		} else if length == 5 {
+			return &CodableValues.Duration{}, nil
 		}
+		return nil, fmt.Errorf("invalid length for Timestamp or Duration")
 	case 'D':
-		cvd.Value = &CodableValues.IID{}
-	default:
-		return "", fmt.Errorf("invalid data type")
+		return &CodableValues.IID{}, nil
+	case 'B':
+		return &CodableValues.CodableBool{}, nil
+	case 'F':
+		return &CodableValues.CodableDecimal{}, nil
+	case 'O':
+		return &CodableValues.CodableOctetString{}, nil
+	case 'C':
+		return &CodableValues.CodableCounter{}, nil
+	case 'N':
+		return &CodableValues.CodableNull{}, nil
 	}
-	rest, error := cvd.Value.Decode(unparsedValue, &cvd.Length)
-	if error != nil {
-		return "", error
+	return nil, fmt.Errorf("invalid data type")
+}
+
+// InputFormat describes how a value of the data type of template is typed,
+// for ParseCodableValue.
+func InputFormat(template *CompleteCodableValue) string {
+	switch template.Value.(type) {
+	case *CodableValues.CodableInt:
+		return "integer"
+	case *CodableValues.CodableString:
+		return "text"
+	case *CodableValues.CodableBool:
+		return "on or off"
+	case *CodableValues.CodableDecimal:
+		return "decimal, like 21.5"
+	case *CodableValues.CodableOctetString:
+		return "hex bytes, like 0x0a1b"
+	case *CodableValues.CodableCounter:
+		return "counter, 0 or more"
+	case *CodableValues.Timestamp:
+		return "YYYY-MM-DD hh:mm:ss"
+	case *CodableValues.Duration:
+		return "duration, like 1m30s"
 	}
-	return rest, nil
+	return "unsupported"
+}
+
+// ParseCodableValue reads a value typed by a user, using the data type of
+// template, which is usually the current value of the object being set.
+func ParseCodableValue(template *CompleteCodableValue, text string) (*CompleteCodableValue, error) {
+	text = strings.TrimSpace(text)
+	switch template.Value.(type) {
+	case *CodableValues.CodableInt:
+		value, err := strconv.Atoi(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", text)
+		}
+		return NewCodableInt(value), nil
+	case *CodableValues.CodableString:
+		return NewCodableString(text), nil
+	case *CodableValues.CodableBool:
+		switch strings.ToLower(text) {
+		case "1", "true", "on", "yes":
+			return NewCodableBool(true), nil
+		case "0", "false", "off", "no":
+			return NewCodableBool(false), nil
+		}
+		return nil, fmt.Errorf("invalid boolean %q", text)
+	case *CodableValues.CodableDecimal:
+		value, err := CodableValues.ParseDecimal(text)
+		if err != nil {
+			return nil, err
+		}
+		return NewCodableDecimal(value.Value, value.Scale), nil
+	case *CodableValues.CodableOctetString:
+		value, err := hex.DecodeString(strings.TrimPrefix(text, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex octet string %q", text)
+		}
+		return NewCodableOctetString(value), nil
+	case *CodableValues.CodableCounter:
+		value, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid counter %q", text)
+		}
+		return NewCodableCounter(value), nil
+	case *CodableValues.Timestamp:
+		value, err := time.ParseInLocation("2006-01-02 15:04:05", text, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q, expected YYYY-MM-DD hh:mm:ss", text)
+		}
+		return NewCodableTimestamp(value), nil
+	case *CodableValues.Duration:
+		value, err := time.ParseDuration(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q", text)
+		}
+		return NewCodableDuration(value), nil
+	}
+	return nil, fmt.Errorf("values of type %c can't be parsed", template.DataType)
 }
 
 func (cvd *CompleteCodableValue) Equals(other interface{}) bool {
@@ -120,6 +284,31 @@ func (cvd *CompleteCodableValue) String() string {
 	return cvd.Value.String()
 }
 
+// maxRenderedOctets is how many bytes of an octet string are shown before the
+// rest is left out.
+const maxRenderedOctets = 16
+
+// Render returns the value as shown in the TUI, which ParseCodableValue reads
+// back unless it's a long octet string.
+func (cvd *CompleteCodableValue) Render() string {
+	switch value := cvd.Value.(type) {
+	case *CodableValues.CodableBool:
+		if value.Value {
+			return "on"
+		}
+		return "off"
+	case *CodableValues.CodableOctetString:
+		if len(value.Value) > maxRenderedOctets {
+			return fmt.Sprintf("0x%s… (%d bytes)", hex.EncodeToString(value.Value[:maxRenderedOctets]), len(value.Value))
+		}
+	case *CodableValues.Timestamp:
+		return value.Ts.Local().Format("2006-01-02 15:04:05")
+	case *CodableValues.Duration:
+		return value.Value.String()
+	}
+	return cvd.String()
+}
+
 func (cvd *CompleteCodableValue) Copy() *CompleteCodableValue {
 	valueCopy := CopyCodableValueI(cvd.Value)
 	r := &CompleteCodableValue{
@@ -129,3 +318,95 @@ func (cvd *CompleteCodableValue) Copy() *CompleteCodableValue {
 	}
 	return r
 }
+
+// jsonValue is how values are written in JSON, tagged with the name of their
+// type so they can be read back.
+type jsonValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+func jsonTypeName(value CodableValueI) (string, error) {
+	switch value.(type) {
+	case *CodableValues.CodableInt:
+		return "int", nil
+	case *CodableValues.CodableString:
+		return "string", nil
+	case *CodableValues.Timestamp:
+		return "timestamp", nil
+	case *CodableValues.Duration:
+		return "duration", nil
+	case *CodableValues.IID:
+		return "iid", nil
+	case *CodableValues.CodableBool:
+		return "bool", nil
+	case *CodableValues.CodableDecimal:
+		return "decimal", nil
+	case *CodableValues.CodableOctetString:
+		return "octets", nil
+	case *CodableValues.CodableCounter:
+		return "counter", nil
+	case *CodableValues.CodableNull:
+		return "null", nil
+	}
+	return "", fmt.Errorf("values of type %T can't be written in JSON", value)
+}
+
+func newJSONValue(typeName string) (*CompleteCodableValue, error) {
+	switch typeName {
+	case "int":
+		return NewCodableInt(0), nil
+	case "string":
+		return NewCodableString(""), nil
+	case "timestamp":
+		return NewCodableTimestamp(time.Time{}), nil
+	case "duration":
+		return NewCodableDuration(0), nil
+	case "iid":
+		return NewCodableIID(0, 0, nil), nil
+	case "bool":
+		return NewCodableBool(false), nil
+	case "decimal":
+		return NewCodableDecimal(0, 0), nil
+	case "octets":
+		return NewCodableOctetString(nil), nil
+	case "counter":
+		return NewCodableCounter(0), nil
+	case "null":
+		return NewCodableNull(), nil
+	}
+	return nil, fmt.Errorf("unknown value type %q", typeName)
+}
+
+func (cvd *CompleteCodableValue) MarshalJSON() ([]byte, error) {
+	typeName, err := jsonTypeName(cvd.Value)
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(cvd.Value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonValue{Type: typeName, Value: value})
+}
+
+func (cvd *CompleteCodableValue) UnmarshalJSON(data []byte) error {
+	var tagged jsonValue
+	if err := json.Unmarshal(data, &tagged); err != nil {
+		return err
+	}
+	value, err := newJSONValue(tagged.Type)
+	if err != nil {
+		return err
+	}
+	if len(tagged.Value) > 0 {
+		if err := json.Unmarshal(tagged.Value, value.Value); err != nil {
+			return fmt.Errorf("%s value: %w", tagged.Type, err)
+		}
+	}
+	if iid, ok := value.Value.(*CodableValues.IID); ok {
+		value.Length = iid.Length
+	}
+	*cvd = *value
+	return nil
+}
@@ -1,7 +1,10 @@
 package types
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/eivarin/LSNMPvS-DomoticSystem/packet/types/CodableValues"
 )
@@ -18,4 +21,167 @@ func TestCompleteIIDSimple(t *testing.T) {
 	if ciid2.DataType != 'D' || ciid2.Length != 2 || iid.Structure != 6 || iid.Object != 0 || iid.FirstIndex != nil || iid.SecondIndex != nil {
 		t.Errorf("Error in Decoding simple IID")
 	}
-}
\ No newline at end of file
+}
+
+func TestCodableListAppendMatchesDecode(t *testing.T) {
+	l := CodableList{}
+	l.Append(NewCodableInt(1))
+	l.Append(NewCodableString("two"))
+	decoded := CodableList{}
+	if _, err := decoded.Decode(l.Encode()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		if l[i] == nil || !l[i].Equals(decoded[i]) {
+			t.Errorf("appended entry %d is %v, decoded it's %v", i, l[i], decoded[i])
+		}
+	}
+}
+
+func TestRenderReadsBack(t *testing.T) {
+	for _, value := range []*CompleteCodableValue{
+		NewCodableInt(-3),
+		NewCodableBool(true),
+		NewCodableDecimal(215, 1),
+		NewCodableOctetString([]byte{0x0a, 0x1b}),
+		NewCodableCounter(42),
+		NewCodableDuration(90 * time.Second),
+	} {
+		parsed, err := ParseCodableValue(value, value.Render())
+		if err != nil || !parsed.Equals(value) {
+			t.Errorf("%s rendered as %q was read back as %v, %v", value, value.Render(), parsed, err)
+		}
+	}
+	if rendered := NewCodableOctetString(make([]byte, 20)).Render(); rendered != "0x"+strings.Repeat("00", 16)+"… (20 bytes)" {
+		t.Errorf("long octet string rendered as %q", rendered)
+	}
+}
+
+func FuzzCompleteCodableValueDecode(f *testing.F) {
+	f.Add(NewCodableIID(6, 0, []int{}).Encode())
+	f.Add(NewCodableIID(2, 3, []int{1, 2}).Encode())
+	f.Add(NewCodableInt(-10).Encode())
+	f.Add(NewCodableString("KitchenAgent").Encode())
+	f.Add(NewCodableTimestampNow().Encode())
+	f.Add(NewCodableDuration(90061001000000).Encode())
+	f.Add("D\x009\x001\x00")
+	f.Add(NewCodableDecimal(-215, 1).Encode())
+	f.Add(NewCodableOctetString([]byte{0, 0xff}).Encode())
+	f.Add(NewCodableCounter(1 << 63).EncodeBinary())
+	f.Add(NewCodableIID(2, 3, []int{1, 2}).EncodeBinary())
+	f.Add(NewCodableTimestampNow().EncodeBinary())
+	f.Fuzz(func(t *testing.T, data string) {
+		c := &CompleteCodableValue{}
+		if _, err := c.DecodeBinary(data); err == nil {
+			c1 := &CompleteCodableValue{}
+			if _, err := c1.DecodeBinary(c.EncodeBinary()); err != nil {
+				t.Errorf("Re-encoded binary value failed to decode: %v", err)
+			}
+		}
+		c = &CompleteCodableValue{}
+		if _, err := c.Decode(data); err != nil {
+			return
+		}
+		c1 := &CompleteCodableValue{}
+		if _, err := c1.Decode(c.Encode()); err != nil {
+			t.Errorf("Re-encoded value failed to decode: %v", err)
+		}
+	})
+}
+
+func TestCompleteIIDBinary(t *testing.T) {
+	ciid := NewCodableIID(6, 0, []int{})
+	encoded := ciid.EncodeBinary()
+	if encoded != "D\x02\x0c\x00" {
+		t.Errorf("Error in Encoding simple IID in binary")
+	}
+	ciid2 := &CompleteCodableValue{}
+	if _, err := ciid2.DecodeBinary(encoded); err != nil || !ciid2.Equals(ciid) {
+		t.Errorf("Error in Decoding simple IID in binary")
+	}
+}
+
+func TestCompleteNewDataTypes(t *testing.T) {
+	values := []*CompleteCodableValue{
+		NewCodableBool(true),
+		NewCodableDecimal(215, 1),
+		NewCodableOctetString([]byte{0, 1, 2}),
+		NewCodableCounter(1 << 40),
+		NewCodableNull(),
+	}
+	for _, value := range values {
+		decoded := &CompleteCodableValue{}
+		if _, err := decoded.Decode(value.Encode()); err != nil || !decoded.Equals(value) {
+			t.Errorf("Error in text round trip of %c: %v", value.DataType, err)
+		}
+		decoded = &CompleteCodableValue{}
+		if _, err := decoded.DecodeBinary(value.EncodeBinary()); err != nil || !decoded.Equals(value) {
+			t.Errorf("Error in binary round trip of %c: %v", value.DataType, err)
+		}
+		if !value.Copy().Equals(value) {
+			t.Errorf("Error copying %c", value.DataType)
+		}
+	}
+}
+
+func TestCompleteCodableValueJSON(t *testing.T) {
+	values := map[string]*CompleteCodableValue{
+		`{"type":"int","value":-10}`:                                   NewCodableInt(-10),
+		`{"type":"string","value":"KitchenAgent"}`:                     NewCodableString("KitchenAgent"),
+		`{"type":"timestamp","value":"2024-07-08T23:00:15.152+01:00"}`: NewCodableTimestamp(time.Date(2024, 7, 8, 23, 0, 15, 152000000, time.FixedZone("", 3600))),
+		`{"type":"duration","value":"25h1m1.001s"}`:                    NewCodableDuration(90061001000000),
+		`{"type":"iid","value":"2.3.1.2"}`:                             NewCodableIID(2, 3, []int{1, 2}),
+		`{"type":"iid","value":"6.0"}`:                                 NewCodableIID(6, 0, []int{}),
+		`{"type":"bool","value":true}`:                                 NewCodableBool(true),
+		`{"type":"decimal","value":"-21.50"}`:                          NewCodableDecimal(-2150, 2),
+		`{"type":"octets","value":"00ff"}`:                             NewCodableOctetString([]byte{0, 255}),
+		`{"type":"counter","value":18446744073709551615}`:              NewCodableCounter(18446744073709551615),
+		`{"type":"null","value":null}`:                                 NewCodableNull(),
+	}
+	for expected, value := range values {
+		encoded, err := json.Marshal(value)
+		if err != nil || string(encoded) != expected {
+			t.Errorf("Got %s, expected %s: %v", encoded, expected, err)
+		}
+		decoded := &CompleteCodableValue{}
+		if err := json.Unmarshal([]byte(expected), decoded); err != nil || !decoded.Equals(value) {
+			t.Errorf("Decoded %s as %v: %v", expected, decoded, err)
+		}
+	}
+	for _, invalid := range []string{`{"type":"float","value":1.5}`, `{"type":"iid","value":"2"}`, `{"type":"int","value":"1"}`} {
+		if err := json.Unmarshal([]byte(invalid), &CompleteCodableValue{}); err == nil {
+			t.Errorf("Decoded invalid value %s", invalid)
+		}
+	}
+}
+
+func TestParseCodableValue(t *testing.T) {
+	cases := []struct {
+		template *CompleteCodableValue
+		text     string
+		expected *CompleteCodableValue
+	}{
+		{NewCodableInt(0), "42", NewCodableInt(42)},
+		{NewCodableBool(false), "on", NewCodableBool(true)},
+		{NewCodableDecimal(0, 1), "21.5", NewCodableDecimal(215, 1)},
+		{NewCodableOctetString(nil), "0xbeef", NewCodableOctetString([]byte{0xbe, 0xef})},
+		{NewCodableCounter(0), "7", NewCodableCounter(7)},
+	}
+	for _, c := range cases {
+		value, err := ParseCodableValue(c.template, c.text)
+		if err != nil || !value.Equals(c.expected) {
+			t.Errorf("Error parsing %q: %v", c.text, err)
+		}
+	}
+	if _, err := ParseCodableValue(NewCodableBool(false), "maybe"); err == nil {
+		t.Errorf("Invalid boolean should fail to parse")
+	}
+}
+
+func TestCompleteLegacyTimestamp(t *testing.T) {
+	expected := NewCodableTimestamp(time.Date(2024, 7, 8, 23, 0, 15, 152000000, time.UTC))
+	decoded := &CompleteCodableValue{}
+	if _, err := decoded.Decode("T\x007\x008\x007\x002024\x0023\x000\x0015\x00152\x00"); err != nil || !decoded.Equals(expected) {
+		t.Errorf("Error decoding a Timestamp without offset: %v", err)
+	}
+}